@@ -0,0 +1,94 @@
+package acceptance
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestConversationBehaviour covers "Conversation Behaviour" in
+// spec/acceptance-criteria.md.
+func TestConversationBehaviour(t *testing.T) {
+	t.Run("B-01 first person, professional and concise", func(t *testing.T) {
+		s := newStack(t)
+		requireStatus(t, s.ask(t, "What do you work on?", ""), http.StatusOK, "")
+
+		policy := s.openai.lastChat(t).Messages[0]
+		require.Equal(t, "system", policy.Role)
+		require.Contains(t, policy.Content, "first-person voice as the portfolio owner")
+		require.Contains(t, policy.Content, "professional and concise")
+	})
+
+	t.Run("B-02 answers the current question", func(t *testing.T) {
+		s := newStack(t)
+		first := s.ask(t, "Where did you study?", "")
+		requireStatus(t, first, http.StatusOK, "")
+		requireStatus(t, s.ask(t, "Which cloud providers have you used?", first.payload.ConversationID), http.StatusOK, "")
+
+		messages := s.openai.lastChat(t).Messages
+		require.Contains(t, messages[0].Content, "Answer only the current user question")
+		last := messages[len(messages)-1]
+		require.Equal(t, "user", last.Role)
+		require.Equal(t, "Which cloud providers have you used?", last.Content)
+	})
+
+	t.Run("B-03 follow-ups use completed history", func(t *testing.T) {
+		s := newStack(t)
+		s.openai.reply(inScope("I led the payments platform team at Acme."))
+		first := s.ask(t, "What was your last role?", "")
+		requireStatus(t, first, http.StatusOK, "")
+		requireStatus(t, s.ask(t, "How large was that team?", first.payload.ConversationID), http.StatusOK, "")
+
+		messages := s.openai.lastChat(t).Messages
+		require.Len(t, messages, 5)
+		require.Equal(t, "What was your last role?", messages[2].Content)
+		require.Equal(t, "I led the payments platform team at Acme.", messages[3].Content)
+	})
+
+	t.Run("B-04 unavailable information reply", func(t *testing.T) {
+		s := newStack(t)
+		requireStatus(t, s.ask(t, "What is your notice period?", ""), http.StatusOK, "")
+
+		require.Contains(t, s.openai.lastChat(t).Messages[0].Content, `respond exactly: "I don't have that information."`)
+	})
+
+	t.Run("B-05 off-topic questions are rejected", func(t *testing.T) {
+		s := newStack(t)
+		s.openai.reply(outOfScope())
+		resp := s.ask(t, "What is your favorite movie genre?", "")
+
+		requireStatus(t, resp, http.StatusBadRequest, "INVALID_QUESTION")
+		require.Equal(t, "relevance_off_topic", resp.payload.Reason)
+	})
+
+	t.Run("B-06 relevance and answer come from one model call", func(t *testing.T) {
+		s := newStack(t)
+		// A keyword filter would reject the first question and accept the
+		// second; the model's verdict decides instead.
+		s.openai.reply(inScope("I volunteered as an election data engineer."), outOfScope())
+		requireStatus(t, s.ask(t, "Have you built software for an election?", ""), http.StatusOK, "")
+		requireStatus(t, s.ask(t, "Describe your engineering background.", ""), http.StatusBadRequest, "INVALID_QUESTION")
+
+		require.Len(t, s.openai.chatRequests(), 2, "one chat call per question")
+	})
+
+	t.Run("B-07 strict JSON schema output", func(t *testing.T) {
+		s := newStack(t)
+		requireStatus(t, s.ask(t, "What do you work on?", ""), http.StatusOK, "")
+
+		format := s.openai.lastChat(t).ResponseFormat
+		require.Equal(t, "json_schema", format.Type)
+		require.True(t, format.JSONSchema.Strict)
+		var schema struct {
+			AdditionalProperties bool                       `json:"additionalProperties"`
+			Properties           map[string]json.RawMessage `json:"properties"`
+			Required             []string                   `json:"required"`
+		}
+		require.NoError(t, json.Unmarshal(format.JSONSchema.Schema, &schema))
+		require.False(t, schema.AdditionalProperties)
+		require.ElementsMatch(t, []string{"in_scope", "answer"}, schema.Required)
+		require.Len(t, schema.Properties, 2)
+	})
+}
@@ -0,0 +1,106 @@
+package acceptance
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"portfolio-agent/internal/domain"
+	"portfolio-agent/internal/repository"
+)
+
+// TestContextBounds covers "Context Bounds" in spec/acceptance-criteria.md.
+func TestContextBounds(t *testing.T) {
+	// converse asks n numbered questions in one conversation and returns its ID.
+	converse := func(t *testing.T, s *stack, n int) string {
+		t.Helper()
+		conversationID := ""
+		for i := 1; i <= n; i++ {
+			s.openai.reply(inScope(fmt.Sprintf("Answer %d.", i)))
+			resp := s.ask(t, fmt.Sprintf("Question %d?", i), conversationID)
+			requireStatus(t, resp, http.StatusOK, "")
+			conversationID = resp.payload.ConversationID
+		}
+		return conversationID
+	}
+	// history returns the prior turns replayed in the last chat request.
+	history := func(t *testing.T, s *stack) []domain.ChatMessage {
+		t.Helper()
+		messages := s.openai.lastChat(t).Messages
+		return messages[2 : len(messages)-1]
+	}
+
+	t.Run("C-01 history is limited to MAX_CONTEXT_ITEMS", func(t *testing.T) {
+		s := newStack(t, withMaxContextItems(2))
+		conversationID := converse(t, s, 4)
+		requireStatus(t, s.ask(t, "Question 5?", conversationID), http.StatusOK, "")
+
+		require.Len(t, history(t, s), 2*2, "two turns of one user and one assistant message each")
+	})
+
+	t.Run("C-02 the most recent turns are kept", func(t *testing.T) {
+		s := newStack(t, withMaxContextItems(2))
+		conversationID := converse(t, s, 4)
+		requireStatus(t, s.ask(t, "Question 5?", conversationID), http.StatusOK, "")
+
+		h := history(t, s)
+		require.Equal(t, "Question 3?", h[0].Content)
+		require.Equal(t, "Question 4?", h[2].Content)
+	})
+
+	t.Run("C-03 only completed turns are replayed", func(t *testing.T) {
+		s := newStack(t)
+		conversationID := converse(t, s, 1)
+		s.openai.reply(upstreamStatus(http.StatusInternalServerError, `{"error":{"message":"boom"}}`))
+		requireStatus(t, s.ask(t, "Failed question?", conversationID), http.StatusBadGateway, "UPSTREAM_ERROR")
+		s.openai.reply(outOfScope())
+		requireStatus(t, s.ask(t, "Off-topic question?", conversationID), http.StatusBadRequest, "INVALID_QUESTION")
+		requireStatus(t, s.ask(t, "Question 2?", conversationID), http.StatusOK, "")
+
+		require.Equal(t, []domain.ChatMessage{
+			{Role: "user", Content: "Question 1?"},
+			{Role: "assistant", Content: "Answer 1."},
+		}, history(t, s))
+	})
+
+	t.Run("C-04 a turn is one record with question and answer", func(t *testing.T) {
+		s := newStack(t)
+		conversationID := converse(t, s, 1)
+
+		messages := s.messages(conversationID)
+		require.Len(t, messages, 1)
+		require.Equal(t, "Question 1?", stringValue(messages[0]["text"]))
+		require.Equal(t, "Answer 1.", stringValue(messages[0]["answer"]))
+	})
+
+	t.Run("C-05 pending turns are excluded", func(t *testing.T) {
+		s := newStack(t)
+		conversationID := converse(t, s, 1)
+		pending := repository.NewMessage(domain.DefaultTenant, conversationID, "Pending question?")
+		require.NoError(t, s.repo.WriteMessage(context.Background(), pending))
+		requireStatus(t, s.ask(t, "Question 2?", conversationID), http.StatusOK, "")
+
+		for _, m := range history(t, s) {
+			require.NotEqual(t, "Pending question?", m.Content)
+		}
+		require.Len(t, history(t, s), 2)
+	})
+
+	t.Run("C-06 history is chronological", func(t *testing.T) {
+		s := newStack(t)
+		conversationID := converse(t, s, 3)
+		requireStatus(t, s.ask(t, "Question 4?", conversationID), http.StatusOK, "")
+
+		require.Equal(t, []domain.ChatMessage{
+			{Role: "user", Content: "Question 1?"},
+			{Role: "assistant", Content: "Answer 1."},
+			{Role: "user", Content: "Question 2?"},
+			{Role: "assistant", Content: "Answer 2."},
+			{Role: "user", Content: "Question 3?"},
+			{Role: "assistant", Content: "Answer 3."},
+		}, history(t, s))
+	})
+}
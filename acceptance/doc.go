@@ -0,0 +1,9 @@
+// Package acceptance holds the executable acceptance criteria of
+// spec/acceptance-criteria.md. Each test runs the full stack, handler to
+// AskService to OpenAI client and repository, against a scripted OpenAI
+// server, in-memory SSM parameters and an in-memory DynamoDB table.
+//
+// Every criterion is a subtest whose name starts with its ID, so one can be
+// run with e.g. go test ./acceptance -run '/W-04'. cmd/speccheck fails when a
+// criterion has no subtest.
+package acceptance
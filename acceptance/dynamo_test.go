@@ -0,0 +1,305 @@
+package acceptance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+type item = map[string]types.AttributeValue
+
+// fakeDynamo is an in-memory table implementing the calls and the expression
+// forms the repository uses. Unsupported expressions fail loudly so a new
+// query shape is not silently misread.
+type fakeDynamo struct {
+	mu     sync.Mutex
+	items  map[string]item
+	fail   map[string]error // API call name to the error it returns
+	writes []string         // API calls that wrote, in order
+}
+
+func newFakeDynamo() *fakeDynamo {
+	return &fakeDynamo{items: make(map[string]item), fail: make(map[string]error)}
+}
+
+// failOn makes every later call to the named API return err.
+func (f *fakeDynamo) failOn(call string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.fail[call] = err
+}
+
+// partition returns the items of pk whose sort key starts with prefix, in
+// sort key order.
+func (f *fakeDynamo) partition(pk, prefix string) []item {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.query(pk, prefix)
+}
+
+func (f *fakeDynamo) writeLog() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.writes...)
+}
+
+func (f *fakeDynamo) GetItem(_ context.Context, in *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.fail["GetItem"]; err != nil {
+		return nil, err
+	}
+	return &dynamodb.GetItemOutput{Item: f.items[keyOf(in.Key)]}, nil
+}
+
+func (f *fakeDynamo) PutItem(_ context.Context, in *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.fail["PutItem"]; err != nil {
+		return nil, err
+	}
+	key := keyOf(in.Item)
+	ok, err := f.holds(aws.ToString(in.ConditionExpression), key)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, &types.ConditionalCheckFailedException{Message: aws.String("The conditional request failed")}
+	}
+	f.items[key] = in.Item
+	f.writes = append(f.writes, "PutItem")
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (f *fakeDynamo) UpdateItem(_ context.Context, in *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.fail["UpdateItem"]; err != nil {
+		return nil, err
+	}
+	if in.ConditionExpression != nil {
+		return nil, fmt.Errorf("fakeDynamo: UpdateItem conditions are not supported: %s", *in.ConditionExpression)
+	}
+	updated, err := applyUpdate(f.items[keyOf(in.Key)], in.Key, aws.ToString(in.UpdateExpression), in.ExpressionAttributeNames, in.ExpressionAttributeValues)
+	if err != nil {
+		return nil, err
+	}
+	f.items[keyOf(in.Key)] = updated
+	f.writes = append(f.writes, "UpdateItem")
+	return &dynamodb.UpdateItemOutput{}, nil
+}
+
+func (f *fakeDynamo) Query(_ context.Context, in *dynamodb.QueryInput, _ ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.fail["Query"]; err != nil {
+		return nil, err
+	}
+	if in.IndexName != nil || in.FilterExpression != nil || in.ExclusiveStartKey != nil ||
+		aws.ToString(in.KeyConditionExpression) != "PK = :pk AND begins_with(SK, :prefix)" {
+		return nil, errors.New("fakeDynamo: only begins_with queries on the table are supported")
+	}
+	items := f.query(stringValue(in.ExpressionAttributeValues[":pk"]), stringValue(in.ExpressionAttributeValues[":prefix"]))
+	if in.ScanIndexForward != nil && !*in.ScanIndexForward {
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+	}
+	if in.Limit != nil && int(*in.Limit) < len(items) {
+		items = items[:*in.Limit]
+	}
+	return &dynamodb.QueryOutput{Items: items, Count: int32(len(items))}, nil
+}
+
+// TransactWriteItems applies every action or, when a condition fails, none.
+func (f *fakeDynamo) TransactWriteItems(_ context.Context, in *dynamodb.TransactWriteItemsInput, _ ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.fail["TransactWriteItems"]; err != nil {
+		return nil, err
+	}
+
+	staged := make(map[string]item)
+	reasons := make([]types.CancellationReason, len(in.TransactItems))
+	canceled := false
+	for i, action := range in.TransactItems {
+		reasons[i].Code = aws.String("None")
+		var key, cond string
+		switch {
+		case action.Put != nil:
+			key, cond = keyOf(action.Put.Item), aws.ToString(action.Put.ConditionExpression)
+			staged[key] = action.Put.Item
+		case action.Update != nil:
+			if action.Update.ConditionExpression != nil {
+				return nil, errors.New("fakeDynamo: transactional update conditions are not supported")
+			}
+			key = keyOf(action.Update.Key)
+			updated, err := applyUpdate(f.items[key], action.Update.Key, aws.ToString(action.Update.UpdateExpression),
+				action.Update.ExpressionAttributeNames, action.Update.ExpressionAttributeValues)
+			if err != nil {
+				return nil, err
+			}
+			staged[key] = updated
+		case action.ConditionCheck != nil:
+			key, cond = keyOf(action.ConditionCheck.Key), aws.ToString(action.ConditionCheck.ConditionExpression)
+		default:
+			return nil, errors.New("fakeDynamo: unsupported transaction action")
+		}
+		ok, err := f.holds(cond, key)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			reasons[i].Code = aws.String("ConditionalCheckFailed")
+			canceled = true
+		}
+	}
+	if canceled {
+		return nil, &types.TransactionCanceledException{
+			Message:             aws.String("Transaction cancelled"),
+			CancellationReasons: reasons,
+		}
+	}
+	for key, it := range staged {
+		f.items[key] = it
+	}
+	f.writes = append(f.writes, "TransactWriteItems")
+	return &dynamodb.TransactWriteItemsOutput{}, nil
+}
+
+func (f *fakeDynamo) Scan(context.Context, *dynamodb.ScanInput, ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	return nil, errors.New("fakeDynamo: Scan is not supported")
+}
+
+func (f *fakeDynamo) BatchWriteItem(context.Context, *dynamodb.BatchWriteItemInput, ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
+	return nil, errors.New("fakeDynamo: BatchWriteItem is not supported")
+}
+
+func (f *fakeDynamo) query(pk, prefix string) []item {
+	var out []item
+	for _, it := range f.items {
+		if stringValue(it["PK"]) == pk && strings.HasPrefix(stringValue(it["SK"]), prefix) {
+			out = append(out, it)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return stringValue(out[i]["SK"]) < stringValue(out[j]["SK"]) })
+	return out
+}
+
+// holds evaluates the condition expressions the repository writes with.
+func (f *fakeDynamo) holds(cond, key string) (bool, error) {
+	_, exists := f.items[key]
+	switch cond {
+	case "":
+		return true, nil
+	case "attribute_not_exists(PK) AND attribute_not_exists(SK)":
+		return !exists, nil
+	case "attribute_exists(PK)":
+		return exists, nil
+	default:
+		return false, fmt.Errorf("fakeDynamo: unsupported condition %q", cond)
+	}
+}
+
+// applyUpdate applies an expression of the form
+// "SET a = :a, #b = :b ADD c :c, d :d" to a copy of current.
+func applyUpdate(current, key item, expr string, names map[string]string, values map[string]types.AttributeValue) (item, error) {
+	out := make(item, len(current)+len(key))
+	for k, v := range current {
+		out[k] = v
+	}
+	for k, v := range key {
+		out[k] = v
+	}
+	name := func(n string) string {
+		if resolved, ok := names[n]; ok {
+			return resolved
+		}
+		return n
+	}
+	value := func(v string) (types.AttributeValue, error) {
+		av, ok := values[v]
+		if !ok {
+			return nil, fmt.Errorf("fakeDynamo: missing expression value %s", v)
+		}
+		return av, nil
+	}
+
+	set, add := expr, ""
+	if i := strings.Index(expr, "ADD "); i >= 0 {
+		set, add = expr[:i], expr[i+len("ADD "):]
+	}
+	if set = strings.TrimSpace(set); set != "" {
+		clauses, ok := strings.CutPrefix(set, "SET ")
+		if !ok {
+			return nil, fmt.Errorf("fakeDynamo: unsupported update expression %q", expr)
+		}
+		for _, clause := range strings.Split(clauses, ",") {
+			attr, v, ok := strings.Cut(clause, "=")
+			if !ok {
+				return nil, fmt.Errorf("fakeDynamo: unsupported SET clause %q", clause)
+			}
+			av, err := value(strings.TrimSpace(v))
+			if err != nil {
+				return nil, err
+			}
+			out[name(strings.TrimSpace(attr))] = av
+		}
+	}
+	if add = strings.TrimSpace(add); add != "" {
+		for _, clause := range strings.Split(add, ",") {
+			fields := strings.Fields(clause)
+			if len(fields) != 2 {
+				return nil, fmt.Errorf("fakeDynamo: unsupported ADD clause %q", clause)
+			}
+			av, err := value(fields[1])
+			if err != nil {
+				return nil, err
+			}
+			sum, err := addNumbers(out[name(fields[0])], av)
+			if err != nil {
+				return nil, err
+			}
+			out[name(fields[0])] = sum
+		}
+	}
+	return out, nil
+}
+
+func addNumbers(current, delta types.AttributeValue) (types.AttributeValue, error) {
+	d, ok := delta.(*types.AttributeValueMemberN)
+	if !ok {
+		return nil, errors.New("fakeDynamo: ADD supports numbers only")
+	}
+	total, err := strconv.ParseFloat(d.Value, 64)
+	if err != nil {
+		return nil, err
+	}
+	if c, ok := current.(*types.AttributeValueMemberN); ok {
+		v, err := strconv.ParseFloat(c.Value, 64)
+		if err != nil {
+			return nil, err
+		}
+		total += v
+	}
+	return &types.AttributeValueMemberN{Value: strconv.FormatFloat(total, 'f', -1, 64)}, nil
+}
+
+func keyOf(it item) string {
+	return stringValue(it["PK"]) + "\x00" + stringValue(it["SK"])
+}
+
+func stringValue(av types.AttributeValue) string {
+	if s, ok := av.(*types.AttributeValueMemberS); ok {
+		return s.Value
+	}
+	return ""
+}
@@ -0,0 +1,126 @@
+package acceptance
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestErrorMapping covers "Error Mapping" in spec/acceptance-criteria.md.
+func TestErrorMapping(t *testing.T) {
+	t.Run("E-01 OpenAI 429 maps to 429 RATE_LIMITED", func(t *testing.T) {
+		s := newStack(t)
+		s.openai.reply(upstreamStatus(http.StatusTooManyRequests, `{"error":{"code":"rate_limit_exceeded"}}`))
+		resp := s.ask(t, "What do you work on?", "")
+
+		requireStatus(t, resp, http.StatusTooManyRequests, "RATE_LIMITED")
+		require.NotEmpty(t, resp.headers["Retry-After"])
+	})
+
+	t.Run("E-02 other OpenAI failures map to 502 UPSTREAM_ERROR", func(t *testing.T) {
+		for _, status := range []int{http.StatusBadRequest, http.StatusInternalServerError, http.StatusServiceUnavailable} {
+			s := newStack(t)
+			s.openai.reply(upstreamStatus(status, `{"error":{"message":"failure"}}`))
+			requireStatus(t, s.ask(t, "What do you work on?", ""), http.StatusBadGateway, "UPSTREAM_ERROR")
+		}
+	})
+
+	t.Run("E-03 SSM and DynamoDB failures map to 500 INTERNAL_ERROR", func(t *testing.T) {
+		s := newStack(t)
+		s.params.failWith(errors.New("ssm: throttled"))
+		requireStatus(t, s.ask(t, "What do you work on?", ""), http.StatusInternalServerError, "INTERNAL_ERROR")
+
+		s = newStack(t)
+		s.db.failOn("GetItem", errors.New("dynamodb: throttled"))
+		requireStatus(t, s.ask(t, "What do you work on?", "conv-e03"), http.StatusInternalServerError, "INTERNAL_ERROR")
+
+		s = newStack(t)
+		s.db.failOn("Query", errors.New("dynamodb: throttled"))
+		requireStatus(t, s.ask(t, "What do you work on?", "conv-e03"), http.StatusInternalServerError, "INTERNAL_ERROR")
+	})
+
+	t.Run("E-04 classification uses the upstream status code", func(t *testing.T) {
+		// The error bodies name the other status to catch string matching.
+		s := newStack(t)
+		s.openai.reply(upstreamStatus(http.StatusTooManyRequests, `{"error":{"message":"500 internal server error"}}`))
+		requireStatus(t, s.ask(t, "What do you work on?", ""), http.StatusTooManyRequests, "RATE_LIMITED")
+
+		s = newStack(t)
+		s.openai.reply(upstreamStatus(http.StatusServiceUnavailable, `{"error":{"message":"429 rate limit exceeded"}}`))
+		requireStatus(t, s.ask(t, "What do you work on?", ""), http.StatusBadGateway, "UPSTREAM_ERROR")
+	})
+
+	t.Run("E-05 malformed structured payloads map to 502", func(t *testing.T) {
+		for _, content := range []string{
+			`in_scope: true, answer: Go`,
+			`{"in_scope":true,"answer":""}`,
+			`{"in_scope":"yes","answer":"Go"}`,
+		} {
+			s := newStack(t)
+			s.openai.reply(chatReply{content: content})
+			requireStatus(t, s.ask(t, "What do you work on?", ""), http.StatusBadGateway, "UPSTREAM_ERROR")
+		}
+	})
+
+	t.Run("E-06 structured output parsing is strict", func(t *testing.T) {
+		for _, content := range []string{
+			`{"in_scope":true,"answer":"Go","confidence":0.9}`,
+			"```json\n{\"in_scope\":true,\"answer\":\"Go\"}\n```",
+			`Sure! {"in_scope":true,"answer":"Go"}`,
+			`{"in_scope":true,"answer":"Go"} {"in_scope":true,"answer":"Go"}`,
+		} {
+			s := newStack(t)
+			s.openai.reply(chatReply{content: content})
+			requireStatus(t, s.ask(t, "What do you work on?", ""), http.StatusBadGateway, "UPSTREAM_ERROR")
+		}
+	})
+
+	t.Run("E-07 every response carries X-Correlation-Id", func(t *testing.T) {
+		s := newStack(t)
+		s.openai.reply(inScope("Go."), upstreamStatus(http.StatusInternalServerError, `{}`))
+		for _, resp := range []response{
+			s.ask(t, "What do you work on?", ""),
+			s.ask(t, "What do you work on?", ""),
+			s.ask(t, "", ""),
+		} {
+			require.NotEmpty(t, resp.headers["X-Correlation-Id"], resp.body)
+		}
+	})
+
+	t.Run("E-08 a client correlation ID is reused case-insensitively", func(t *testing.T) {
+		s := newStack(t)
+		for _, header := range []string{"X-Correlation-Id", "x-correlation-id", "X-CORRELATION-ID"} {
+			resp := s.askWith(t, context.Background(), "What do you work on?", "", map[string]string{header: "corr-e08"})
+			require.Equal(t, "corr-e08", resp.headers["X-Correlation-Id"])
+		}
+	})
+
+	t.Run("E-09 an exhausted stage deadline maps to 504", func(t *testing.T) {
+		s := newStack(t)
+		// The 500ms response reserve leaves no time for the first stage.
+		ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+		defer cancel()
+		resp := s.askWith(t, ctx, "What do you work on?", "conv-e09", nil)
+
+		requireStatus(t, resp, http.StatusGatewayTimeout, "DEADLINE_EXCEEDED")
+		require.Equal(t, "deadline_exceeded", resp.payload.Reason)
+		require.Empty(t, s.openai.chatRequests())
+		require.Empty(t, s.messages("conv-e09"))
+	})
+
+	t.Run("E-10 a question over MAX_QUESTION_LENGTH maps to 400 question_too_long", func(t *testing.T) {
+		s := newStack(t)
+		resp := s.ask(t, strings.Repeat("é", 151), "")
+		requireStatus(t, resp, http.StatusBadRequest, "INVALID_INPUT")
+		require.Equal(t, "question_too_long", resp.payload.Reason)
+
+		s = newStack(t, withMaxQuestionLen(1000))
+		s.openai.reply(inScope("I work on Go services."))
+		requireStatus(t, s.ask(t, strings.Repeat("a", 500), ""), http.StatusOK, "")
+	})
+}
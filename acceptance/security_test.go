@@ -0,0 +1,96 @@
+package acceptance
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestSecurity covers "Security" in spec/acceptance-criteria.md.
+func TestSecurity(t *testing.T) {
+	t.Run("S-01 the OpenAI API key is never logged or returned", func(t *testing.T) {
+		s := newStack(t)
+		s.openai.reply(
+			inScope("I work on Go services."),
+			upstreamStatus(http.StatusUnauthorized, `{"error":{"message":"Incorrect API key provided: `+apiKey+`"}}`),
+		)
+		bodies := []string{
+			s.ask(t, "What do you work on?", "").body,
+			s.ask(t, "What do you work on?", "").body,
+		}
+		s.db.failOn("GetItem", errors.New("dynamodb: throttled"))
+		bodies = append(bodies, s.ask(t, "What do you work on?", "conv-s01").body)
+
+		require.Contains(t, s.openai.authorizations, "Bearer "+apiKey, "the key was used")
+		for _, body := range bodies {
+			require.NotContains(t, body, apiKey)
+		}
+		require.NotEmpty(t, s.logOutput())
+		require.NotContains(t, s.logOutput(), apiKey)
+	})
+
+	t.Run("S-02 the system prompt is never returned", func(t *testing.T) {
+		s := newStack(t)
+		s.openai.reply(
+			inScope("I work on Go services."),
+			outOfScope(),
+			chatReply{content: "not json"},
+			upstreamStatus(http.StatusTooManyRequests, `{}`),
+		)
+		for range 4 {
+			body := s.ask(t, "What do you work on?", "").body
+			require.NotContains(t, body, "INTERNAL-PROMPT-7731")
+			require.NotContains(t, body, "Behavior Rules")
+			require.NotContains(t, body, "Output Contract")
+		}
+	})
+
+	t.Run("S-03 user messages are never logged", func(t *testing.T) {
+		const question = "Could you walk me through the migration you led at Initech in 2021?"
+		s := newStack(t)
+		s.openai.reply(inScope("Sure."), upstreamStatus(http.StatusInternalServerError, `{"error":{"message":"boom"}}`), outOfScope())
+		requireStatus(t, s.ask(t, question, ""), http.StatusOK, "")
+		requireStatus(t, s.ask(t, question, ""), http.StatusBadGateway, "UPSTREAM_ERROR")
+		requireStatus(t, s.ask(t, question, ""), http.StatusBadRequest, "INVALID_QUESTION")
+
+		require.NotEmpty(t, s.logOutput())
+		require.NotContains(t, s.logOutput(), question)
+		require.NotContains(t, s.logOutput(), "migration you led at Initech")
+	})
+
+	t.Run("S-04 answers are moderated before they are stored or returned", func(t *testing.T) {
+		s := newStack(t)
+		s.openai.flag("you idiot")
+		s.openai.reply(inScope("Only you idiot would ask that."))
+		resp := s.ask(t, "What do you work on?", "")
+
+		requireStatus(t, resp, http.StatusOK, "")
+		require.Equal(t, "I don't have that information.", resp.payload.Answer)
+		require.Contains(t, s.openai.moderationInputs, "Only you idiot would ask that.")
+		messages := s.messages(resp.payload.ConversationID)
+		require.Len(t, messages, 1)
+		require.Equal(t, "I don't have that information.", stringValue(messages[0]["answer"]))
+	})
+
+	t.Run("S-05 contact details and configured patterns are redacted", func(t *testing.T) {
+		const answer = "Write to jane@example.com, call +1 (555) 123-4567 or visit 12 Elm Street."
+
+		s := newStack(t)
+		s.params.set("/config/output_guard", `{"redact":["12 Elm Street"]}`)
+		s.openai.reply(inScope(answer))
+		resp := s.ask(t, "How can I reach you?", "")
+		requireStatus(t, resp, http.StatusOK, "")
+		require.Equal(t, "Write to [redacted], call [redacted] or visit [redacted].", resp.payload.Answer)
+		stored := s.messages(resp.payload.ConversationID)
+		require.Equal(t, resp.payload.Answer, stringValue(stored[0]["answer"]))
+
+		s = newStack(t)
+		s.params.set("/config/output_guard", `{"allow_email":true}`)
+		s.openai.reply(inScope(answer))
+		resp = s.ask(t, "How can I reach you?", "")
+		requireStatus(t, resp, http.StatusOK, "")
+		require.Equal(t, "Write to jane@example.com, call [redacted] or visit 12 Elm Street.", resp.payload.Answer)
+	})
+}
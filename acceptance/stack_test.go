@@ -0,0 +1,395 @@
+package acceptance
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/require"
+
+	"portfolio-agent/handler"
+	"portfolio-agent/internal/domain"
+	"portfolio-agent/internal/integrations/openai"
+	"portfolio-agent/internal/repository"
+	"portfolio-agent/internal/telemetry"
+	"portfolio-agent/internal/usecase"
+)
+
+const (
+	paramPrefix = "/portfolio-agent"
+	apiKey      = "sk-acceptance-4f9c2b7e1d"
+	model       = "gpt-4o-mini"
+	// pinnedPrompt is part of the internal system prompt.
+	pinnedPrompt = "You are Jane Doe's portfolio assistant. INTERNAL-PROMPT-7731."
+	defaultReply = "I build backend services in Go on AWS."
+)
+
+// fakeParams serves the SSM parameters of one portfolio.
+type fakeParams struct {
+	mu   sync.Mutex
+	vals map[string]string
+	err  error
+}
+
+func (p *fakeParams) GetParameter(_ context.Context, name string) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return "", p.err
+	}
+	v, ok := p.vals[name]
+	if !ok {
+		return "", fmt.Errorf("parameter %s not found", name)
+	}
+	return v, nil
+}
+
+func (p *fakeParams) GetParameterVersion(ctx context.Context, name string) (string, int64, error) {
+	v, err := p.GetParameter(ctx, name)
+	return v, 1, err
+}
+
+func (p *fakeParams) set(name, value string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.vals[paramPrefix+name] = value
+}
+
+func (p *fakeParams) failWith(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.err = err
+}
+
+// chatReply is one scripted Chat Completions response.
+type chatReply struct {
+	status  int    // defaults to 200
+	body    string // error body of a non-200 reply
+	content string // assistant message of a 200 reply
+}
+
+func inScope(answer string) chatReply {
+	return chatReply{content: fmt.Sprintf(`{"in_scope":true,"answer":%q}`, answer)}
+}
+
+func outOfScope() chatReply {
+	return chatReply{content: `{"in_scope":false,"answer":""}`}
+}
+
+func upstreamStatus(status int, body string) chatReply {
+	return chatReply{status: status, body: body}
+}
+
+type chatRequest struct {
+	Model          string               `json:"model"`
+	Messages       []domain.ChatMessage `json:"messages"`
+	ResponseFormat struct {
+		Type       string `json:"type"`
+		JSONSchema struct {
+			Name   string          `json:"name"`
+			Strict bool            `json:"strict"`
+			Schema json.RawMessage `json:"schema"`
+		} `json:"json_schema"`
+	} `json:"response_format"`
+}
+
+// fakeOpenAI is a scripted OpenAI API. Chat calls consume the queued replies
+// and answer defaultReply in scope once the queue is empty; moderation flags
+// any input containing one of flagged.
+type fakeOpenAI struct {
+	mu               sync.Mutex
+	replies          []chatReply
+	flagged          []string
+	chats            []chatRequest
+	moderationInputs []string
+	authorizations   []string
+	// onChat runs before a chat reply is written.
+	onChat func()
+}
+
+func (f *fakeOpenAI) reply(replies ...chatReply) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.replies = append(f.replies, replies...)
+}
+
+func (f *fakeOpenAI) flag(substrings ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.flagged = append(f.flagged, substrings...)
+}
+
+func (f *fakeOpenAI) chatRequests() []chatRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]chatRequest(nil), f.chats...)
+}
+
+func (f *fakeOpenAI) lastChat(t *testing.T) chatRequest {
+	t.Helper()
+	chats := f.chatRequests()
+	require.NotEmpty(t, chats, "no chat request was sent")
+	return chats[len(chats)-1]
+}
+
+func (f *fakeOpenAI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	f.authorizations = append(f.authorizations, r.Header.Get("Authorization"))
+	f.mu.Unlock()
+
+	switch r.URL.Path {
+	case "/v1/chat/completions":
+		f.chat(w, r)
+	case "/v1/moderations":
+		f.moderate(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeOpenAI) chat(w http.ResponseWriter, r *http.Request) {
+	var req chatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f.mu.Lock()
+	f.chats = append(f.chats, req)
+	next := inScope(defaultReply)
+	if len(f.replies) > 0 {
+		next, f.replies = f.replies[0], f.replies[1:]
+	}
+	onChat := f.onChat
+	f.mu.Unlock()
+	if onChat != nil {
+		onChat()
+	}
+
+	if next.status != 0 && next.status != http.StatusOK {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(next.status)
+		_, _ = w.Write([]byte(next.body))
+		return
+	}
+	writeJSON(w, map[string]any{
+		"id":     "chatcmpl-acceptance",
+		"object": "chat.completion",
+		"model":  req.Model,
+		"choices": []any{map[string]any{
+			"index":         0,
+			"message":       map[string]any{"role": "assistant", "content": next.content},
+			"finish_reason": "stop",
+		}},
+		"usage": map[string]int{"prompt_tokens": 420, "completion_tokens": 35, "total_tokens": 455},
+	})
+}
+
+func (f *fakeOpenAI) moderate(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Input string `json:"input"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f.mu.Lock()
+	f.moderationInputs = append(f.moderationInputs, req.Input)
+	flagged := false
+	for _, s := range f.flagged {
+		flagged = flagged || strings.Contains(req.Input, s)
+	}
+	f.mu.Unlock()
+
+	score := 0.0001
+	if flagged {
+		score = 0.97
+	}
+	writeJSON(w, map[string]any{
+		"id":    "modr-acceptance",
+		"model": "omni-moderation-latest",
+		"results": []any{map[string]any{
+			"flagged":         flagged,
+			"categories":      map[string]bool{"harassment": flagged, "violence": false},
+			"category_scores": map[string]float64{"harassment": score, "violence": 0.0001},
+		}},
+	})
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// stack is the full service: handler, AskService, OpenAI client and
+// repository, with OpenAI, SSM and DynamoDB replaced by fakes.
+type stack struct {
+	handler *handler.Handler
+	openai  *fakeOpenAI
+	params  *fakeParams
+	db      *fakeDynamo
+	repo    *repository.Client
+	logs    *lockedWriter
+}
+
+type stackConfig struct {
+	maxContextItems int
+	maxQuestionLen  int
+}
+
+type stackOption func(*stackConfig)
+
+func withMaxContextItems(n int) stackOption {
+	return func(c *stackConfig) { c.maxContextItems = n }
+}
+
+func withMaxQuestionLen(n int) stackOption {
+	return func(c *stackConfig) { c.maxQuestionLen = n }
+}
+
+// newStack wires the service the way cmd/main.go does, including the
+// redacting log handler, and captures its logs.
+func newStack(t *testing.T, opts ...stackOption) *stack {
+	t.Helper()
+	cfg := stackConfig{maxContextItems: 20, maxQuestionLen: 300}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	logs := &lockedWriter{}
+	secrets := &telemetry.Secrets{}
+	previous := slog.Default()
+	slog.SetDefault(slog.New(telemetry.NewRedactingHandler(
+		slog.NewJSONHandler(logs, &slog.HandlerOptions{Level: slog.LevelDebug}),
+		telemetry.WithSecrets(secrets),
+	)))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	fake := &fakeOpenAI{}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+
+	params := &fakeParams{vals: map[string]string{
+		paramPrefix + "/open-ai-token":                fmt.Sprintf(`{"token":%q}`, apiKey),
+		paramPrefix + "/resume":                       "Jane Doe. Senior backend engineer, 8 years of Go and AWS.",
+		paramPrefix + "/interests":                    "Distributed systems, climbing.",
+		paramPrefix + "/pinned_prompt":                pinnedPrompt,
+		paramPrefix + "/config/openai_model":          model,
+		paramPrefix + "/config/model_pricing":         `{"gpt-4o-mini":{"prompt_per_1m_usd":0.15,"completion_per_1m_usd":0.6}}`,
+		paramPrefix + "/config/moderation_thresholds": `{}`,
+		paramPrefix + "/config/output_guard":          `{}`,
+	}}
+
+	db := newFakeDynamo()
+	repo, err := repository.New(db, "agent-questions")
+	require.NoError(t, err)
+
+	client, err := openai.NewClient(params, paramPrefix,
+		openai.WithBaseURL(srv.URL+"/v1"),
+		openai.WithKeyObserver(secrets.Add),
+	)
+	require.NoError(t, err)
+
+	ask, err := usecase.NewAskService(params, client, repo, paramPrefix, cfg.maxContextItems, cfg.maxQuestionLen,
+		usecase.WithDeadlineReserve(500*time.Millisecond),
+		usecase.WithSecretObserver(secrets.Add),
+	)
+	require.NoError(t, err)
+	feedback, err := usecase.NewFeedbackService(repo)
+	require.NoError(t, err)
+	h, err := handler.NewHandler(ask, feedback)
+	require.NoError(t, err)
+
+	return &stack{handler: h, openai: fake, params: params, db: db, repo: repo, logs: logs}
+}
+
+// response is a decoded POST /ask response.
+type response struct {
+	status  int
+	headers map[string]string
+	body    string
+	payload struct {
+		Answer         string `json:"answer"`
+		ConversationID string `json:"conversationId"`
+		TurnID         string `json:"turnId"`
+		Error          string `json:"error"`
+		Reason         string `json:"reason"`
+	}
+}
+
+// ask posts a question, continuing conversationID when it is not empty.
+func (s *stack) ask(t *testing.T, question, conversationID string) response {
+	t.Helper()
+	return s.askWith(t, context.Background(), question, conversationID, nil)
+}
+
+func (s *stack) askWith(t *testing.T, ctx context.Context, question, conversationID string, headers map[string]string) response {
+	t.Helper()
+	body := map[string]any{"question": question}
+	if conversationID != "" {
+		body["conversationId"] = conversationID
+	}
+	raw, err := json.Marshal(body)
+	require.NoError(t, err)
+
+	event := events.APIGatewayProxyRequest{
+		HTTPMethod: http.MethodPost,
+		Path:       "/ask",
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(raw),
+	}
+	for k, v := range headers {
+		event.Headers[k] = v
+	}
+	out, err := s.handler.Handle(ctx, event)
+	require.NoError(t, err)
+
+	resp := response{status: out.StatusCode, headers: out.Headers, body: out.Body}
+	require.NoError(t, json.Unmarshal([]byte(out.Body), &resp.payload), out.Body)
+	return resp
+}
+
+// messages returns the stored MSG# records of a conversation, oldest first.
+func (s *stack) messages(conversationID string) []item {
+	return s.db.partition("CONV#"+conversationID, "MSG#")
+}
+
+func (s *stack) turns(t *testing.T, conversationID string) int {
+	t.Helper()
+	n, err := s.repo.GetConversationTurnCount(context.Background(), conversationID)
+	require.NoError(t, err)
+	return n
+}
+
+func (s *stack) logOutput() string {
+	s.logs.mu.Lock()
+	defer s.logs.mu.Unlock()
+	return s.logs.buf.String()
+}
+
+// requireStatus asserts the HTTP status and error code of a response.
+func requireStatus(t *testing.T, resp response, status int, code string) {
+	t.Helper()
+	require.Equal(t, status, resp.status, resp.body)
+	require.Equal(t, code, resp.payload.Error, resp.body)
+}
+
+// lockedWriter serializes writes from concurrent stages to the log buffer.
+type lockedWriter struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.buf.Write(p)
+}
@@ -0,0 +1,91 @@
+package acceptance
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestWriteOrderingAndState covers "Write Ordering & State" in
+// spec/acceptance-criteria.md.
+func TestWriteOrderingAndState(t *testing.T) {
+	t.Run("W-01 the turn is written after the model answers", func(t *testing.T) {
+		s := newStack(t)
+		const conversationID = "conv-w01"
+		var writesDuringChat []string
+		s.openai.onChat = func() { writesDuringChat = s.db.writeLog() }
+		requireStatus(t, s.ask(t, "What do you work on?", conversationID), http.StatusOK, "")
+
+		require.Empty(t, writesDuringChat, "nothing is written before the chat call returns")
+		require.Len(t, s.messages(conversationID), 1)
+	})
+
+	t.Run("W-02 the stored turn includes the answer", func(t *testing.T) {
+		s := newStack(t)
+		s.openai.reply(inScope("I design event-driven systems."))
+		resp := s.ask(t, "What do you design?", "")
+		requireStatus(t, resp, http.StatusOK, "")
+
+		messages := s.messages(resp.payload.ConversationID)
+		require.Len(t, messages, 1)
+		require.Equal(t, resp.payload.Answer, stringValue(messages[0]["answer"]))
+		require.Equal(t, "MSG#"+resp.payload.TurnID, stringValue(messages[0]["SK"]))
+	})
+
+	t.Run("W-03 failed or off-topic calls write no turn", func(t *testing.T) {
+		s := newStack(t)
+		s.openai.reply(
+			upstreamStatus(http.StatusServiceUnavailable, `{"error":{"message":"overloaded"}}`),
+			outOfScope(),
+		)
+		requireStatus(t, s.ask(t, "What do you work on?", "conv-w03"), http.StatusBadGateway, "UPSTREAM_ERROR")
+		requireStatus(t, s.ask(t, "What is the best pizza?", "conv-w03"), http.StatusBadRequest, "INVALID_QUESTION")
+
+		require.Empty(t, s.messages("conv-w03"))
+		require.Zero(t, s.turns(t, "conv-w03"))
+	})
+
+	t.Run("W-04 message and metadata are committed atomically", func(t *testing.T) {
+		s := newStack(t)
+		first := s.ask(t, "What do you work on?", "conv-w04")
+		requireStatus(t, first, http.StatusOK, "")
+		// Apart from the spend counter update, the turn is a single
+		// transaction holding both the message and the metadata.
+		require.Contains(t, s.db.writeLog(), "TransactWriteItems")
+		require.NotContains(t, s.db.writeLog(), "PutItem")
+		require.Len(t, s.messages("conv-w04"), 1)
+		require.Equal(t, 1, s.turns(t, "conv-w04"))
+
+		s.db.failOn("TransactWriteItems", errors.New("transaction conflict"))
+		requireStatus(t, s.ask(t, "Which languages do you use?", "conv-w04"), http.StatusInternalServerError, "INTERNAL_ERROR")
+		require.Len(t, s.messages("conv-w04"), 1)
+		require.Equal(t, 1, s.turns(t, "conv-w04"))
+	})
+
+	t.Run("W-05 turns counts every successful turn", func(t *testing.T) {
+		s := newStack(t, withMaxContextItems(1))
+		for i := 1; i <= 3; i++ {
+			requireStatus(t, s.ask(t, fmt.Sprintf("Question %d?", i), "conv-w05"), http.StatusOK, "")
+		}
+		s.openai.reply(outOfScope())
+		requireStatus(t, s.ask(t, "Off-topic?", "conv-w05"), http.StatusBadRequest, "INVALID_QUESTION")
+
+		require.Equal(t, 3, s.turns(t, "conv-w05"))
+	})
+
+	t.Run("W-06 the 11th turn is rejected", func(t *testing.T) {
+		s := newStack(t)
+		for i := 1; i <= 10; i++ {
+			requireStatus(t, s.ask(t, fmt.Sprintf("Question %d?", i), "conv-w06"), http.StatusOK, "")
+		}
+		chats := len(s.openai.chatRequests())
+
+		requireStatus(t, s.ask(t, "Question 11?", "conv-w06"), http.StatusBadRequest, "INVALID_INPUT")
+		require.Len(t, s.openai.chatRequests(), chats)
+		require.Len(t, s.messages("conv-w06"), 10)
+		require.Equal(t, 10, s.turns(t, "conv-w06"))
+	})
+}
@@ -0,0 +1,367 @@
+// Command admin inspects and manages stored conversations.
+//
+// Usage:
+//
+//	admin [-store dynamodb|local] [-table name] [-endpoint url] [-tenant id] <command> [flags] [args]
+//
+// Commands:
+//
+//	list [-limit n] [-since d]   list conversations, most recent first
+//	transcript <id>              print the messages and feedback of a conversation
+//	delete -yes <id>             delete every item stored for a conversation
+//	reset-turns [-turns n] <id>  overwrite the turn count of a conversation
+//	export [-out file]           write every conversation as one JSON object per line
+//
+// -store selects the backend: dynamodb (the default) uses the caller's AWS
+// credentials; local uses DynamoDB Local at http://localhost:8000 with fixed
+// credentials and region, so no AWS setup is needed. -endpoint overrides the
+// DynamoDB endpoint of either store. -tenant scopes every command to one
+// portfolio owner of a multi-tenant deployment.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	awsdynamodb "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+
+	"portfolio-agent/internal/domain"
+	"portfolio-agent/internal/repository"
+)
+
+// Stores selectable with -store.
+const (
+	storeDynamoDB = "dynamodb"
+	storeLocal    = "local"
+)
+
+// localEndpoint is the default address of DynamoDB Local.
+const localEndpoint = "http://localhost:8000"
+
+// conversationStore is the subset of repository.Client used by the admin commands.
+type conversationStore interface {
+	ListRecentConversations(ctx context.Context, limit int) ([]domain.ConversationMeta, error)
+	ListConversations(ctx context.Context, since, until time.Time, cursor string) (domain.ConversationPage, error)
+	GetTranscript(ctx context.Context, conversationID string) (domain.Transcript, error)
+	DeleteConversation(ctx context.Context, conversationID string) error
+	ResetTurnCount(ctx context.Context, conversationID string, turns int) error
+}
+
+func main() {
+	ctx := context.Background()
+
+	fs := flag.NewFlagSet("admin", flag.ExitOnError)
+	storeName := fs.String("store", storeDynamoDB, "conversation store: dynamodb (AWS) or local (DynamoDB Local)")
+	table := fs.String("table", "agent-questions", "DynamoDB table holding conversation state")
+	endpoint := fs.String("endpoint", "", "DynamoDB endpoint override; defaults to "+localEndpoint+" with -store local")
+	tenant := fs.String("tenant", domain.DefaultTenant, "tenant ID to operate on (default: single-tenant data)")
+	_ = fs.Parse(os.Args[1:])
+	if *tenant != domain.DefaultTenant && !domain.ValidTenantID(*tenant) {
+		fmt.Fprintf(os.Stderr, "admin: invalid tenant ID %q\n", *tenant)
+		os.Exit(2)
+	}
+	ctx = domain.WithTenant(ctx, *tenant)
+
+	loadOpts, baseEndpoint, err := storeConfig(*storeName, *endpoint)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "admin:", err)
+		os.Exit(2)
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, loadOpts...)
+	if err != nil {
+		slog.Error("failed to load AWS config", "err", err)
+		os.Exit(1)
+	}
+	dynamoClient := awsdynamodb.NewFromConfig(cfg, func(o *awsdynamodb.Options) {
+		if baseEndpoint != "" {
+			o.BaseEndpoint = aws.String(baseEndpoint)
+		}
+	})
+	store, err := repository.New(dynamoClient, *table)
+	if err != nil {
+		slog.Error("failed to create state client", "err", err)
+		os.Exit(1)
+	}
+
+	if err := run(ctx, store, fs.Args(), os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "admin:", err)
+		os.Exit(1)
+	}
+}
+
+// storeConfig returns the AWS config options and DynamoDB endpoint of the
+// named store. DynamoDB Local accepts any credentials and region, so the local
+// store sets fixed ones instead of reading the caller's.
+func storeConfig(store, endpoint string) ([]func(*config.LoadOptions) error, string, error) {
+	switch store {
+	case storeDynamoDB:
+		return nil, endpoint, nil
+	case storeLocal:
+		if endpoint == "" {
+			endpoint = localEndpoint
+		}
+		creds := aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "local", SecretAccessKey: "local", Source: "admin -store local"}, nil
+		})
+		return []func(*config.LoadOptions) error{
+			config.WithRegion("us-east-1"),
+			config.WithCredentialsProvider(creds),
+		}, endpoint, nil
+	default:
+		return nil, "", fmt.Errorf("unknown store %q: use %s or %s", store, storeDynamoDB, storeLocal)
+	}
+}
+
+// run executes the command named by args[0] against store.
+func run(ctx context.Context, store conversationStore, args []string, stdout io.Writer) error {
+	if len(args) == 0 {
+		return errors.New("missing command: list, transcript, delete, reset-turns or export")
+	}
+	cmd, args := args[0], args[1:]
+	switch cmd {
+	case "list":
+		return runList(ctx, store, args, stdout)
+	case "transcript":
+		return runTranscript(ctx, store, args, stdout)
+	case "delete":
+		return runDelete(ctx, store, args, stdout)
+	case "reset-turns":
+		return runResetTurns(ctx, store, args, stdout)
+	case "export":
+		return runExport(ctx, store, args, stdout)
+	default:
+		return fmt.Errorf("unknown command %q", cmd)
+	}
+}
+
+func runList(ctx context.Context, store conversationStore, args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	limit := fs.Int("limit", 20, "maximum number of conversations to list (0 for all)")
+	since := fs.Duration("since", 0, "only list conversations active within this window, read from the activity index (e.g. 24h)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var metas []domain.ConversationMeta
+	var err error
+	if *since > 0 {
+		metas, err = listActive(ctx, store, *since, *limit)
+	} else {
+		metas, err = store.ListRecentConversations(ctx, *limit)
+	}
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CONVERSATION\tLAST ACTIVITY\tTURNS\tCOST USD")
+	for _, m := range metas {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", m.ConversationID, m.LastActivity, m.Turns, formatCost(m.Usage.CostUSD))
+	}
+	return w.Flush()
+}
+
+// listActive follows ListConversations pages until limit conversations active
+// within the last window are collected or the pages run out.
+func listActive(ctx context.Context, store conversationStore, window time.Duration, limit int) ([]domain.ConversationMeta, error) {
+	until := time.Now().UTC()
+	since := until.Add(-window)
+	var metas []domain.ConversationMeta
+	cursor := ""
+	for {
+		page, err := store.ListConversations(ctx, since, until, cursor)
+		if err != nil {
+			return nil, err
+		}
+		metas = append(metas, page.Conversations...)
+		if limit > 0 && len(metas) >= limit {
+			return metas[:limit], nil
+		}
+		if page.NextCursor == "" {
+			return metas, nil
+		}
+		cursor = page.NextCursor
+	}
+}
+
+func runTranscript(ctx context.Context, store conversationStore, args []string, stdout io.Writer) error {
+	id, err := singleID("transcript", args)
+	if err != nil {
+		return err
+	}
+	t, err := store.GetTranscript(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	feedback := make(map[string]domain.Feedback, len(t.Feedback))
+	for _, fb := range t.Feedback {
+		feedback[fb.TurnID] = fb
+	}
+
+	fmt.Fprintf(stdout, "conversation %s  turns=%d  last_activity=%s  cost_usd=%s\n",
+		id, t.Meta.Turns, t.Meta.LastActivity, formatCost(t.Meta.Usage.CostUSD))
+	for _, msg := range t.Messages {
+		fmt.Fprintf(stdout, "\n[%s] profile=%s\nQ: %s\nA: %s\n", msg.TurnID, profileLabel(msg.ProfileVersion), msg.Text, msg.Answer)
+		if fb, ok := feedback[msg.TurnID]; ok {
+			fmt.Fprintf(stdout, "feedback: %s %q\n", fb.Rating, fb.Comment)
+		}
+	}
+	return nil
+}
+
+func runDelete(ctx context.Context, store conversationStore, args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("delete", flag.ContinueOnError)
+	yes := fs.Bool("yes", false, "confirm the deletion")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	id, err := singleID("delete", fs.Args())
+	if err != nil {
+		return err
+	}
+	if !*yes {
+		return fmt.Errorf("refusing to delete conversation %s without -yes", id)
+	}
+
+	if err := store.DeleteConversation(ctx, id); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "deleted conversation %s\n", id)
+	return nil
+}
+
+func runResetTurns(ctx context.Context, store conversationStore, args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("reset-turns", flag.ContinueOnError)
+	turns := fs.Int("turns", 0, "turn count to store")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	id, err := singleID("reset-turns", fs.Args())
+	if err != nil {
+		return err
+	}
+
+	if err := store.ResetTurnCount(ctx, id, *turns); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "conversation %s turn count set to %d\n", id, *turns)
+	return nil
+}
+
+func runExport(ctx context.Context, store conversationStore, args []string, stdout io.Writer) (err error) {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	out := fs.String("out", "", "output file (default stdout)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	w := stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+		}()
+		w = f
+	}
+
+	metas, err := store.ListRecentConversations(ctx, 0)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	for _, m := range metas {
+		t, err := store.GetTranscript(ctx, m.ConversationID)
+		if errors.Is(err, domain.ErrConversationNotFound) {
+			continue // expired or deleted since the listing
+		}
+		if err != nil {
+			return err
+		}
+		if err := enc.Encode(newExportRecord(t)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportRecord is the JSONL representation of one conversation.
+type exportRecord struct {
+	ConversationID   string         `json:"conversationId"`
+	LastActivity     string         `json:"lastActivity"`
+	Turns            int            `json:"turns"`
+	PromptTokens     int            `json:"promptTokens"`
+	CompletionTokens int            `json:"completionTokens"`
+	CostUSD          float64        `json:"costUsd"`
+	Messages         []exportTurn   `json:"messages"`
+	Feedback         []exportRating `json:"feedback"`
+}
+
+type exportTurn struct {
+	TurnID         string `json:"turnId"`
+	Question       string `json:"question"`
+	Answer         string `json:"answer"`
+	ProfileVersion string `json:"profileVersion,omitempty"`
+}
+
+type exportRating struct {
+	TurnID    string `json:"turnId"`
+	Rating    string `json:"rating"`
+	Comment   string `json:"comment,omitempty"`
+	CreatedAt string `json:"createdAt"`
+}
+
+func newExportRecord(t domain.Transcript) exportRecord {
+	rec := exportRecord{
+		ConversationID:   t.Meta.ConversationID,
+		LastActivity:     t.Meta.LastActivity,
+		Turns:            t.Meta.Turns,
+		PromptTokens:     t.Meta.Usage.PromptTokens,
+		CompletionTokens: t.Meta.Usage.CompletionTokens,
+		CostUSD:          t.Meta.Usage.CostUSD,
+		Messages:         make([]exportTurn, 0, len(t.Messages)),
+		Feedback:         make([]exportRating, 0, len(t.Feedback)),
+	}
+	for _, msg := range t.Messages {
+		rec.Messages = append(rec.Messages, exportTurn{TurnID: msg.TurnID, Question: msg.Text, Answer: msg.Answer, ProfileVersion: msg.ProfileVersion})
+	}
+	for _, fb := range t.Feedback {
+		rec.Feedback = append(rec.Feedback, exportRating{TurnID: fb.TurnID, Rating: string(fb.Rating), Comment: fb.Comment, CreatedAt: fb.CreatedAt})
+	}
+	return rec
+}
+
+func singleID(cmd string, args []string) (string, error) {
+	if len(args) != 1 || args[0] == "" {
+		return "", fmt.Errorf("%s: expected exactly one conversation id", cmd)
+	}
+	return args[0], nil
+}
+
+// profileLabel renders the profile version of a turn; turns stored before
+// profile versioning have none.
+func profileLabel(version string) string {
+	if version == "" {
+		return "unknown"
+	}
+	return version
+}
+
+func formatCost(usd float64) string {
+	return strconv.FormatFloat(usd, 'f', 6, 64)
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/stretchr/testify/require"
+
+	"portfolio-agent/internal/domain"
+)
+
+type fakeStore struct {
+	metas       []domain.ConversationMeta
+	transcripts map[string]domain.Transcript
+	lastLimit   int
+	deleted     []string
+	resetID     string
+	resetTurns  int
+	pages       []domain.ConversationPage
+	cursors     []string
+}
+
+func (f *fakeStore) ListRecentConversations(_ context.Context, limit int) ([]domain.ConversationMeta, error) {
+	f.lastLimit = limit
+	return f.metas, nil
+}
+
+func (f *fakeStore) ListConversations(_ context.Context, _, _ time.Time, cursor string) (domain.ConversationPage, error) {
+	f.cursors = append(f.cursors, cursor)
+	page := f.pages[0]
+	f.pages = f.pages[1:]
+	return page, nil
+}
+
+func (f *fakeStore) GetTranscript(_ context.Context, id string) (domain.Transcript, error) {
+	t, ok := f.transcripts[id]
+	if !ok {
+		return domain.Transcript{}, domain.ErrConversationNotFound
+	}
+	return t, nil
+}
+
+func (f *fakeStore) DeleteConversation(_ context.Context, id string) error {
+	f.deleted = append(f.deleted, id)
+	return nil
+}
+
+func (f *fakeStore) ResetTurnCount(_ context.Context, id string, turns int) error {
+	f.resetID, f.resetTurns = id, turns
+	return nil
+}
+
+func newFakeStore() *fakeStore {
+	meta := domain.ConversationMeta{ConversationID: "abc", LastActivity: "2026-02-27T12:00:01Z", Turns: 1}
+	return &fakeStore{
+		metas: []domain.ConversationMeta{meta, {ConversationID: "gone"}},
+		transcripts: map[string]domain.Transcript{"abc": {
+			Meta:     meta,
+			Messages: []domain.Message{{TurnID: "2026-02-27T12:00:00Z", Text: "Hi", Answer: "Hello", ProfileVersion: "resume:3,sha256:abc"}},
+			Feedback: []domain.Feedback{{TurnID: "2026-02-27T12:00:00Z", Rating: domain.RatingUp}},
+		}},
+	}
+}
+
+func TestRun_List(t *testing.T) {
+	store := newFakeStore()
+	var out bytes.Buffer
+	require.NoError(t, run(context.Background(), store, []string{"list", "-limit", "5"}, &out))
+	require.Equal(t, 5, store.lastLimit)
+	require.Contains(t, out.String(), "abc")
+	require.Contains(t, out.String(), "2026-02-27T12:00:01Z")
+}
+
+func TestRun_ListSinceFollowsCursors(t *testing.T) {
+	store := newFakeStore()
+	store.pages = []domain.ConversationPage{
+		{Conversations: []domain.ConversationMeta{{ConversationID: "p1"}}, NextCursor: "next"},
+		{Conversations: []domain.ConversationMeta{{ConversationID: "p2"}}},
+	}
+	var out bytes.Buffer
+	require.NoError(t, run(context.Background(), store, []string{"list", "-since", "24h"}, &out))
+	require.Equal(t, []string{"", "next"}, store.cursors)
+	require.Contains(t, out.String(), "p1")
+	require.Contains(t, out.String(), "p2")
+}
+
+func TestRun_Transcript(t *testing.T) {
+	var out bytes.Buffer
+	require.NoError(t, run(context.Background(), newFakeStore(), []string{"transcript", "abc"}, &out))
+	require.Contains(t, out.String(), "Q: Hi")
+	require.Contains(t, out.String(), "A: Hello")
+	require.Contains(t, out.String(), "feedback: up")
+	require.Contains(t, out.String(), "profile=resume:3,sha256:abc")
+}
+
+func TestRun_TranscriptNotFound(t *testing.T) {
+	err := run(context.Background(), newFakeStore(), []string{"transcript", "missing"}, &bytes.Buffer{})
+	require.ErrorIs(t, err, domain.ErrConversationNotFound)
+}
+
+func TestRun_DeleteRequiresConfirmation(t *testing.T) {
+	store := newFakeStore()
+	err := run(context.Background(), store, []string{"delete", "abc"}, &bytes.Buffer{})
+	require.Error(t, err)
+	require.Empty(t, store.deleted)
+
+	require.NoError(t, run(context.Background(), store, []string{"delete", "-yes", "abc"}, &bytes.Buffer{}))
+	require.Equal(t, []string{"abc"}, store.deleted)
+}
+
+func TestRun_ResetTurns(t *testing.T) {
+	store := newFakeStore()
+	require.NoError(t, run(context.Background(), store, []string{"reset-turns", "-turns", "2", "abc"}, &bytes.Buffer{}))
+	require.Equal(t, "abc", store.resetID)
+	require.Equal(t, 2, store.resetTurns)
+}
+
+func TestRun_ExportSkipsVanishedConversations(t *testing.T) {
+	store := newFakeStore()
+	var out bytes.Buffer
+	require.NoError(t, run(context.Background(), store, []string{"export"}, &out))
+	require.Equal(t, 0, store.lastLimit)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 1)
+	var rec exportRecord
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &rec))
+	require.Equal(t, "abc", rec.ConversationID)
+	require.Len(t, rec.Messages, 1)
+	require.Equal(t, "Hello", rec.Messages[0].Answer)
+	require.Equal(t, "resume:3,sha256:abc", rec.Messages[0].ProfileVersion)
+	require.Equal(t, "up", rec.Feedback[0].Rating)
+}
+
+func TestStoreConfig(t *testing.T) {
+	opts, endpoint, err := storeConfig(storeDynamoDB, "")
+	require.NoError(t, err)
+	require.Empty(t, opts, "the caller's AWS config is used")
+	require.Empty(t, endpoint)
+
+	opts, endpoint, err = storeConfig(storeLocal, "")
+	require.NoError(t, err)
+	require.Equal(t, localEndpoint, endpoint)
+	var lo config.LoadOptions
+	for _, opt := range opts {
+		require.NoError(t, opt(&lo))
+	}
+	require.Equal(t, "us-east-1", lo.Region)
+	creds, err := lo.Credentials.Retrieve(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "local", creds.AccessKeyID)
+
+	_, endpoint, err = storeConfig(storeLocal, "http://localhost:9000")
+	require.NoError(t, err)
+	require.Equal(t, "http://localhost:9000", endpoint)
+
+	_, _, err = storeConfig("sqlite", "")
+	require.ErrorContains(t, err, `unknown store "sqlite"`)
+}
+
+func TestRun_UnknownCommand(t *testing.T) {
+	err := run(context.Background(), newFakeStore(), []string{"frobnicate"}, &bytes.Buffer{})
+	require.Error(t, err)
+}
@@ -0,0 +1,66 @@
+// Command fakeopenai serves a local, OpenAI-compatible API for running the
+// Lambda end to end without calling OpenAI.
+//
+// Usage:
+//
+//	fakeopenai [-addr host:port] [-rules file]
+//
+// It implements POST /v1/chat/completions, including json_schema response
+// formats and streaming, and POST /v1/moderations. Responses are driven by a
+// JSON rules file mapping question patterns to in_scope, answer and flagged
+// outputs and to injected faults (error statuses, malformed JSON, latency);
+// see rules.example.json. Without -rules every question gets an in-scope
+// canned answer and nothing is flagged.
+//
+// Point the Lambda at it with OPENAI_BASE_URL=http://localhost:8081/v1. Any
+// bearer token is accepted; rules with "auth": "none", or a rules file with
+// a top-level "auth": "none", also accept requests without one, as sent with
+// OPENAI_AUTH=none.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+)
+
+func main() {
+	fs := flag.NewFlagSet("fakeopenai", flag.ExitOnError)
+	addr := fs.String("addr", "localhost:8081", "address to listen on")
+	rulesPath := fs.String("rules", "", "JSON rules file mapping question patterns to responses and faults")
+	_ = fs.Parse(os.Args[1:])
+
+	log := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	rules, err := loadRules(*rulesPath)
+	if err != nil {
+		log.Error("failed to load rules", "path", *rulesPath, "err", err)
+		os.Exit(1)
+	}
+
+	srv := &http.Server{
+		Addr:              *addr,
+		Handler:           newServer(rules, log).Handler(),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	log.Info("fakeopenai listening", "addr", *addr, "rules", len(rules))
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Error("server failed", "err", err)
+		os.Exit(1)
+	}
+}
+
+// loadRules reads the rules file at path; an empty path yields no rules.
+func loadRules(path string) ([]rule, error) {
+	if path == "" {
+		return nil, nil
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read rules: %w", err)
+	}
+	return parseRules(raw)
+}
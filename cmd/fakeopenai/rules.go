@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// Endpoints a rule can be limited to.
+const (
+	endpointChat        = "chat"
+	endpointModerations = "moderations"
+)
+
+// Auth modes of a rule.
+const (
+	// authBearer requires an Authorization: Bearer header. It is the default.
+	authBearer = "bearer"
+	// authNone also accepts requests without an API key, as sent by the
+	// Lambda with OPENAI_AUTH=none.
+	authNone = "none"
+)
+
+// defaultAnswer is returned for chat requests no rule matches.
+const defaultAnswer = "This is a canned answer from fakeopenai."
+
+// ruleFile is the JSON shape of a rules file. Auth is the auth mode of rules
+// that set none and of requests no rule matches.
+type ruleFile struct {
+	Auth  string `json:"auth,omitempty"`
+	Rules []rule `json:"rules"`
+}
+
+// rule maps inputs matching a pattern to a response. For chat requests the
+// input is the last user message; for moderations it is the moderated text.
+// The first matching rule applies.
+type rule struct {
+	Name  string `json:"name,omitempty"`
+	Match string `json:"match"`
+	// Endpoint limits the rule to "chat" or "moderations"; empty matches both.
+	Endpoint string `json:"endpoint,omitempty"`
+	// Auth is "bearer" or "none"; empty takes the auth of the rules file.
+	Auth string `json:"auth,omitempty"`
+
+	// InScope and Answer fill the scoped answer of chat responses. InScope
+	// defaults to true.
+	InScope *bool  `json:"in_scope,omitempty"`
+	Answer  string `json:"answer,omitempty"`
+	// Content, when set, is returned verbatim as the assistant message,
+	// ignoring response_format, e.g. to simulate a malformed model output.
+	Content *string `json:"content,omitempty"`
+
+	// Flagged lists the moderation categories reported as flagged.
+	Flagged []string `json:"flagged,omitempty"`
+
+	Fault fault `json:"fault,omitempty"`
+
+	re *regexp.Regexp
+}
+
+// fault is injected before or instead of the normal response.
+type fault struct {
+	// Latency delays the response.
+	Latency duration `json:"latency,omitempty"`
+	// Status replaces the response with an OpenAI error of that status.
+	Status int `json:"status,omitempty"`
+	// Malformed replaces the response body with truncated JSON of the
+	// endpoint's response shape.
+	Malformed bool `json:"malformed,omitempty"`
+}
+
+// duration is a time.Duration written as a string such as "1.5s".
+type duration time.Duration
+
+func (d *duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"2s\": %w", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(v)
+	return nil
+}
+
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// parseRules decodes and validates a rules file.
+func parseRules(raw []byte) ([]rule, error) {
+	var f ruleFile
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&f); err != nil {
+		return nil, fmt.Errorf("decode rules: %w", err)
+	}
+	if len(f.Rules) == 0 {
+		return nil, errors.New("rules file has no rules")
+	}
+	if err := validateAuth(f.Auth); err != nil {
+		return nil, err
+	}
+	for i := range f.Rules {
+		r := &f.Rules[i]
+		re, err := regexp.Compile(r.Match)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d (%s): match: %w", i, r.Name, err)
+		}
+		r.re = re
+		switch r.Endpoint {
+		case "", endpointChat, endpointModerations:
+		default:
+			return nil, fmt.Errorf("rule %d (%s): unknown endpoint %q", i, r.Name, r.Endpoint)
+		}
+		if r.Fault.Status != 0 && (r.Fault.Status < 400 || r.Fault.Status > 599) {
+			return nil, fmt.Errorf("rule %d (%s): fault status %d is not an error status", i, r.Name, r.Fault.Status)
+		}
+		if err := validateAuth(r.Auth); err != nil {
+			return nil, fmt.Errorf("rule %d (%s): %w", i, r.Name, err)
+		}
+		if r.Auth == "" {
+			r.Auth = f.Auth
+		}
+	}
+	// Unmatched requests get the default response under the file's auth.
+	if f.Auth == authNone {
+		f.Rules = append(f.Rules, rule{Name: "default", Auth: authNone, re: regexp.MustCompile("")})
+	}
+	return f.Rules, nil
+}
+
+func validateAuth(auth string) error {
+	switch auth {
+	case "", authBearer, authNone:
+		return nil
+	}
+	return fmt.Errorf("unknown auth %q", auth)
+}
+
+// matchRule returns the first rule for endpoint matching input. When none
+// matches it returns the zero rule: an in-scope default answer, not flagged.
+func matchRule(rules []rule, endpoint, input string) rule {
+	for _, r := range rules {
+		if r.Endpoint != "" && r.Endpoint != endpoint {
+			continue
+		}
+		if r.re.MatchString(input) {
+			return r
+		}
+	}
+	return rule{}
+}
+
+// anonymous reports whether the rule accepts requests without an API key.
+func (r rule) anonymous() bool {
+	return r.Auth == authNone
+}
+
+func (r rule) inScope() bool {
+	return r.InScope == nil || *r.InScope
+}
+
+func (r rule) answer() string {
+	if r.Answer == "" {
+		return defaultAnswer
+	}
+	return r.Answer
+}
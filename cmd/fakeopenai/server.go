@@ -0,0 +1,366 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+)
+
+// moderationCategories are the categories of omni-moderation-latest.
+var moderationCategories = []string{
+	"harassment", "harassment/threatening", "hate", "hate/threatening",
+	"illicit", "illicit/violent", "self-harm", "self-harm/instructions",
+	"self-harm/intent", "sexual", "sexual/minors", "violence", "violence/graphic",
+}
+
+const (
+	flaggedScore   = 0.93
+	unflaggedScore = 0.00002
+	// streamChunkRunes is the size of the content deltas of streamed responses.
+	streamChunkRunes = 16
+)
+
+type chatRequest struct {
+	Model    string `json:"model"`
+	Messages []struct {
+		Role    string `json:"role"`
+		Content string `json:"content"`
+	} `json:"messages"`
+	Stream        bool `json:"stream"`
+	StreamOptions *struct {
+		IncludeUsage bool `json:"include_usage"`
+	} `json:"stream_options"`
+	ResponseFormat *struct {
+		Type       string `json:"type"`
+		JSONSchema *struct {
+			Name   string          `json:"name"`
+			Schema json.RawMessage `json:"schema"`
+		} `json:"json_schema"`
+	} `json:"response_format"`
+}
+
+type usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// server answers OpenAI API requests from rules.
+type server struct {
+	rules []rule
+	log   *slog.Logger
+	now   func() time.Time
+	ids   atomic.Int64
+}
+
+func newServer(rules []rule, log *slog.Logger) *server {
+	return &server{rules: rules, log: log, now: time.Now}
+}
+
+// Handler routes the chat completions and moderations endpoints.
+func (s *server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/chat/completions", s.chat)
+	mux.HandleFunc("POST /v1/moderations", s.moderations)
+	return mux
+}
+
+func (s *server) chat(w http.ResponseWriter, r *http.Request) {
+	var req chatRequest
+	if !s.decode(w, r, &req) {
+		return
+	}
+	if req.Model == "" || len(req.Messages) == 0 {
+		writeError(w, http.StatusBadRequest, "model and messages are required")
+		return
+	}
+	input := ""
+	for _, m := range req.Messages {
+		if m.Role == "user" {
+			input = m.Content
+		}
+	}
+
+	rl := matchRule(s.rules, endpointChat, input)
+	if !authorized(w, r, rl) || !s.inject(w, r, endpointChat, rl) {
+		return
+	}
+	content, err := chatContent(req, rl)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	promptChars := 0
+	for _, m := range req.Messages {
+		promptChars += len(m.Content)
+	}
+	u := usage{PromptTokens: tokens(promptChars), CompletionTokens: tokens(len(content))}
+	u.TotalTokens = u.PromptTokens + u.CompletionTokens
+	id := fmt.Sprintf("chatcmpl-fake%d", s.ids.Add(1))
+	s.log.InfoContext(r.Context(), "fakeopenai.chat", "rule", rl.Name, "stream", req.Stream)
+
+	if req.Stream {
+		includeUsage := req.StreamOptions != nil && req.StreamOptions.IncludeUsage
+		s.stream(w, id, req.Model, content, u, includeUsage)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"id":      id,
+		"object":  "chat.completion",
+		"created": s.now().Unix(),
+		"model":   req.Model,
+		"choices": []any{map[string]any{
+			"index":         0,
+			"message":       map[string]any{"role": "assistant", "content": content},
+			"finish_reason": "stop",
+		}},
+		"usage": u,
+	})
+}
+
+// chatContent renders the assistant message for req: the scoped answer as a
+// JSON object when a JSON response format is requested, the answer text
+// otherwise.
+func chatContent(req chatRequest, rl rule) (string, error) {
+	if rl.Content != nil {
+		return *rl.Content, nil
+	}
+	values := map[string]any{"in_scope": rl.inScope(), "answer": rl.answer()}
+	format := req.ResponseFormat
+	if format == nil || format.Type == "" || format.Type == "text" {
+		return rl.answer(), nil
+	}
+	switch format.Type {
+	case "json_object":
+	case "json_schema":
+		if format.JSONSchema == nil {
+			return "", errors.New("response_format.json_schema is required for type json_schema")
+		}
+		var schema struct {
+			Properties map[string]struct {
+				Type string `json:"type"`
+			} `json:"properties"`
+		}
+		if err := json.Unmarshal(format.JSONSchema.Schema, &schema); err != nil {
+			return "", fmt.Errorf("invalid schema for response_format %q: %v", format.JSONSchema.Name, err)
+		}
+		filled := make(map[string]any, len(schema.Properties))
+		for name := range schema.Properties {
+			v, ok := values[name]
+			if !ok {
+				return "", fmt.Errorf("fakeopenai cannot fill property %q of response_format %q", name, format.JSONSchema.Name)
+			}
+			filled[name] = v
+		}
+		values = filled
+	default:
+		return "", fmt.Errorf("unsupported response_format type %q", format.Type)
+	}
+	b, err := json.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// stream writes content as server-sent chat.completion.chunk events.
+func (s *server) stream(w http.ResponseWriter, id, model, content string, u usage, includeUsage bool) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	created := s.now().Unix()
+
+	send := func(delta map[string]any, finish any, u *usage) {
+		chunk := map[string]any{
+			"id":      id,
+			"object":  "chat.completion.chunk",
+			"created": created,
+			"model":   model,
+			"choices": []any{},
+		}
+		if delta != nil {
+			chunk["choices"] = []any{map[string]any{"index": 0, "delta": delta, "finish_reason": finish}}
+		}
+		if u != nil {
+			chunk["usage"] = u
+		}
+		b, _ := json.Marshal(chunk)
+		fmt.Fprintf(w, "data: %s\n\n", b)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	send(map[string]any{"role": "assistant", "content": ""}, nil, nil)
+	for rest := content; rest != ""; {
+		n := 0
+		for i := 0; i < streamChunkRunes && n < len(rest); i++ {
+			_, size := utf8.DecodeRuneInString(rest[n:])
+			n += size
+		}
+		send(map[string]any{"content": rest[:n]}, nil, nil)
+		rest = rest[n:]
+	}
+	send(map[string]any{}, "stop", nil)
+	if includeUsage {
+		send(nil, nil, &u)
+	}
+	fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+func (s *server) moderations(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Input json.RawMessage `json:"input"`
+	}
+	if !s.decode(w, r, &req) {
+		return
+	}
+	var inputs []string
+	var single string
+	if err := json.Unmarshal(req.Input, &single); err == nil {
+		inputs = []string{single}
+	} else if err := json.Unmarshal(req.Input, &inputs); err != nil || len(inputs) == 0 {
+		writeError(w, http.StatusBadRequest, "input must be a string or a non-empty array of strings")
+		return
+	}
+
+	// A fault applies when any input matches a rule injecting one.
+	results := make([]any, 0, len(inputs))
+	for _, input := range inputs {
+		rl := matchRule(s.rules, endpointModerations, input)
+		if !authorized(w, r, rl) || !s.inject(w, r, endpointModerations, rl) {
+			return
+		}
+		results = append(results, moderationResult(rl.Flagged))
+		s.log.InfoContext(r.Context(), "fakeopenai.moderation", "rule", rl.Name, "flagged", len(rl.Flagged) > 0)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"id":      fmt.Sprintf("modr-fake%d", s.ids.Add(1)),
+		"model":   "omni-moderation-latest",
+		"results": results,
+	})
+}
+
+func moderationResult(flagged []string) map[string]any {
+	categories := make(map[string]bool, len(moderationCategories))
+	scores := make(map[string]float64, len(moderationCategories))
+	for _, c := range moderationCategories {
+		categories[c] = false
+		scores[c] = unflaggedScore
+	}
+	for _, c := range flagged {
+		categories[c] = true
+		scores[c] = flaggedScore
+	}
+	return map[string]any{
+		"flagged":         len(flagged) > 0,
+		"categories":      categories,
+		"category_scores": scores,
+	}
+}
+
+// inject applies the faults of rl and reports whether the normal response
+// should still be written.
+func (s *server) inject(w http.ResponseWriter, r *http.Request, endpoint string, rl rule) bool {
+	f := rl.Fault
+	if f.Latency > 0 {
+		if err := sleep(r.Context(), time.Duration(f.Latency)); err != nil {
+			return false
+		}
+	}
+	switch {
+	case f.Status != 0:
+		s.log.InfoContext(r.Context(), "fakeopenai.fault", "endpoint", endpoint, "rule", rl.Name, "status", f.Status)
+		if f.Status == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", "1")
+		}
+		writeError(w, f.Status, fmt.Sprintf("fakeopenai fault injected by rule %q", rl.Name))
+		return false
+	case f.Malformed:
+		s.log.InfoContext(r.Context(), "fakeopenai.fault", "endpoint", endpoint, "rule", rl.Name, "malformed", true)
+		body := `{"id":"fake","object":"chat.completion","choices":[{"index":0,"message":{"role":"assis`
+		if endpoint == endpointModerations {
+			body = `{"id":"modr-fake","model":"omni-moderation-latest","results":[{"flagged":false,"categories":{"harassm`
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(body))
+		return false
+	}
+	return true
+}
+
+// authorized rejects a request without a bearer API key unless rl accepts
+// anonymous requests.
+func authorized(w http.ResponseWriter, r *http.Request, rl rule) bool {
+	if rl.anonymous() || strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+		return true
+	}
+	writeError(w, http.StatusUnauthorized, "missing bearer API key")
+	return false
+}
+
+func (s *server) decode(w http.ResponseWriter, r *http.Request, v any) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return false
+	}
+	return true
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// tokens estimates a token count at four characters per token.
+func tokens(chars int) int {
+	return (chars + 3) / 4
+}
+
+// writeError writes an error in the shape of the OpenAI API.
+func writeError(w http.ResponseWriter, status int, message string) {
+	typ, code := "invalid_request_error", any(nil)
+	switch {
+	case status == http.StatusUnauthorized:
+		code = "invalid_api_key"
+	case status == http.StatusTooManyRequests:
+		typ, code = "requests", "rate_limit_exceeded"
+	case status >= 500:
+		typ = "server_error"
+	}
+	writeJSON(w, status, map[string]any{"error": map[string]any{
+		"message": message,
+		"type":    typ,
+		"param":   nil,
+		"code":    code,
+	}})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+	w.WriteHeader(status)
+	_, _ = w.Write(b)
+}
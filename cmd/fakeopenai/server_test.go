@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"portfolio-agent/internal/domain"
+	"portfolio-agent/internal/integrations/openai"
+)
+
+type staticToken struct{}
+
+func (staticToken) GetParameter(context.Context, string) (string, error) {
+	return `{"token":"sk-fake"}`, nil
+}
+
+func newTestServer(t *testing.T, rules string) *httptest.Server {
+	t.Helper()
+	var parsed []rule
+	if rules != "" {
+		var err error
+		parsed, err = parseRules([]byte(rules))
+		require.NoError(t, err)
+	}
+	srv := httptest.NewServer(newServer(parsed, slog.New(slog.NewTextHandler(io.Discard, nil))).Handler())
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newOpenAIClient(t *testing.T, baseURL string, opts ...openai.Option) *openai.Client {
+	t.Helper()
+	client, err := openai.NewClient(staticToken{}, "/prefix", append([]openai.Option{openai.WithBaseURL(baseURL + "/v1")}, opts...)...)
+	require.NoError(t, err)
+	return client
+}
+
+func ask(question string) []domain.ChatMessage {
+	return []domain.ChatMessage{
+		{Role: "system", Content: "policy"},
+		{Role: "user", Content: question},
+	}
+}
+
+func TestParseRules_ExampleFile(t *testing.T) {
+	raw, err := os.ReadFile("rules.example.json")
+	require.NoError(t, err)
+	rules, err := parseRules(raw)
+	require.NoError(t, err)
+	require.NotEmpty(t, rules)
+}
+
+func TestParseRules_Invalid(t *testing.T) {
+	cases := map[string]string{
+		"no rules":          `{"rules":[]}`,
+		"unknown field":     `{"rules":[{"match":"x","colour":"red"}]}`,
+		"bad pattern":       `{"rules":[{"match":"("}]}`,
+		"unknown endpoint":  `{"rules":[{"match":"x","endpoint":"embeddings"}]}`,
+		"success status":    `{"rules":[{"match":"x","fault":{"status":200}}]}`,
+		"numeric latency":   `{"rules":[{"match":"x","fault":{"latency":5}}]}`,
+		"unknown auth":      `{"rules":[{"match":"x","auth":"basic"}]}`,
+		"unknown file auth": `{"auth":"basic","rules":[{"match":"x"}]}`,
+	}
+	for name, raw := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := parseRules([]byte(raw))
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestChat_ScopedAnswerThroughClient(t *testing.T) {
+	srv := newTestServer(t, `{"rules":[
+		{"match":"(?i)election","in_scope":false},
+		{"match":"(?i)technolog","answer":"Go and Terraform."}
+	]}`)
+	client := newOpenAIClient(t, srv.URL)
+
+	cases := []struct {
+		question string
+		want     map[string]any
+	}{
+		{question: "What technologies do you use?", want: map[string]any{"in_scope": true, "answer": "Go and Terraform."}},
+		{question: "What about the election?", want: map[string]any{"in_scope": false, "answer": defaultAnswer}},
+		{question: "What is your background?", want: map[string]any{"in_scope": true, "answer": defaultAnswer}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.question, func(t *testing.T) {
+			completion, err := client.Chat(context.Background(), "gpt-4o-mini", ask(tc.question))
+			require.NoError(t, err)
+			var got map[string]any
+			require.NoError(t, json.Unmarshal([]byte(completion.Content), &got))
+			require.Equal(t, tc.want, got)
+			require.Positive(t, completion.Usage.PromptTokens)
+			require.Positive(t, completion.Usage.CompletionTokens)
+		})
+	}
+}
+
+func TestChat_ContentOverride(t *testing.T) {
+	srv := newTestServer(t, `{"rules":[{"match":"empty","content":"{\"in_scope\":true,\"answer\":\"\"}"}]}`)
+	completion, err := newOpenAIClient(t, srv.URL).Chat(context.Background(), "gpt-4o-mini", ask("empty answer please"))
+	require.NoError(t, err)
+	require.JSONEq(t, `{"in_scope":true,"answer":""}`, completion.Content)
+}
+
+func TestChat_PlainTextWithoutResponseFormat(t *testing.T) {
+	srv := newTestServer(t, "")
+	resp := post(t, srv.URL+"/v1/chat/completions", `{"model":"m","messages":[{"role":"user","content":"hi"}]}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var body struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	require.Equal(t, defaultAnswer, body.Choices[0].Message.Content)
+}
+
+func TestChat_UnfillableSchemaIsRejected(t *testing.T) {
+	srv := newTestServer(t, "")
+	resp := post(t, srv.URL+"/v1/chat/completions", `{"model":"m","messages":[{"role":"user","content":"hi"}],
+		"response_format":{"type":"json_schema","json_schema":{"name":"other","schema":{"properties":{"score":{"type":"number"}}}}}}`)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestChat_Stream(t *testing.T) {
+	srv := newTestServer(t, `{"rules":[{"match":".","answer":"A streamed answer that spans several chunks."}]}`)
+	resp := post(t, srv.URL+"/v1/chat/completions", `{"model":"m","stream":true,"stream_options":{"include_usage":true},
+		"messages":[{"role":"user","content":"hi"}]}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	var content strings.Builder
+	var finish string
+	var sawUsage, sawDone bool
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		if data == "[DONE]" {
+			sawDone = true
+			continue
+		}
+		var chunk struct {
+			Choices []struct {
+				Delta struct {
+					Content string `json:"content"`
+				} `json:"delta"`
+				FinishReason *string `json:"finish_reason"`
+			} `json:"choices"`
+			Usage *usage `json:"usage"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(data), &chunk))
+		for _, c := range chunk.Choices {
+			content.WriteString(c.Delta.Content)
+			if c.FinishReason != nil {
+				finish = *c.FinishReason
+			}
+		}
+		sawUsage = sawUsage || chunk.Usage != nil
+	}
+	require.NoError(t, scanner.Err())
+	require.Equal(t, "A streamed answer that spans several chunks.", content.String())
+	require.Equal(t, "stop", finish)
+	require.True(t, sawUsage)
+	require.True(t, sawDone)
+}
+
+func TestModerations_FlaggedThroughClient(t *testing.T) {
+	srv := newTestServer(t, `{"rules":[{"endpoint":"moderations","match":"idiot","flagged":["harassment"]}]}`)
+	client := newOpenAIClient(t, srv.URL)
+
+	result, err := client.Moderate(context.Background(), "you idiot")
+	require.NoError(t, err)
+	require.True(t, result.Flagged)
+	require.True(t, result.Categories["harassment"])
+	require.Equal(t, flaggedScore, result.Scores["harassment"])
+	require.False(t, result.Categories["violence"])
+
+	result, err = client.Moderate(context.Background(), "What is your background?")
+	require.NoError(t, err)
+	require.False(t, result.Flagged)
+}
+
+func TestFaults(t *testing.T) {
+	srv := newTestServer(t, `{"rules":[
+		{"endpoint":"chat","match":"429","fault":{"status":429}},
+		{"endpoint":"chat","match":"500","fault":{"status":500}},
+		{"endpoint":"chat","match":"malformed","fault":{"malformed":true}},
+		{"endpoint":"moderations","match":"503","fault":{"status":503}},
+		{"endpoint":"moderations","match":"malformed","fault":{"malformed":true}}
+	]}`)
+	// Each case gets its own client so one fault does not trip the breaker
+	// for the next.
+	t.Run("rate limited", func(t *testing.T) {
+		_, err := newOpenAIClient(t, srv.URL).Chat(context.Background(), "m", ask("chat 429"))
+		var statusErr *openai.HTTPStatusError
+		require.ErrorAs(t, err, &statusErr)
+		require.Equal(t, http.StatusTooManyRequests, statusErr.StatusCode)
+	})
+	t.Run("server error", func(t *testing.T) {
+		_, err := newOpenAIClient(t, srv.URL).Chat(context.Background(), "m", ask("chat 500"))
+		var statusErr *openai.HTTPStatusError
+		require.ErrorAs(t, err, &statusErr)
+		require.Equal(t, http.StatusInternalServerError, statusErr.StatusCode)
+	})
+	t.Run("malformed", func(t *testing.T) {
+		_, err := newOpenAIClient(t, srv.URL).Chat(context.Background(), "m", ask("chat malformed"))
+		require.ErrorContains(t, err, "decode response")
+	})
+	t.Run("moderation malformed", func(t *testing.T) {
+		_, err := newOpenAIClient(t, srv.URL).Moderate(context.Background(), "moderation malformed")
+		require.ErrorContains(t, err, "decode moderation response")
+	})
+	t.Run("moderation unavailable", func(t *testing.T) {
+		_, err := newOpenAIClient(t, srv.URL).Moderate(context.Background(), "moderation 503")
+		var statusErr *openai.HTTPStatusError
+		require.ErrorAs(t, err, &statusErr)
+		require.Equal(t, http.StatusServiceUnavailable, statusErr.StatusCode)
+	})
+}
+
+func TestFaults_LatencyHonoursCancellation(t *testing.T) {
+	srv := newTestServer(t, `{"rules":[{"match":"slow","fault":{"latency":"1m"}}]}`)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := newOpenAIClient(t, srv.URL).Chat(ctx, "m", ask("slow"))
+	require.True(t, errors.Is(err, context.Canceled), "got %v", err)
+}
+
+func TestMissingBearerToken(t *testing.T) {
+	srv := newTestServer(t, "")
+	resp, err := http.Post(srv.URL+"/v1/moderations", "application/json", strings.NewReader(`{"input":"hi"}`))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestAnonymousAuth(t *testing.T) {
+	anonymous := openai.WithCompatibility(openai.Compatibility{AnonymousAuth: true})
+
+	t.Run("per rule", func(t *testing.T) {
+		srv := newTestServer(t, `{"rules":[{"endpoint":"chat","match":"anonymous","auth":"none"}]}`)
+		client := newOpenAIClient(t, srv.URL, anonymous)
+		_, err := client.Chat(context.Background(), "m", ask("anonymous question"))
+		require.NoError(t, err)
+
+		_, err = client.Chat(context.Background(), "m", ask("other question"))
+		var statusErr *openai.HTTPStatusError
+		require.ErrorAs(t, err, &statusErr)
+		require.Equal(t, http.StatusUnauthorized, statusErr.StatusCode)
+	})
+	t.Run("rules file default", func(t *testing.T) {
+		srv := newTestServer(t, `{"auth":"none","rules":[
+			{"endpoint":"chat","match":"technolog","answer":"Go"},
+			{"endpoint":"chat","match":"keyed","auth":"bearer"}
+		]}`)
+		client := newOpenAIClient(t, srv.URL, anonymous)
+		for _, question := range []string{"Which technologies?", "unmatched question"} {
+			_, err := client.Chat(context.Background(), "m", ask(question))
+			require.NoError(t, err, question)
+		}
+		_, err := client.Moderate(context.Background(), "hello")
+		require.NoError(t, err)
+
+		_, err = client.Chat(context.Background(), "m", ask("keyed question"))
+		var statusErr *openai.HTTPStatusError
+		require.ErrorAs(t, err, &statusErr)
+		require.Equal(t, http.StatusUnauthorized, statusErr.StatusCode)
+
+		_, err = newOpenAIClient(t, srv.URL).Chat(context.Background(), "m", ask("keyed question"))
+		require.NoError(t, err, "a bearer key is still accepted")
+	})
+}
+
+func post(t *testing.T, url, body string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer sk-fake")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = resp.Body.Close() })
+	return resp
+}
@@ -2,30 +2,76 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"log/slog"
+	"net/http"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-sdk-go-v2/config"
 	awsdynamodb "github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	awsssm "github.com/aws/aws-sdk-go-v2/service/ssm"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 
 	"portfolio-agent/handler"
 	"portfolio-agent/internal/integrations/openai"
 	"portfolio-agent/internal/integrations/paramstore"
 	"portfolio-agent/internal/repository"
+	"portfolio-agent/internal/telemetry"
 	"portfolio-agent/internal/usecase"
 )
 
+// openaiClientTimeout bounds every OpenAI HTTP call, whatever its context.
+const openaiClientTimeout = 20 * time.Second
+
 func main() {
 	ctx := context.Background()
 
+	// ---- Logging ----
+	// Every logger derives from the default one, so the redacting handler
+	// covers all log calls. Secrets are registered as they are loaded.
+	secrets := &telemetry.Secrets{}
+	slog.SetDefault(slog.New(telemetry.NewRedactingHandler(
+		slog.NewJSONHandler(os.Stdout, nil),
+		telemetry.WithSecrets(secrets),
+	)))
+
 	// ---- Configuration (read only here) ----
 	stateTable := mustEnv("STATE_TABLE")
 	paramPrefix := mustEnv("PARAM_PREFIX")
 	maxContextItems := envInt("MAX_CONTEXT_ITEMS", 20)
 	maxQuestionLen := envInt("MAX_QUESTION_LENGTH", 300)
+	dailySpendCap := envFloat("DAILY_SPEND_CAP_USD", 0)
+	deadlineReserve := time.Duration(envInt("DEADLINE_RESERVE_MS", 500)) * time.Millisecond
+	tracesExporter := envString("OTEL_TRACES_EXPORTER", telemetry.ExporterNone)
+	tenantSource := envString("TENANT_SOURCE", handler.TenantSourceNone)
+	tenantMap := envString("TENANT_MAP", "{}")
+	eventType := envString("API_EVENT_TYPE", handler.EventTypeREST)
+	corsOrigins := envString("CORS_ALLOWED_ORIGINS", "*")
+	openaiBaseURL := envString("OPENAI_BASE_URL", "https://api.openai.com/v1")
+	openaiAuth := envString("OPENAI_AUTH", "ssm")
+	openaiStructuredOutput := envString("OPENAI_STRUCTURED_OUTPUT", openai.StructuredOutputJSONSchema)
+	openaiModeration := envString("OPENAI_MODERATION", openai.ModerationAPI)
+	openaiAzureAPIVersion := os.Getenv("OPENAI_AZURE_API_VERSION")
+	pinnedVersions, err := usecase.ParsePinnedVersions(os.Getenv("PINNED_PARAM_VERSIONS"))
+	if err != nil {
+		slog.Error("failed to parse PINNED_PARAM_VERSIONS", "err", err)
+		os.Exit(1)
+	}
+
+	// ---- Tracing ----
+	tracerProvider, err := telemetry.NewTracerProvider(ctx, telemetry.Config{
+		ServiceName: envString("OTEL_SERVICE_NAME", "portfolio-agent"),
+		Exporter:    tracesExporter,
+	})
+	if err != nil {
+		slog.Error("failed to create tracer provider", "err", err)
+		os.Exit(1)
+	}
 
 	// ---- AWS SDK config ----
 	cfg, err := config.LoadDefaultConfig(ctx)
@@ -47,26 +93,130 @@ func main() {
 		os.Exit(1)
 	}
 
-	openaiClient, err := openai.NewClient(ssmClient, paramPrefix)
+	// Self-hosted OpenAI-compatible servers (Ollama, vLLM) may need
+	// anonymous auth, another structured output mode and local moderation.
+	if openaiAuth != "ssm" && openaiAuth != "none" {
+		slog.Error("OPENAI_AUTH must be ssm or none", "auth", openaiAuth)
+		os.Exit(1)
+	}
+	compat := openai.Compatibility{
+		AnonymousAuth:    openaiAuth == "none",
+		StructuredOutput: openaiStructuredOutput,
+		Moderation:       openaiModeration,
+	}
+	if openaiModeration == openai.ModerationLocal {
+		compat.Moderator, err = openai.ParsePatternModerator(mustEnv("OPENAI_MODERATION_PATTERNS"))
+		if err != nil {
+			slog.Error("failed to parse OPENAI_MODERATION_PATTERNS", "err", err)
+			os.Exit(1)
+		}
+	}
+
+	// OpenAI calls are bounded by the per-stage deadlines of the ask
+	// service. The client timeout is a safety net for calls made without a
+	// deadline; it matches the Lambda timeout so it never cuts a stage short.
+	openaiOpts := []openai.Option{
+		openai.WithBaseURL(openaiBaseURL),
+		openai.WithCompatibility(compat),
+		openai.WithHTTPClient(&http.Client{
+			Timeout:   openaiClientTimeout,
+			Transport: otelhttp.NewTransport(http.DefaultTransport),
+		}),
+		openai.WithKeyObserver(secrets.Add),
+	}
+	// A non-empty api-version switches to Azure OpenAI deployments under
+	// the resource endpoint in OPENAI_BASE_URL.
+	if openaiAzureAPIVersion != "" {
+		deployments, err := openai.ParseAzureDeployments(envString("OPENAI_AZURE_DEPLOYMENTS", "{}"))
+		if err != nil {
+			slog.Error("failed to parse OPENAI_AZURE_DEPLOYMENTS", "err", err)
+			os.Exit(1)
+		}
+		openaiOpts = append(openaiOpts, openai.WithAzure(openai.AzureConfig{
+			APIVersion:  openaiAzureAPIVersion,
+			Deployments: deployments,
+		}))
+	}
+	openaiClient, err := openai.NewClient(ssmClient, paramPrefix, openaiOpts...)
 	if err != nil {
 		slog.Error("failed to create OpenAI client", "err", err)
 		os.Exit(1)
 	}
 
 	// ---- Handler ----
-	askService, err := usecase.NewAskService(ssmClient, openaiClient, stateClient, paramPrefix, maxContextItems, maxQuestionLen)
+	askService, err := usecase.NewAskService(ssmClient, openaiClient, stateClient, paramPrefix, maxContextItems, maxQuestionLen,
+		usecase.WithDailySpendCap(dailySpendCap),
+		usecase.WithDeadlineReserve(deadlineReserve),
+		usecase.WithPinnedParameterVersions(pinnedVersions),
+		usecase.WithSecretObserver(secrets.Add),
+	)
 	if err != nil {
 		slog.Error("failed to create ask service", "err", err)
 		os.Exit(1)
 	}
 
-	h, err := handler.NewHandler(askService)
+	feedbackService, err := usecase.NewFeedbackService(stateClient)
+	if err != nil {
+		slog.Error("failed to create feedback service", "err", err)
+		os.Exit(1)
+	}
+
+	var tenants map[string]string
+	if err := json.Unmarshal([]byte(tenantMap), &tenants); err != nil {
+		slog.Error("failed to parse TENANT_MAP", "err", err)
+		os.Exit(1)
+	}
+	if tenantSource == handler.TenantSourceAPIKey && eventType != handler.EventTypeREST {
+		slog.Error("TENANT_SOURCE api_key requires the REST API event type", "event_type", eventType)
+		os.Exit(1)
+	}
+	tenantResolver, err := handler.NewTenantResolver(tenantSource, tenants)
+	if err != nil {
+		slog.Error("failed to create tenant resolver", "err", err)
+		os.Exit(1)
+	}
+
+	corsPolicy, err := handler.NewCORSPolicy(strings.Split(corsOrigins, ","))
+	if err != nil {
+		slog.Error("failed to parse CORS_ALLOWED_ORIGINS", "err", err)
+		os.Exit(1)
+	}
+
+	h, err := handler.NewHandler(askService, feedbackService,
+		handler.WithTenantResolver(tenantResolver),
+		handler.WithCORSPolicy(corsPolicy),
+	)
 	if err != nil {
 		slog.Error("failed to create handler", "err", err)
 		os.Exit(1)
 	}
 
-	lambda.Start(h.Handle)
+	// The event type matches the trigger in front of the function: the REST
+	// API (payload v1), an HTTP API (payload v2) or a Function URL.
+	switch eventType {
+	case handler.EventTypeREST:
+		lambda.Start(withFlush(tracerProvider, h.Handle))
+	case handler.EventTypeHTTP:
+		lambda.Start(withFlush(tracerProvider, h.HandleHTTP))
+	case handler.EventTypeFunctionURL:
+		lambda.Start(withFlush(tracerProvider, h.HandleFunctionURL))
+	default:
+		slog.Error("unknown API_EVENT_TYPE", "event_type", eventType)
+		os.Exit(1)
+	}
+}
+
+// withFlush flushes buffered spans before completing each invocation, since
+// Lambda may freeze the container once the response is returned.
+func withFlush[E, R any](tp *sdktrace.TracerProvider, fn func(context.Context, E) (R, error)) func(context.Context, E) (R, error) {
+	return func(ctx context.Context, event E) (R, error) {
+		defer func() {
+			if err := tp.ForceFlush(ctx); err != nil {
+				slog.WarnContext(ctx, "failed to flush traces", "err", err)
+			}
+		}()
+		return fn(ctx, event)
+	}
 }
 
 func mustEnv(key string) string {
@@ -78,6 +228,14 @@ func mustEnv(key string) string {
 	return v
 }
 
+func envString(key, def string) string {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	return v
+}
+
 func envInt(key string, def int) int {
 	v := os.Getenv(key)
 	if v == "" {
@@ -89,3 +247,15 @@ func envInt(key string, def int) int {
 	}
 	return n
 }
+
+func envFloat(key string, def float64) float64 {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return def
+	}
+	return f
+}
@@ -0,0 +1,141 @@
+// Command speccheck verifies that every acceptance criterion has a test.
+//
+// Usage:
+//
+//	speccheck [-spec file] [-tests dir]
+//
+// It reads the criterion IDs (B-01, C-02, ...) from the tables of the spec
+// and the subtests of the Go test files in the tests directory, which name
+// the criterion they cover first, e.g. t.Run("W-04 message and metadata are
+// committed atomically", ...). It exits non-zero when a criterion has no test
+// or a test names a criterion the spec does not define.
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	// criterionRow matches the first cell of a criteria table row.
+	criterionRow = regexp.MustCompile(`^\|\s*([A-Z]-\d{2})\s*\|`)
+	// criterionTest matches a subtest named after a criterion.
+	criterionTest = regexp.MustCompile(`t\.Run\("([A-Z]-\d{2})\b`)
+)
+
+func main() {
+	fs := flag.NewFlagSet("speccheck", flag.ExitOnError)
+	spec := fs.String("spec", "spec/acceptance-criteria.md", "acceptance criteria spec")
+	tests := fs.String("tests", "acceptance", "directory of the acceptance tests")
+	_ = fs.Parse(os.Args[1:])
+
+	if err := run(*spec, *tests, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "speccheck: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(specPath, testsDir string, out io.Writer) error {
+	f, err := os.Open(specPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	criteria, err := parseCriteria(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", specPath, err)
+	}
+	tested, err := scanTests(testsDir)
+	if err != nil {
+		return err
+	}
+
+	var problems []string
+	for _, id := range criteria {
+		if len(tested[id]) == 0 {
+			problems = append(problems, fmt.Sprintf("%s has no test in %s", id, testsDir))
+		}
+	}
+	defined := make(map[string]bool, len(criteria))
+	for _, id := range criteria {
+		defined[id] = true
+	}
+	for _, id := range sortedKeys(tested) {
+		if !defined[id] {
+			problems = append(problems, fmt.Sprintf("%s is not defined in %s (tested at %s)", id, specPath, strings.Join(tested[id], ", ")))
+		}
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "\n"))
+	}
+	fmt.Fprintf(out, "%d criteria covered by %s\n", len(criteria), testsDir)
+	return nil
+}
+
+// parseCriteria returns the criterion IDs of the spec tables in order. IDs
+// must be unique.
+func parseCriteria(r io.Reader) ([]string, error) {
+	var ids []string
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		m := criterionRow.FindStringSubmatch(scanner.Text())
+		if m == nil {
+			continue
+		}
+		if seen[m[1]] {
+			return nil, fmt.Errorf("criterion %s is defined twice", m[1])
+		}
+		seen[m[1]] = true
+		ids = append(ids, m[1])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, errors.New("no criteria found")
+	}
+	return ids, nil
+}
+
+// scanTests maps each criterion ID named by a subtest in dir to the
+// file:line locations of those subtests.
+func scanTests(dir string) (map[string][]string, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*_test.go"))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no test files in %s", dir)
+	}
+	tested := make(map[string][]string)
+	for _, path := range paths {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		for i, line := range strings.Split(string(raw), "\n") {
+			for _, m := range criterionTest.FindAllStringSubmatch(line, -1) {
+				tested[m[1]] = append(tested[m[1]], fmt.Sprintf("%s:%d", path, i+1))
+			}
+		}
+	}
+	return tested, nil
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
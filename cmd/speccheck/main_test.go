@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const sampleSpec = `## Behaviour
+| ID   | Criterion          |
+|------|--------------------|
+| B-01 | Answers concisely  |
+| B-02 | Uses history       |
+---
+## Security
+| ID   | Criterion          |
+|------|--------------------|
+| S-01 | Never logs the key |
+`
+
+func writeTests(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600))
+	}
+	return dir
+}
+
+func writeSpec(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "acceptance-criteria.md")
+	require.NoError(t, os.WriteFile(path, []byte(sampleSpec), 0o600))
+	return path
+}
+
+func TestParseCriteria(t *testing.T) {
+	ids, err := parseCriteria(strings.NewReader(sampleSpec))
+	require.NoError(t, err)
+	require.Equal(t, []string{"B-01", "B-02", "S-01"}, ids)
+
+	_, err = parseCriteria(strings.NewReader(sampleSpec + "| B-02 | Duplicate |\n"))
+	require.ErrorContains(t, err, "B-02 is defined twice")
+
+	_, err = parseCriteria(strings.NewReader("# no tables\n"))
+	require.Error(t, err)
+}
+
+func TestRun_AllCovered(t *testing.T) {
+	dir := writeTests(t, map[string]string{
+		"behaviour_test.go": "t.Run(\"B-01 concise\", f)\nt.Run(\"B-02 history\", f)\n",
+		"security_test.go":  "t.Run(\"S-01 key\", f)\n",
+		"helpers.go":        "t.Run(\"X-99 ignored outside test files\", f)\n",
+	})
+	var out bytes.Buffer
+	require.NoError(t, run(writeSpec(t), dir, &out))
+	require.Contains(t, out.String(), "3 criteria covered")
+}
+
+func TestRun_ReportsMissingAndUnknownCriteria(t *testing.T) {
+	dir := writeTests(t, map[string]string{
+		"behaviour_test.go": "t.Run(\"B-01 concise\", f)\nt.Run(\"B-09 removed\", f)\n",
+	})
+	err := run(writeSpec(t), dir, &bytes.Buffer{})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "B-02 has no test")
+	require.Contains(t, err.Error(), "S-01 has no test")
+	require.Contains(t, err.Error(), "B-09 is not defined")
+	require.Contains(t, err.Error(), "behaviour_test.go:2")
+}
+
+func TestRun_RepositoryCriteriaAreCovered(t *testing.T) {
+	root := filepath.Join("..", "..")
+	require.NoError(t, run(filepath.Join(root, "spec", "acceptance-criteria.md"), filepath.Join(root, "acceptance"), &bytes.Buffer{}))
+}
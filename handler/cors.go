@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	corsAllowMethods  = "OPTIONS,POST"
+	corsAllowHeaders  = "Content-Type,X-Correlation-Id,traceparent"
+	corsExposeHeaders = "X-Correlation-Id,traceparent,Retry-After"
+	corsMaxAgeSeconds = 600
+
+	// errorForbidden is returned to browsers calling from a disallowed origin.
+	errorForbidden = "FORBIDDEN"
+)
+
+// CORSPolicy decides which browser origins may call the API.
+type CORSPolicy struct {
+	anyOrigin bool
+	exact     map[string]bool
+	wildcards []wildcardOrigin
+}
+
+// wildcardOrigin matches any subdomain of suffix under scheme, e.g.
+// "https://*.example.com" matches "https://app.example.com".
+type wildcardOrigin struct {
+	scheme string
+	suffix string // ".example.com"
+}
+
+// NewCORSPolicy returns a policy allowing the given origins. Each entry is
+// "*" for any origin, an exact origin such as "https://example.com", or a
+// wildcard subdomain such as "https://*.example.com". Origins match
+// case-insensitively; a wildcard does not match the bare domain.
+func NewCORSPolicy(origins []string) (*CORSPolicy, error) {
+	p := &CORSPolicy{exact: make(map[string]bool)}
+	for _, o := range origins {
+		o = strings.ToLower(strings.TrimRight(strings.TrimSpace(o), "/"))
+		if o == "" {
+			continue
+		}
+		if o == "*" {
+			p.anyOrigin = true
+			continue
+		}
+		scheme, host, ok := strings.Cut(o, "://")
+		if !ok || (scheme != "http" && scheme != "https") || host == "" {
+			return nil, fmt.Errorf("handler: invalid CORS origin %q", o)
+		}
+		if suffix, ok := strings.CutPrefix(host, "*."); ok {
+			if suffix == "" || strings.Contains(suffix, "*") {
+				return nil, fmt.Errorf("handler: invalid CORS origin %q", o)
+			}
+			p.wildcards = append(p.wildcards, wildcardOrigin{scheme: scheme, suffix: "." + suffix})
+			continue
+		}
+		if strings.ContainsAny(host, "*/") {
+			return nil, fmt.Errorf("handler: invalid CORS origin %q", o)
+		}
+		p.exact[o] = true
+	}
+	if !p.anyOrigin && len(p.exact) == 0 && len(p.wildcards) == 0 {
+		return nil, errors.New("handler: CORS origin allowlist must not be empty")
+	}
+	return p, nil
+}
+
+// Allows reports whether a request from origin may be served.
+func (p *CORSPolicy) Allows(origin string) bool {
+	if p == nil || p.anyOrigin {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	if p.exact[origin] {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	for _, w := range p.wildcards {
+		sub, ok := strings.CutSuffix(u.Host, w.suffix)
+		if ok && u.Scheme == w.scheme && sub != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// setHeaders adds the CORS response headers if origin is allowed. The
+// origin is reflected unless any origin is allowed, and Vary: Origin keeps
+// caches from serving one origin's response to another.
+func (p *CORSPolicy) setHeaders(headers map[string]string, origin string) {
+	if origin == "" || !p.Allows(origin) {
+		return
+	}
+	if p == nil || p.anyOrigin {
+		headers["Access-Control-Allow-Origin"] = "*"
+	} else {
+		headers["Access-Control-Allow-Origin"] = origin
+		headers["Vary"] = "Origin"
+	}
+	headers["Access-Control-Expose-Headers"] = corsExposeHeaders
+}
+
+// setPreflightHeaders adds the headers answering an OPTIONS preflight.
+func (p *CORSPolicy) setPreflightHeaders(headers map[string]string, origin string) {
+	p.setHeaders(headers, origin)
+	headers["Access-Control-Allow-Methods"] = corsAllowMethods
+	headers["Access-Control-Allow-Headers"] = corsAllowHeaders
+	headers["Access-Control-Max-Age"] = strconv.Itoa(corsMaxAgeSeconds)
+}
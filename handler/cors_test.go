@@ -0,0 +1,136 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"portfolio-agent/internal/usecase"
+)
+
+func TestNewCORSPolicy_Validates(t *testing.T) {
+	for _, origins := range [][]string{
+		nil,
+		{" "},
+		{"example.com"},
+		{"ftp://example.com"},
+		{"https://*."},
+		{"https://a.*.example.com"},
+		{"https://example.com/path"},
+	} {
+		_, err := NewCORSPolicy(origins)
+		require.Error(t, err, origins)
+	}
+}
+
+func TestCORSPolicy_Allows(t *testing.T) {
+	p, err := NewCORSPolicy([]string{"https://Jane.dev/", "https://*.example.com", "http://localhost:5173"})
+	require.NoError(t, err)
+
+	for _, origin := range []string{"https://jane.dev", "https://app.example.com", "https://a.b.example.com", "http://localhost:5173"} {
+		require.True(t, p.Allows(origin), origin)
+	}
+	for _, origin := range []string{
+		"https://example.com",              // wildcard excludes the bare domain
+		"http://app.example.com",           // scheme must match
+		"https://app.example.com.evil.com", // suffix must end the host
+		"https://evilexample.com",          // label boundary
+		"http://localhost:3000",            // port must match
+		"https://jane.dev.evil.com",
+	} {
+		require.False(t, p.Allows(origin), origin)
+	}
+
+	anyOrigin, err := NewCORSPolicy([]string{"*"})
+	require.NoError(t, err)
+	require.True(t, anyOrigin.Allows("https://anything.test"))
+}
+
+func newCORSHandler(t *testing.T, ask *stubUseCase, origins ...string) *Handler {
+	t.Helper()
+	p, err := NewCORSPolicy(origins)
+	require.NoError(t, err)
+	h, err := NewHandler(ask, &stubFeedback{}, WithCORSPolicy(p))
+	require.NoError(t, err)
+	return h
+}
+
+func TestHandle_AllowedOriginIsReflected(t *testing.T) {
+	ask := &stubUseCase{out: usecase.AskOutput{Answer: "hi", ConversationID: "conv-1"}}
+	h := newCORSHandler(t, ask, "https://*.example.com")
+
+	event := makeEvent(`{"question":"hi"}`)
+	event.Headers["origin"] = "https://app.example.com"
+	resp, err := h.Handle(context.Background(), event)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "https://app.example.com", resp.Headers["Access-Control-Allow-Origin"])
+	require.Equal(t, "Origin", resp.Headers["Vary"])
+	require.Equal(t, corsExposeHeaders, resp.Headers["Access-Control-Expose-Headers"])
+	require.Equal(t, "hi", ask.in.Question)
+}
+
+func TestHandle_DisallowedOriginIsForbidden(t *testing.T) {
+	ask := &stubUseCase{}
+	h := newCORSHandler(t, ask, "https://jane.dev")
+
+	event := makeEvent(`{"question":"hi"}`)
+	event.Headers["Origin"] = "https://evil.test"
+	resp, err := h.Handle(context.Background(), event)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+	require.Equal(t, errorForbidden, parseBody[errorResponse](t, resp.Body).Error)
+	require.NotContains(t, resp.Headers, "Access-Control-Allow-Origin")
+	require.Empty(t, ask.in.Question)
+}
+
+func TestHandle_RequestWithoutOriginIsServed(t *testing.T) {
+	ask := &stubUseCase{out: usecase.AskOutput{Answer: "hi"}}
+	h := newCORSHandler(t, ask, "https://jane.dev")
+
+	resp, err := h.Handle(context.Background(), makeEvent(`{"question":"hi"}`))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NotContains(t, resp.Headers, "Access-Control-Allow-Origin")
+}
+
+func TestHandle_Preflight(t *testing.T) {
+	ask := &stubUseCase{}
+	h := newCORSHandler(t, ask, "https://jane.dev")
+
+	event := makeEvent("")
+	event.HTTPMethod = http.MethodOptions
+	event.Headers["Origin"] = "https://jane.dev"
+	event.Headers["Access-Control-Request-Method"] = http.MethodPost
+	resp, err := h.Handle(context.Background(), event)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	require.Equal(t, "https://jane.dev", resp.Headers["Access-Control-Allow-Origin"])
+	require.Equal(t, corsAllowMethods, resp.Headers["Access-Control-Allow-Methods"])
+	require.Equal(t, corsAllowHeaders, resp.Headers["Access-Control-Allow-Headers"])
+	require.Equal(t, "600", resp.Headers["Access-Control-Max-Age"])
+	require.Equal(t, "Origin", resp.Headers["Vary"])
+	require.NotContains(t, resp.Headers, "Content-Type")
+	require.Empty(t, resp.Body)
+	require.Empty(t, ask.in.Question)
+
+	event.Headers["Origin"] = "https://evil.test"
+	resp, err = h.Handle(context.Background(), event)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+	require.NotContains(t, resp.Headers, "Access-Control-Allow-Origin")
+}
+
+func TestHandle_DefaultPolicyAllowsAnyOrigin(t *testing.T) {
+	h, err := NewHandler(&stubUseCase{}, &stubFeedback{})
+	require.NoError(t, err)
+
+	event := makeEvent(`{"question":"hi"}`)
+	event.Headers["Origin"] = "https://anything.test"
+	resp, err := h.Handle(context.Background(), event)
+	require.NoError(t, err)
+	require.Equal(t, "*", resp.Headers["Access-Control-Allow-Origin"])
+	require.NotContains(t, resp.Headers, "Vary")
+}
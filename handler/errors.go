@@ -0,0 +1,136 @@
+package handler
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// errorResponse is the error envelope returned for every rejected request.
+// Reason, MessageKey and the catalogue in spec/interfaces/error-reasons.json
+// are a stable contract for clients; Message is English fallback text.
+type errorResponse struct {
+	Error             string       `json:"error"`
+	Reason            string       `json:"reason"`
+	Message           string       `json:"message"`
+	MessageKey        string       `json:"messageKey"`
+	RetryAfterSeconds int          `json:"retryAfterSeconds,omitempty"`
+	CorrelationID     string       `json:"correlationId"`
+	Details           []fieldError `json:"details,omitempty"`
+}
+
+// errorReason is a public rejection reason from the catalogue.
+type errorReason struct {
+	Reason  string
+	Message string
+	// RetryAfter is how long the caller should wait before retrying; nil
+	// means retrying the same request will not help.
+	RetryAfter func(now time.Time) time.Duration
+}
+
+// MessageKey is the key clients use to look up a localized message.
+func (r errorReason) MessageKey() string {
+	return "error." + r.Reason
+}
+
+// fixedDelay returns a RetryAfter of d.
+func fixedDelay(d time.Duration) func(time.Time) time.Duration {
+	return func(time.Time) time.Duration { return d }
+}
+
+// untilNextUTCDay is the RetryAfter of the daily spend cap, which resets at
+// midnight UTC.
+func untilNextUTCDay(now time.Time) time.Duration {
+	now = now.UTC()
+	return time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC).Sub(now)
+}
+
+// internalErrorReason is returned for storage, configuration and unexpected
+// failures, whose details are only logged.
+var internalErrorReason = errorReason{Reason: "internal_error", Message: "Something went wrong on our side. Please try again later."}
+
+// errorReasons is the catalogue of public reasons.
+var errorReasons = []errorReason{
+	{Reason: "invalid_body", Message: "The request body is not valid JSON."},
+	{Reason: "invalid_request", Message: "The request could not be read."},
+	{Reason: "schema_violation", Message: "Some fields in the request are missing or invalid."},
+	{Reason: "unsupported_media_type", Message: "Send the request body as application/json."},
+	{Reason: "origin_not_allowed", Message: "This site is not allowed to call the API."},
+	{Reason: "unknown_tenant", Message: "This portfolio does not exist."},
+	{Reason: "unknown_route", Message: "This endpoint does not exist."},
+	{Reason: "empty_question", Message: "Please enter a question."},
+	{Reason: "question_too_long", Message: "Your question is too long. Please shorten it."},
+	{Reason: "conversation_turn_limit", Message: "This conversation has reached its limit. Please start a new one."},
+	{Reason: "moderation_flagged", Message: "Your question can't be answered because it may violate the content policy."},
+	{Reason: "relevance_off_topic", Message: "I can only answer questions about this portfolio."},
+	{Reason: "rate_limited", Message: "Too many requests right now. Please try again shortly.", RetryAfter: fixedDelay(10 * time.Second)},
+	{Reason: "upstream_unavailable", Message: "The assistant is temporarily unavailable. Please try again.", RetryAfter: fixedDelay(5 * time.Second)},
+	{Reason: "deadline_exceeded", Message: "The assistant took too long to answer. Please try again.", RetryAfter: fixedDelay(5 * time.Second)},
+	{Reason: "daily_spend_cap_exceeded", Message: "The assistant has reached its daily limit. Please come back tomorrow.", RetryAfter: untilNextUTCDay},
+	{Reason: "missing_conversation_id", Message: "The conversation ID is missing."},
+	{Reason: "missing_turn_id", Message: "The turn ID is missing."},
+	{Reason: "invalid_rating", Message: "Rate the answer with up or down."},
+	{Reason: "comment_too_long", Message: "Your comment is too long. Please shorten it."},
+	{Reason: "turn_not_found", Message: "The answer you are rating was not found."},
+	internalErrorReason,
+}
+
+// reasonAliases maps logged reasons that are not public to the public reason
+// returned instead, so upstream and storage details are not exposed.
+var reasonAliases = map[string]string{
+	"moderation_rate_limited":        "rate_limited",
+	"openai_rate_limited":            "rate_limited",
+	"answer_moderation_rate_limited": "rate_limited",
+	"moderation_error":               "upstream_unavailable",
+	"openai_error":                   "upstream_unavailable",
+	"openai_malformed_response":      "upstream_unavailable",
+	"answer_moderation_error":        "upstream_unavailable",
+	"upstream_circuit_open":          "upstream_unavailable",
+	"invalid_profile":                internalErrorReason.Reason,
+	"ssm_load_error":                 internalErrorReason.Reason,
+	"dynamodb_turn_count_error":      internalErrorReason.Reason,
+	"dynamodb_spend_read_error":      internalErrorReason.Reason,
+	"dynamodb_history_error":         internalErrorReason.Reason,
+	"dynamodb_spend_write_error":     internalErrorReason.Reason,
+	"dynamodb_write_error":           internalErrorReason.Reason,
+	"dynamodb_feedback_write_error":  internalErrorReason.Reason,
+	"unexpected_error":               internalErrorReason.Reason,
+}
+
+// publicReason returns the catalogue entry for a logged reason. Qualifiers
+// after a colon, such as the moderation category, are dropped. Reasons
+// missing from the catalogue map to internal_error.
+func publicReason(reason string) errorReason {
+	reason, _, _ = strings.Cut(reason, ":")
+	if alias, ok := reasonAliases[reason]; ok {
+		reason = alias
+	}
+	for _, r := range errorReasons {
+		if r.Reason == reason {
+			return r
+		}
+	}
+	return internalErrorReason
+}
+
+// errorJSON builds the error envelope for a rejection and sets Retry-After
+// when retrying can succeed.
+func errorJSON(statusCode int, errorCode, reason, correlationID string, details []fieldError) Response {
+	r := publicReason(reason)
+	body := errorResponse{
+		Error:         errorCode,
+		Reason:        r.Reason,
+		Message:       r.Message,
+		MessageKey:    r.MessageKey(),
+		CorrelationID: correlationID,
+		Details:       details,
+	}
+	if r.RetryAfter != nil {
+		body.RetryAfterSeconds = int((r.RetryAfter(time.Now()) + time.Second - 1) / time.Second)
+	}
+	resp := jsonResponse(statusCode, body, correlationID)
+	if body.RetryAfterSeconds > 0 {
+		resp.Headers["Retry-After"] = strconv.Itoa(body.RetryAfterSeconds)
+	}
+	return resp
+}
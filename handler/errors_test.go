@@ -0,0 +1,172 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"portfolio-agent/internal/usecase"
+)
+
+const errorCataloguePath = "../spec/interfaces/error-reasons.json"
+
+// reasonArgs gives, per function, the index of the reason argument of calls
+// that produce a rejection.
+var reasonArgs = map[string]int{
+	"newError":       1,
+	"rejectResponse": 6,
+	"logRejection":   4,
+	"errorJSON":      2,
+}
+
+// literalReasons collects the string literal reasons passed to rejection
+// calls in the non-test files of dir. A literal concatenated with a qualifier,
+// as in "moderation_flagged:"+category, yields the literal without its colon.
+func literalReasons(t *testing.T, dir string) []string {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	require.NoError(t, err)
+
+	var reasons []string
+	fset := token.NewFileSet()
+	for _, path := range files {
+		if strings.HasSuffix(path, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, path, nil, 0)
+		require.NoError(t, err)
+		ast.Inspect(f, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+			fn, ok := call.Fun.(*ast.Ident)
+			if !ok {
+				return true
+			}
+			i, ok := reasonArgs[fn.Name]
+			if !ok || i >= len(call.Args) {
+				return true
+			}
+			arg := call.Args[i]
+			if bin, ok := arg.(*ast.BinaryExpr); ok {
+				arg = bin.X
+			}
+			if lit, ok := arg.(*ast.BasicLit); ok && lit.Kind == token.STRING {
+				reason, err := strconv.Unquote(lit.Value)
+				require.NoError(t, err)
+				reasons = append(reasons, strings.TrimSuffix(reason, ":"))
+			}
+			return true
+		})
+	}
+	return reasons
+}
+
+func TestErrorReasons_EveryProducedReasonIsCatalogued(t *testing.T) {
+	public := make(map[string]bool, len(errorReasons))
+	for _, r := range errorReasons {
+		public[r.Reason] = true
+	}
+	for alias, target := range reasonAliases {
+		require.True(t, public[target], "alias %s targets unknown reason %s", alias, target)
+	}
+
+	usecaseReasons := literalReasons(t, "../internal/usecase")
+	handlerReasons := literalReasons(t, ".")
+	require.Contains(t, usecaseReasons, "question_too_long")
+	require.Contains(t, usecaseReasons, "moderation_flagged")
+	require.Contains(t, handlerReasons, "unsupported_media_type")
+
+	for _, reason := range append(usecaseReasons, handlerReasons...) {
+		_, aliased := reasonAliases[reason]
+		require.True(t, public[reason] || aliased, "reason %q is not in the error catalogue", reason)
+	}
+}
+
+func TestErrorReasons_MatchPublishedCatalogue(t *testing.T) {
+	type entry struct {
+		Reason     string `json:"reason"`
+		MessageKey string `json:"messageKey"`
+		Message    string `json:"message"`
+		Retryable  bool   `json:"retryable"`
+	}
+	raw, err := os.ReadFile(errorCataloguePath)
+	require.NoError(t, err)
+	var published []entry
+	require.NoError(t, json.Unmarshal(raw, &published))
+
+	want := make([]entry, len(errorReasons))
+	reasons := make([]string, len(errorReasons))
+	for i, r := range errorReasons {
+		want[i] = entry{Reason: r.Reason, MessageKey: r.MessageKey(), Message: r.Message, Retryable: r.RetryAfter != nil}
+		reasons[i] = r.Reason
+	}
+	require.Equal(t, want, published)
+	require.Equal(t, reasons, loadOpenAPISchemas(t)["ErrorResponse"].Properties["reason"].Enum)
+}
+
+func TestPublicReason(t *testing.T) {
+	require.Equal(t, "moderation_flagged", publicReason("moderation_flagged:harassment/threatening").Reason)
+	require.Equal(t, "rate_limited", publicReason("answer_moderation_rate_limited").Reason)
+	require.Equal(t, "internal_error", publicReason("dynamodb_write_error").Reason)
+	require.Equal(t, "internal_error", publicReason("never_heard_of_it").Reason)
+}
+
+func TestUntilNextUTCDay(t *testing.T) {
+	now := time.Date(2026, 3, 1, 23, 59, 30, 0, time.FixedZone("CET", 3600))
+	require.Equal(t, 30*time.Second+time.Hour, untilNextUTCDay(now))
+}
+
+func TestHandle_ErrorEnvelope(t *testing.T) {
+	cases := []struct {
+		name       string
+		err        error
+		reason     string
+		retryAfter bool
+	}{
+		{name: "too long", err: &usecase.Error{Code: usecase.ErrorInvalidInput, Reason: "question_too_long"}, reason: "question_too_long"},
+		{name: "off topic", err: &usecase.Error{Code: usecase.ErrorInvalidQuestion, Reason: "relevance_off_topic"}, reason: "relevance_off_topic"},
+		{name: "moderation", err: &usecase.Error{Code: usecase.ErrorInvalidQuestion, Reason: "moderation_flagged:harassment"}, reason: "moderation_flagged"},
+		{name: "rate limited", err: &usecase.Error{Code: usecase.ErrorRateLimited, Reason: "openai_rate_limited"}, reason: "rate_limited", retryAfter: true},
+		{name: "circuit open", err: &usecase.Error{Code: usecase.ErrorUpstream, Reason: "upstream_circuit_open"}, reason: "upstream_unavailable", retryAfter: true},
+		{name: "deadline", err: &usecase.Error{Code: usecase.ErrorDeadlineExceeded, Reason: "deadline_exceeded"}, reason: "deadline_exceeded", retryAfter: true},
+		{name: "spend cap", err: &usecase.Error{Code: usecase.ErrorSpendCapExceeded, Reason: "daily_spend_cap_exceeded"}, reason: "daily_spend_cap_exceeded", retryAfter: true},
+		{name: "storage", err: &usecase.Error{Code: usecase.ErrorInternal, Reason: "dynamodb_history_error"}, reason: "internal_error"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			h, err := NewHandler(&stubUseCase{err: tc.err}, &stubFeedback{})
+			require.NoError(t, err)
+
+			event := makeEvent(`{"question":"What do you do?"}`)
+			event.Headers["X-Correlation-Id"] = "corr-42"
+			resp, err := h.Handle(context.Background(), event)
+			require.NoError(t, err)
+
+			out := parseBody[errorResponse](t, resp.Body)
+			require.Equal(t, tc.reason, out.Reason)
+			require.Equal(t, "error."+tc.reason, out.MessageKey)
+			require.NotEmpty(t, out.Message)
+			require.Equal(t, "corr-42", out.CorrelationID)
+			if !tc.retryAfter {
+				require.Zero(t, out.RetryAfterSeconds)
+				require.NotContains(t, resp.Headers, "Retry-After")
+				return
+			}
+			require.Positive(t, out.RetryAfterSeconds)
+			require.LessOrEqual(t, out.RetryAfterSeconds, 24*60*60)
+			require.Equal(t, strconv.Itoa(out.RetryAfterSeconds), resp.Headers["Retry-After"])
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"portfolio-agent/internal/telemetry"
+	"portfolio-agent/internal/usecase"
+)
+
+// feedbackResource is the route template of the feedback route.
+const feedbackResource = "/conversations/{id}/turns/{turnId}/feedback"
+
+type feedbackRequest struct {
+	Rating  string `json:"rating"`
+	Comment string `json:"comment"`
+}
+
+type feedbackResponse struct {
+	ConversationID string `json:"conversationId"`
+	TurnID         string `json:"turnId"`
+	Rating         string `json:"rating"`
+}
+
+func (h *Handler) handleFeedback(ctx context.Context, log *slog.Logger, req Request, correlationID string) Response {
+	log.InfoContext(ctx, "feedback.request.count", "method", req.Method, "path", req.Route)
+
+	start := time.Now()
+
+	var body feedbackRequest
+	if resp, ok := decodeBody(ctx, log, opFeedback, correlationID, req, feedbackRequestSchema, &body, start); !ok {
+		return resp
+	}
+	ctx = telemetry.WithRequestSecrets(ctx, body.Comment)
+
+	out, err := h.feedback.Submit(ctx, usecase.FeedbackInput{
+		ConversationID: req.PathParameters["id"],
+		TurnID:         req.PathParameters["turnId"],
+		Rating:         body.Rating,
+		Comment:        body.Comment,
+	})
+	if err != nil {
+		return rejectForUseCaseError(ctx, log, opFeedback, correlationID, err, start)
+	}
+
+	log.InfoContext(ctx, "feedback.recorded",
+		"event", "feedback.recorded",
+		"conversation_id", out.ConversationID,
+		"turn_id", out.TurnID,
+		"rating", out.Rating,
+		"latency_ms", time.Since(start).Milliseconds(),
+	)
+
+	return jsonResponse(http.StatusOK, feedbackResponse{
+		ConversationID: out.ConversationID,
+		TurnID:         out.TurnID,
+		Rating:         string(out.Rating),
+	}, correlationID)
+}
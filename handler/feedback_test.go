@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/require"
+
+	"portfolio-agent/internal/domain"
+	"portfolio-agent/internal/usecase"
+)
+
+type stubFeedback struct {
+	out    usecase.FeedbackOutput
+	err    error
+	in     usecase.FeedbackInput
+	tenant string
+}
+
+func (s *stubFeedback) Submit(ctx context.Context, in usecase.FeedbackInput) (usecase.FeedbackOutput, error) {
+	s.in = in
+	s.tenant = domain.TenantFromContext(ctx)
+	return s.out, s.err
+}
+
+func makeFeedbackEvent(body string) events.APIGatewayProxyRequest {
+	return events.APIGatewayProxyRequest{
+		HTTPMethod:     http.MethodPost,
+		Resource:       feedbackResource,
+		Path:           "/conversations/conv-1/turns/2026-02-27T12:00:00Z/feedback",
+		PathParameters: map[string]string{"id": "conv-1", "turnId": "2026-02-27T12:00:00Z"},
+		Headers:        map[string]string{"Content-Type": "application/json"},
+		Body:           body,
+	}
+}
+
+func TestHandleFeedback_HappyPath(t *testing.T) {
+	ask := &stubUseCase{}
+	fb := &stubFeedback{out: usecase.FeedbackOutput{ConversationID: "conv-1", TurnID: "2026-02-27T12:00:00Z", Rating: domain.RatingUp}}
+	h, err := NewHandler(ask, fb)
+	require.NoError(t, err)
+
+	resp, err := h.Handle(context.Background(), makeFeedbackEvent(`{"rating":"up","comment":"Great answer"}`))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, usecase.FeedbackInput{
+		ConversationID: "conv-1",
+		TurnID:         "2026-02-27T12:00:00Z",
+		Rating:         "up",
+		Comment:        "Great answer",
+	}, fb.in)
+	require.Equal(t, usecase.AskInput{}, ask.in, "ask use case must not be invoked")
+
+	out := parseBody[feedbackResponse](t, resp.Body)
+	require.Equal(t, feedbackResponse{ConversationID: "conv-1", TurnID: "2026-02-27T12:00:00Z", Rating: "up"}, out)
+	require.NotEmpty(t, resp.Headers["X-Correlation-Id"])
+}
+
+func TestHandleFeedback_InvalidBody(t *testing.T) {
+	h, err := NewHandler(&stubUseCase{}, &stubFeedback{})
+	require.NoError(t, err)
+
+	resp, err := h.Handle(context.Background(), makeFeedbackEvent(`not-json`))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	require.Equal(t, string(usecase.ErrorInvalidInput), parseBody[errorResponse](t, resp.Body).Error)
+}
+
+func TestHandleFeedback_MapsUseCaseErrors(t *testing.T) {
+	cases := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+	}{
+		{name: "invalid rating", err: &usecase.Error{Code: usecase.ErrorInvalidInput, Reason: "invalid_rating"}, status: http.StatusBadRequest, code: string(usecase.ErrorInvalidInput)},
+		{name: "turn not found", err: &usecase.Error{Code: usecase.ErrorNotFound, Reason: "turn_not_found"}, status: http.StatusNotFound, code: string(usecase.ErrorNotFound)},
+		{name: "internal", err: &usecase.Error{Code: usecase.ErrorInternal, Reason: "dynamodb_feedback_write_error"}, status: http.StatusInternalServerError, code: string(usecase.ErrorInternal)},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			h, err := NewHandler(&stubUseCase{}, &stubFeedback{err: tc.err})
+			require.NoError(t, err)
+
+			resp, err := h.Handle(context.Background(), makeFeedbackEvent(`{"rating":"up"}`))
+			require.NoError(t, err)
+			require.Equal(t, tc.status, resp.StatusCode)
+			require.Equal(t, tc.code, parseBody[errorResponse](t, resp.Body).Error)
+		})
+	}
+}
@@ -9,18 +9,57 @@ import (
 	"strings"
 	"time"
 
-	"github.com/aws/aws-lambda-go/events"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 
+	"portfolio-agent/internal/domain"
+	"portfolio-agent/internal/telemetry"
 	"portfolio-agent/internal/usecase"
 )
 
+const (
+	tracerScope = "portfolio-agent/handler"
+
+	opAsk      = "ask"
+	opFeedback = "feedback"
+)
+
 type AskUseCase interface {
 	Ask(ctx context.Context, in usecase.AskInput) (usecase.AskOutput, error)
 }
 
+type FeedbackUseCase interface {
+	Submit(ctx context.Context, in usecase.FeedbackInput) (usecase.FeedbackOutput, error)
+}
+
 type Handler struct {
-	ask AskUseCase
+	ask      AskUseCase
+	feedback FeedbackUseCase
+	tenants  TenantResolver
+	cors     *CORSPolicy
+}
+
+// Option configures optional Handler behaviour.
+type Option func(*Handler)
+
+// WithTenantResolver scopes every request to the tenant resolved by r.
+// Requests that cannot be resolved are rejected with 404 NOT_FOUND. A nil r
+// keeps single-tenant behaviour.
+func WithTenantResolver(r TenantResolver) Option {
+	return func(h *Handler) {
+		h.tenants = r
+	}
+}
+
+// WithCORSPolicy restricts browser callers to the origins allowed by p.
+// Requests from other origins are rejected with 403 FORBIDDEN. A nil p
+// allows any origin.
+func WithCORSPolicy(p *CORSPolicy) Option {
+	return func(h *Handler) {
+		h.cors = p
+	}
 }
 
 type askRequest struct {
@@ -31,77 +70,191 @@ type askRequest struct {
 type askResponse struct {
 	Answer         string `json:"answer"`
 	ConversationID string `json:"conversationId"`
+	TurnID         string `json:"turnId"`
 }
 
-type errorResponse struct {
-	Error string `json:"error"`
-}
-
-func NewHandler(askUseCase AskUseCase) (*Handler, error) {
+func NewHandler(askUseCase AskUseCase, feedbackUseCase FeedbackUseCase, opts ...Option) (*Handler, error) {
 	if askUseCase == nil {
 		return nil, errors.New("handler: ask use case must not be nil")
 	}
-	return &Handler{ask: askUseCase}, nil
+	if feedbackUseCase == nil {
+		return nil, errors.New("handler: feedback use case must not be nil")
+	}
+	h := &Handler{ask: askUseCase, feedback: feedbackUseCase}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h, nil
 }
 
-func (h *Handler) Handle(ctx context.Context, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
-	correlationID := headerValue(event.Headers, "X-Correlation-Id")
+// Serve handles a transport-neutral request. The event adapters in
+// request.go translate each Lambda trigger to and from it.
+func (h *Handler) Serve(ctx context.Context, req Request) Response {
+	correlationID := headerValue(req.Headers, "X-Correlation-Id")
 	if correlationID == "" {
 		correlationID = uuid.NewString()
 	}
-	requestID := event.RequestContext.RequestID
 
-	log := slog.With("correlation_id", correlationID, "request_id", requestID)
-	log.InfoContext(ctx, "ask.request.count", "method", event.HTTPMethod, "path", event.Path)
+	ctx = telemetry.Propagator.Extract(ctx, headerCarrier(req.Headers))
+	ctx, span := telemetry.StartSpan(ctx, tracerScope, "handler.Handle",
+		attribute.String("http.request.method", req.Method),
+		attribute.String("http.route", route(req)),
+		attribute.String("correlation_id", correlationID),
+	)
+	defer span.End()
+
+	resp := h.handle(ctx, req, correlationID)
+	h.cors.setHeaders(resp.Headers, headerValue(req.Headers, "Origin"))
+
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	if resp.StatusCode >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(resp.StatusCode))
+	}
+	telemetry.Propagator.Inject(ctx, headerCarrier(resp.Headers))
+	return resp
+}
+
+func (h *Handler) handle(ctx context.Context, req Request, correlationID string) Response {
+	log := slog.With("correlation_id", correlationID, "request_id", req.RequestID)
+
+	// Function URLs and the HTTP API $default route carry no route template.
+	if req.Route == "" {
+		template, params, ok := matchRoute(req.Path)
+		if !ok {
+			return rejectResponse(ctx, log, opAsk, correlationID, http.StatusNotFound, string(usecase.ErrorNotFound), "unknown_route", time.Now())
+		}
+		req.Route, req.PathParameters = template, params
+	}
+	// Path-based tenancy mounts the same routes below a {tenant} segment.
+	isFeedback := strings.HasSuffix(req.Route, feedbackResource)
+	op := opAsk
+	if isFeedback {
+		op = opFeedback
+	}
+
+	// Requests without an Origin header do not come from a browser and are
+	// not subject to CORS.
+	origin := headerValue(req.Headers, "Origin")
+	if origin != "" && !h.cors.Allows(origin) {
+		log = log.With("origin", origin)
+		return rejectResponse(ctx, log, op, correlationID, http.StatusForbidden, errorForbidden, "origin_not_allowed", time.Now())
+	}
+	if req.Method == http.MethodOptions {
+		resp := Response{StatusCode: http.StatusNoContent, Headers: baseHeaders(correlationID)}
+		delete(resp.Headers, "Content-Type")
+		h.cors.setPreflightHeaders(resp.Headers, origin)
+		return resp
+	}
+
+	if h.tenants != nil {
+		tenantID, err := h.tenants.ResolveTenant(req)
+		if err != nil {
+			return rejectResponse(ctx, log, op, correlationID, http.StatusNotFound, string(usecase.ErrorNotFound), "unknown_tenant", time.Now())
+		}
+		ctx = domain.WithTenant(ctx, tenantID)
+		log = log.With("tenant", tenantID)
+		trace.SpanFromContext(ctx).SetAttributes(attribute.String("tenant.id", tenantID))
+	}
+
+	if isFeedback {
+		return h.handleFeedback(ctx, log, req, correlationID)
+	}
+	return h.handleAsk(ctx, log, req, correlationID)
+}
+
+func (h *Handler) handleAsk(ctx context.Context, log *slog.Logger, req Request, correlationID string) Response {
+	log.InfoContext(ctx, "ask.request.count", "method", req.Method, "path", req.Path)
 
 	start := time.Now()
 
-	var req askRequest
-	if err := json.Unmarshal([]byte(event.Body), &req); err != nil {
-		return rejectResponse(ctx, log, correlationID, http.StatusBadRequest, string(usecase.ErrorInvalidInput), "invalid_body", start), nil
+	var body askRequest
+	if resp, ok := decodeBody(ctx, log, opAsk, correlationID, req, askRequestSchema, &body, start); !ok {
+		return resp
 	}
+	ctx = telemetry.WithRequestSecrets(ctx, body.Question)
 
 	out, err := h.ask.Ask(ctx, usecase.AskInput{
-		Question:       req.Question,
-		ConversationID: req.ConversationID,
+		Question:       body.Question,
+		ConversationID: body.ConversationID,
 	})
 	if err != nil {
-		return rejectForUseCaseError(ctx, log, correlationID, err, start), nil
+		return rejectForUseCaseError(ctx, log, opAsk, correlationID, err, start)
 	}
 
 	latencyMs := time.Since(start).Milliseconds()
-	log.InfoContext(ctx, "ask.invoked", "event", "ask.invoked", "conversation_id", out.ConversationID, "latency_ms", latencyMs)
+	log.InfoContext(ctx, "ask.invoked",
+		"event", "ask.invoked",
+		"conversation_id", out.ConversationID,
+		"latency_ms", latencyMs,
+		"model", out.Model,
+		"profile_version", out.ProfileVersion,
+		"answer_guard", out.AnswerGuard,
+		"prompt_tokens", out.Usage.PromptTokens,
+		"completion_tokens", out.Usage.CompletionTokens,
+		"cost_usd", out.Usage.CostUSD,
+	)
 	log.InfoContext(ctx, "ask.request.latency", "latency_ms", latencyMs)
 
 	return jsonResponse(http.StatusOK, askResponse{
 		Answer:         out.Answer,
 		ConversationID: out.ConversationID,
-	}, correlationID), nil
+		TurnID:         out.TurnID,
+	}, correlationID)
 }
 
-func rejectForUseCaseError(ctx context.Context, log *slog.Logger, correlationID string, err error, start time.Time) events.APIGatewayProxyResponse {
+func rejectForUseCaseError(ctx context.Context, log *slog.Logger, op, correlationID string, err error, start time.Time) Response {
 	var askErr *usecase.Error
 	if errors.As(err, &askErr) {
+		// The cause and diagnostics are for operators only; the redacting log
+		// handler installed in main scrubs secrets and truncates upstream bodies.
+		if askErr.Err != nil {
+			log = log.With("err", askErr.Err)
+		}
+		if !askErr.Diagnostics.IsZero() {
+			log = log.With("diagnostics", askErr.Diagnostics)
+		}
 		switch askErr.Code {
 		case usecase.ErrorInvalidInput:
-			return rejectResponse(ctx, log, correlationID, http.StatusBadRequest, string(askErr.Code), askErr.Reason, start)
+			return rejectResponse(ctx, log, op, correlationID, http.StatusBadRequest, string(askErr.Code), askErr.Reason, start)
 		case usecase.ErrorInvalidQuestion:
-			return rejectResponse(ctx, log, correlationID, http.StatusBadRequest, string(askErr.Code), askErr.Reason, start)
+			return rejectResponse(ctx, log, op, correlationID, http.StatusBadRequest, string(askErr.Code), askErr.Reason, start)
+		case usecase.ErrorNotFound:
+			return rejectResponse(ctx, log, op, correlationID, http.StatusNotFound, string(askErr.Code), askErr.Reason, start)
 		case usecase.ErrorRateLimited:
-			return rejectResponse(ctx, log, correlationID, http.StatusTooManyRequests, string(askErr.Code), askErr.Reason, start)
+			return rejectResponse(ctx, log, op, correlationID, http.StatusTooManyRequests, string(askErr.Code), askErr.Reason, start)
 		case usecase.ErrorUpstream:
-			return rejectResponse(ctx, log, correlationID, http.StatusBadGateway, string(askErr.Code), askErr.Reason, start)
+			return rejectResponse(ctx, log, op, correlationID, http.StatusBadGateway, string(askErr.Code), askErr.Reason, start)
+		case usecase.ErrorSpendCapExceeded:
+			return rejectResponse(ctx, log, op, correlationID, http.StatusServiceUnavailable, string(askErr.Code), askErr.Reason, start)
+		case usecase.ErrorDeadlineExceeded:
+			return rejectResponse(ctx, log, op, correlationID, http.StatusGatewayTimeout, string(askErr.Code), askErr.Reason, start)
 		default:
-			return rejectResponse(ctx, log, correlationID, http.StatusInternalServerError, string(usecase.ErrorInternal), askErr.Reason, start)
+			return rejectResponse(ctx, log, op, correlationID, http.StatusInternalServerError, string(usecase.ErrorInternal), askErr.Reason, start)
 		}
 	}
-	return rejectResponse(ctx, log, correlationID, http.StatusInternalServerError, string(usecase.ErrorInternal), "unexpected_error", start)
+	log = log.With("err", err)
+	return rejectResponse(ctx, log, op, correlationID, http.StatusInternalServerError, string(usecase.ErrorInternal), "unexpected_error", start)
 }
 
-func rejectResponse(ctx context.Context, log *slog.Logger, correlationID string, statusCode int, errorCode, reason string, start time.Time) events.APIGatewayProxyResponse {
-	log.WarnContext(ctx, "ask.rejected", "event", "ask.rejected", "reason", reason, "http_status", statusCode, "latency_ms", time.Since(start).Milliseconds())
-	log.InfoContext(ctx, "ask.request.rejected", "http_status", statusCode, "reason", reason)
-	return jsonResponse(statusCode, errorResponse{Error: errorCode}, correlationID)
+// rejectResponse logs the <op>.rejected event and metric and builds the error response.
+func rejectResponse(ctx context.Context, log *slog.Logger, op, correlationID string, statusCode int, errorCode, reason string, start time.Time) Response {
+	logRejection(ctx, log, op, statusCode, reason, start)
+	return errorJSON(statusCode, errorCode, reason, correlationID, nil)
+}
+
+// logRejection logs the <op>.rejected event and metric.
+func logRejection(ctx context.Context, log *slog.Logger, op string, statusCode int, reason string, start time.Time) {
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String(op+".reason", reason))
+	log.WarnContext(ctx, op+".rejected", "event", op+".rejected", "reason", reason, "http_status", statusCode, "latency_ms", time.Since(start).Milliseconds())
+	log.InfoContext(ctx, op+".request.rejected", "http_status", statusCode, "reason", reason)
+}
+
+// route returns the route template, falling back to the raw path.
+func route(req Request) string {
+	if req.Route != "" {
+		return req.Route
+	}
+	return req.Path
 }
 
 func headerValue(headers map[string]string, name string) string {
@@ -113,16 +266,36 @@ func headerValue(headers map[string]string, name string) string {
 	return ""
 }
 
-func jsonResponse(statusCode int, v any, correlationID string) events.APIGatewayProxyResponse {
+// headerCarrier adapts request headers to the OpenTelemetry propagation
+// carrier interface with case-insensitive lookups.
+type headerCarrier map[string]string
+
+func (c headerCarrier) Get(key string) string {
+	return headerValue(c, key)
+}
+
+func (c headerCarrier) Set(key, value string) {
+	c[key] = value
+}
+
+func (c headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func jsonResponse(statusCode int, v any, correlationID string) Response {
 	body, err := json.Marshal(v)
 	if err != nil {
-		return events.APIGatewayProxyResponse{
+		return Response{
 			StatusCode: http.StatusInternalServerError,
 			Headers:    baseHeaders(correlationID),
 			Body:       `{"error":"INTERNAL_ERROR"}`,
 		}
 	}
-	return events.APIGatewayProxyResponse{
+	return Response{
 		StatusCode: statusCode,
 		Headers:    baseHeaders(correlationID),
 		Body:       string(body),
@@ -131,11 +304,7 @@ func jsonResponse(statusCode int, v any, correlationID string) events.APIGateway
 
 func baseHeaders(correlationID string) map[string]string {
 	return map[string]string{
-		"Content-Type":                  "application/json",
-		"X-Correlation-Id":              correlationID,
-		"Access-Control-Allow-Origin":   "*",
-		"Access-Control-Allow-Methods":  "OPTIONS,POST",
-		"Access-Control-Allow-Headers":  "Content-Type,X-Correlation-Id",
-		"Access-Control-Expose-Headers": "X-Correlation-Id",
+		"Content-Type":     "application/json",
+		"X-Correlation-Id": correlationID,
 	}
 }
@@ -5,22 +5,31 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
+	"strings"
 	"testing"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 
+	"portfolio-agent/internal/domain"
 	"portfolio-agent/internal/usecase"
 )
 
 type stubUseCase struct {
-	out usecase.AskOutput
-	err error
-	in  usecase.AskInput
+	out    usecase.AskOutput
+	err    error
+	in     usecase.AskInput
+	tenant string
 }
 
-func (s *stubUseCase) Ask(_ context.Context, in usecase.AskInput) (usecase.AskOutput, error) {
+func (s *stubUseCase) Ask(ctx context.Context, in usecase.AskInput) (usecase.AskOutput, error) {
 	s.in = in
+	s.tenant = domain.TenantFromContext(ctx)
 	return s.out, s.err
 }
 
@@ -41,13 +50,16 @@ func parseBody[T any](t *testing.T, body string) T {
 }
 
 func TestNewHandler_ValidatesDependency(t *testing.T) {
-	_, err := NewHandler(nil)
+	_, err := NewHandler(nil, &stubFeedback{})
+	require.Error(t, err)
+
+	_, err = NewHandler(&stubUseCase{}, nil)
 	require.Error(t, err)
 }
 
 func TestHandle_HappyPath(t *testing.T) {
-	uc := &stubUseCase{out: usecase.AskOutput{Answer: "hello", ConversationID: "conv-1"}}
-	h, err := NewHandler(uc)
+	uc := &stubUseCase{out: usecase.AskOutput{Answer: "hello", ConversationID: "conv-1", TurnID: "2026-02-27T12:00:00Z"}}
+	h, err := NewHandler(uc, &stubFeedback{})
 	require.NoError(t, err)
 
 	resp, err := h.Handle(context.Background(), makeEvent(`{"question":"What do you do?","conversationId":"conv-1"}`))
@@ -58,12 +70,13 @@ func TestHandle_HappyPath(t *testing.T) {
 	out := parseBody[askResponse](t, resp.Body)
 	require.Equal(t, "hello", out.Answer)
 	require.Equal(t, "conv-1", out.ConversationID)
+	require.Equal(t, "2026-02-27T12:00:00Z", out.TurnID)
 	require.NotEmpty(t, resp.Headers["X-Correlation-Id"])
 }
 
 func TestHandle_InvalidBody(t *testing.T) {
 	uc := &stubUseCase{}
-	h, err := NewHandler(uc)
+	h, err := NewHandler(uc, &stubFeedback{})
 	require.NoError(t, err)
 
 	resp, err := h.Handle(context.Background(), makeEvent(`not-json`))
@@ -85,6 +98,8 @@ func TestHandle_MapsUseCaseErrors(t *testing.T) {
 		{name: "invalid question", err: &usecase.Error{Code: usecase.ErrorInvalidQuestion, Reason: "off_topic"}, status: http.StatusBadRequest, code: string(usecase.ErrorInvalidQuestion)},
 		{name: "rate limited", err: &usecase.Error{Code: usecase.ErrorRateLimited, Reason: "openai_rate_limited"}, status: http.StatusTooManyRequests, code: string(usecase.ErrorRateLimited)},
 		{name: "upstream", err: &usecase.Error{Code: usecase.ErrorUpstream, Reason: "openai_error"}, status: http.StatusBadGateway, code: string(usecase.ErrorUpstream)},
+		{name: "spend cap", err: &usecase.Error{Code: usecase.ErrorSpendCapExceeded, Reason: "daily_spend_cap_exceeded"}, status: http.StatusServiceUnavailable, code: string(usecase.ErrorSpendCapExceeded)},
+		{name: "deadline", err: &usecase.Error{Code: usecase.ErrorDeadlineExceeded, Reason: "deadline_exceeded"}, status: http.StatusGatewayTimeout, code: string(usecase.ErrorDeadlineExceeded)},
 		{name: "internal", err: &usecase.Error{Code: usecase.ErrorInternal, Reason: "dynamodb_write_error"}, status: http.StatusInternalServerError, code: string(usecase.ErrorInternal)},
 		{name: "unexpected", err: errors.New("boom"), status: http.StatusInternalServerError, code: string(usecase.ErrorInternal)},
 	}
@@ -92,7 +107,7 @@ func TestHandle_MapsUseCaseErrors(t *testing.T) {
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
 			uc := &stubUseCase{err: tc.err}
-			h, err := NewHandler(uc)
+			h, err := NewHandler(uc, &stubFeedback{})
 			require.NoError(t, err)
 
 			resp, err := h.Handle(context.Background(), makeEvent(`{"question":"What do you do?"}`))
@@ -107,7 +122,7 @@ func TestHandle_MapsUseCaseErrors(t *testing.T) {
 
 func TestHandle_UsesProvidedCorrelationID_CaseInsensitive(t *testing.T) {
 	uc := &stubUseCase{out: usecase.AskOutput{Answer: "ok", ConversationID: "conv-1"}}
-	h, err := NewHandler(uc)
+	h, err := NewHandler(uc, &stubFeedback{})
 	require.NoError(t, err)
 
 	event := makeEvent(`{"question":"What do you do?"}`)
@@ -116,3 +131,77 @@ func TestHandle_UsesProvidedCorrelationID_CaseInsensitive(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, "corr-123", resp.Headers["X-Correlation-Id"])
 }
+
+func TestHandle_AcceptsAndEchoesTraceparent(t *testing.T) {
+	prev := otel.GetTracerProvider()
+	rec := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	uc := &stubUseCase{out: usecase.AskOutput{Answer: "ok", ConversationID: "conv-1"}}
+	h, err := NewHandler(uc, &stubFeedback{})
+	require.NoError(t, err)
+
+	event := makeEvent(`{"question":"What do you do?"}`)
+	event.Headers["Traceparent"] = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	resp, err := h.Handle(context.Background(), event)
+	require.NoError(t, err)
+
+	spans := rec.Ended()
+	require.Len(t, spans, 1)
+	require.Equal(t, "handler.Handle", spans[0].Name())
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[0].SpanContext().TraceID().String())
+	require.Equal(t, "00f067aa0ba902b7", spans[0].Parent().SpanID().String())
+
+	traceparent := resp.Headers["traceparent"]
+	require.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-"+spans[0].SpanContext().SpanID().String()+"-01", traceparent)
+}
+
+func TestHandle_TraceparentOnRejectedResponse(t *testing.T) {
+	prev := otel.GetTracerProvider()
+	rec := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	h, err := NewHandler(&stubUseCase{err: &usecase.Error{Code: usecase.ErrorUpstream, Reason: "openai_error"}}, &stubFeedback{})
+	require.NoError(t, err)
+
+	resp, err := h.Handle(context.Background(), makeEvent(`{"question":"What do you do?"}`))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusBadGateway, resp.StatusCode)
+	require.NotEmpty(t, resp.Headers["traceparent"])
+
+	spans := rec.Ended()
+	require.Len(t, spans, 1)
+	require.Equal(t, codes.Error, spans[0].Status().Code)
+	require.Contains(t, spans[0].Attributes(), attribute.String("ask.reason", "openai_error"))
+}
+
+func TestHandle_LogsDiagnosticsWithoutReturningThem(t *testing.T) {
+	logs := captureRedactedLogs(t)
+	uc := &stubUseCase{err: &usecase.Error{
+		Code:        usecase.ErrorUpstream,
+		Reason:      "openai_malformed_response",
+		Err:         errors.New("usecase: decode scoped answer: invalid character"),
+		Diagnostics: usecase.Diagnostics{Preview: "Sure! not json", Model: "gpt-4o-mini", Attempt: 1},
+	}}
+	h, err := NewHandler(uc, &stubFeedback{})
+	require.NoError(t, err)
+
+	resp, err := h.Handle(context.Background(), makeEvent(`{"question":"What do you do?"}`))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusBadGateway, resp.StatusCode)
+	require.NotContains(t, resp.Body, "Sure! not json")
+	require.NotContains(t, resp.Body, "gpt-4o-mini")
+	require.NotContains(t, resp.Body, "openai_malformed_response")
+
+	var rejected map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		var rec map[string]any
+		require.NoError(t, json.Unmarshal([]byte(line), &rec))
+		if rec["msg"] == "ask.rejected" {
+			rejected = rec
+		}
+	}
+	require.Equal(t, map[string]any{"preview": "Sure! not json", "model": "gpt-4o-mini", "attempt": float64(1)}, rejected["diagnostics"])
+}
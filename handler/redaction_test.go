@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"portfolio-agent/internal/integrations/openai"
+	"portfolio-agent/internal/telemetry"
+	"portfolio-agent/internal/usecase"
+)
+
+const (
+	leakAPIKey       = "sk-test-0123456789abcdefghij"
+	leakSystemPrompt = "You are the private assistant of Jane Doe."
+	leakQuestion     = "What is the home address of Jane Doe?"
+)
+
+// captureRedactedLogs installs the redacting handler used in main as the
+// default logger for the duration of the test.
+func captureRedactedLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	secrets := &telemetry.Secrets{}
+	secrets.Add(leakAPIKey)
+	secrets.Add(leakSystemPrompt)
+
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(telemetry.NewRedactingHandler(slog.NewJSONHandler(&buf, nil), telemetry.WithSecrets(secrets))))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return &buf
+}
+
+func TestHandle_ErrorPathsNeverLogSecrets(t *testing.T) {
+	// Upstream errors can echo the request: the key in an auth error, the
+	// prompt and question in a validation error, all in a large body.
+	echo := fmt.Sprintf(`{"error":"bad request","key":%q,"messages":[%q,%q]}%s`,
+		leakAPIKey, leakSystemPrompt, leakQuestion, strings.Repeat(" ", 4096))
+	upstream := &openai.HTTPStatusError{StatusCode: http.StatusBadRequest, URL: "https://api.openai.com/v1/chat/completions", Body: echo}
+
+	cases := []struct {
+		name string
+		err  error
+	}{
+		{name: "invalid question", err: &usecase.Error{Code: usecase.ErrorInvalidQuestion, Reason: "moderation_flagged:harassment"}},
+		{name: "rate limited", err: &usecase.Error{Code: usecase.ErrorRateLimited, Reason: "openai_rate_limited", Err: upstream}},
+		{name: "upstream", err: &usecase.Error{Code: usecase.ErrorUpstream, Reason: "openai_error", Err: fmt.Errorf("openai: request failed: %w", upstream)}},
+		{name: "malformed", err: &usecase.Error{Code: usecase.ErrorUpstream, Reason: "openai_malformed_response", Err: errors.New("decode: " + leakQuestion)}},
+		{name: "internal", err: &usecase.Error{Code: usecase.ErrorInternal, Reason: "ssm_load_error", Err: errors.New("token " + leakAPIKey)}},
+		{name: "unexpected", err: fmt.Errorf("boom: %s", leakSystemPrompt)},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			logs := captureRedactedLogs(t)
+			h, err := NewHandler(&stubUseCase{err: tc.err}, &stubFeedback{})
+			require.NoError(t, err)
+
+			_, err = h.Handle(context.Background(), makeEvent(fmt.Sprintf(`{"question":%q}`, leakQuestion)))
+			require.NoError(t, err)
+
+			require.Contains(t, logs.String(), "ask.rejected")
+			requireNoLeak(t, logs.String())
+		})
+	}
+}
+
+func TestHandle_ShortQuestionEchoedUpstreamIsRedacted(t *testing.T) {
+	const question = "Why Go?"
+	logs := captureRedactedLogs(t)
+	upstream := &openai.HTTPStatusError{
+		StatusCode: http.StatusBadRequest,
+		URL:        "https://api.openai.com/v1/chat/completions",
+		Body:       fmt.Sprintf(`{"error":{"message":"Invalid input: %s"}}`, question),
+	}
+	h, err := NewHandler(&stubUseCase{err: &usecase.Error{Code: usecase.ErrorUpstream, Reason: "openai_error", Err: upstream}}, &stubFeedback{})
+	require.NoError(t, err)
+
+	_, err = h.Handle(context.Background(), makeEvent(fmt.Sprintf(`{"question":%q}`, question)))
+	require.NoError(t, err)
+	require.Contains(t, logs.String(), `"event":"ask.rejected"`)
+	require.Contains(t, logs.String(), "Invalid input: "+telemetry.Redacted)
+	require.NotContains(t, logs.String(), question)
+}
+
+func TestHandle_UpstreamErrorIsLoggedTruncated(t *testing.T) {
+	logs := captureRedactedLogs(t)
+	upstream := &openai.HTTPStatusError{StatusCode: http.StatusBadGateway, URL: "https://api.openai.com/v1/moderations", Body: strings.Repeat("x", 4096)}
+	h, err := NewHandler(&stubUseCase{err: &usecase.Error{Code: usecase.ErrorUpstream, Reason: "moderation_error", Err: upstream}}, &stubFeedback{})
+	require.NoError(t, err)
+
+	_, err = h.Handle(context.Background(), makeEvent(`{"question":"hi"}`))
+	require.NoError(t, err)
+	require.Contains(t, logs.String(), "unexpected status 502")
+	require.Contains(t, logs.String(), "bytes truncated")
+	require.NotContains(t, logs.String(), strings.Repeat("x", telemetry.DefaultMaxValueLen+1))
+}
+
+func TestHandle_SuccessAndInvalidBodyNeverLogSecrets(t *testing.T) {
+	logs := captureRedactedLogs(t)
+	h, err := NewHandler(&stubUseCase{out: usecase.AskOutput{Answer: leakSystemPrompt, ConversationID: "conv-1"}}, &stubFeedback{})
+	require.NoError(t, err)
+
+	_, err = h.Handle(context.Background(), makeEvent(fmt.Sprintf(`{"question":%q}`, leakQuestion)))
+	require.NoError(t, err)
+	_, err = h.Handle(context.Background(), makeEvent(fmt.Sprintf(`{"question":%q,`, leakQuestion)))
+	require.NoError(t, err)
+
+	require.Contains(t, logs.String(), "ask.invoked")
+	require.Contains(t, logs.String(), "invalid_body")
+	requireNoLeak(t, logs.String())
+}
+
+func requireNoLeak(t *testing.T, logs string) {
+	t.Helper()
+	require.NotContains(t, logs, leakAPIKey)
+	require.NotContains(t, logs, leakSystemPrompt)
+	require.NotContains(t, logs, leakQuestion)
+}
@@ -0,0 +1,164 @@
+package handler
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Event types the handler can be deployed behind; main selects the matching
+// adapter at startup.
+const (
+	EventTypeREST        = "rest"         // API Gateway REST API (payload v1)
+	EventTypeHTTP        = "http"         // API Gateway HTTP API (payload v2)
+	EventTypeFunctionURL = "function_url" // Lambda Function URL
+)
+
+// askResource is the route template of the ask route.
+const askResource = "/ask"
+
+// Request is the transport-neutral view of an inbound HTTP request that all
+// validation, routing and error mapping work on.
+type Request struct {
+	Method         string
+	Path           string
+	Route          string // route template, e.g. "/ask"; matched from Path when empty
+	Headers        map[string]string
+	PathParameters map[string]string
+	Body           string
+	RequestID      string
+	APIKeyID       string // API Gateway API key of the caller; REST API only
+
+	// bodyErr is set when the event body could not be decoded; the request
+	// is then rejected with invalid_request.
+	bodyErr error
+}
+
+// Response is the transport-neutral HTTP response returned by Serve.
+type Response struct {
+	StatusCode int
+	Headers    map[string]string
+	Body       string
+}
+
+// Handle serves an API Gateway REST API (payload v1) event.
+func (h *Handler) Handle(ctx context.Context, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	body, bodyErr := eventBody(event.Body, event.IsBase64Encoded)
+	resp := h.Serve(ctx, Request{
+		Method:         event.HTTPMethod,
+		Path:           event.Path,
+		Route:          event.Resource,
+		Headers:        event.Headers,
+		PathParameters: event.PathParameters,
+		Body:           body,
+		RequestID:      event.RequestContext.RequestID,
+		APIKeyID:       event.RequestContext.Identity.APIKeyID,
+		bodyErr:        bodyErr,
+	})
+	return events.APIGatewayProxyResponse{StatusCode: resp.StatusCode, Headers: resp.Headers, Body: resp.Body}, nil
+}
+
+// HandleHTTP serves an API Gateway HTTP API (payload v2) event. The raw path
+// of a named stage starts with the stage, which is dropped before routes are
+// matched.
+func (h *Handler) HandleHTTP(ctx context.Context, event events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	body, bodyErr := eventBody(event.Body, event.IsBase64Encoded)
+	resp := h.Serve(ctx, Request{
+		Method:         event.RequestContext.HTTP.Method,
+		Path:           stripStage(event.RawPath, event.RequestContext.Stage),
+		Route:          routeKeyPath(event.RouteKey),
+		Headers:        event.Headers,
+		PathParameters: event.PathParameters,
+		Body:           body,
+		RequestID:      event.RequestContext.RequestID,
+		bodyErr:        bodyErr,
+	})
+	return events.APIGatewayV2HTTPResponse{StatusCode: resp.StatusCode, Headers: resp.Headers, Body: resp.Body}, nil
+}
+
+// HandleFunctionURL serves a Lambda Function URL event. Function URLs have
+// no routes or stages, so the route and path parameters are matched from the
+// raw path.
+func (h *Handler) HandleFunctionURL(ctx context.Context, event events.LambdaFunctionURLRequest) (events.LambdaFunctionURLResponse, error) {
+	body, bodyErr := eventBody(event.Body, event.IsBase64Encoded)
+	resp := h.Serve(ctx, Request{
+		Method:    event.RequestContext.HTTP.Method,
+		Path:      event.RawPath,
+		Headers:   event.Headers,
+		Body:      body,
+		RequestID: event.RequestContext.RequestID,
+		bodyErr:   bodyErr,
+	})
+	return events.LambdaFunctionURLResponse{StatusCode: resp.StatusCode, Headers: resp.Headers, Body: resp.Body}, nil
+}
+
+func eventBody(body string, isBase64 bool) (string, error) {
+	if !isBase64 {
+		return body, nil
+	}
+	decoded, err := base64.StdEncoding.DecodeString(body)
+	if err != nil {
+		return "", fmt.Errorf("handler: decode base64 body: %w", err)
+	}
+	return string(decoded), nil
+}
+
+// stripStage removes the "/{stage}" prefix an HTTP API adds to the raw path
+// of requests to a stage other than "$default".
+func stripStage(path, stage string) string {
+	if stage == "" || stage == "$default" {
+		return path
+	}
+	if rest, ok := strings.CutPrefix(path, "/"+stage); ok && (rest == "" || strings.HasPrefix(rest, "/")) {
+		return rest
+	}
+	return path
+}
+
+// routeKeyPath strips the method from an HTTP API route key such as
+// "POST /ask". The "$default" route has no template.
+func routeKeyPath(routeKey string) string {
+	if _, path, ok := strings.Cut(routeKey, " "); ok {
+		return path
+	}
+	return ""
+}
+
+// routeTemplates are the routes served, each also mounted below a {tenant}
+// segment for path-based tenancy.
+var routeTemplates = []string{askResource, feedbackResource, "/{tenant}" + askResource, "/{tenant}" + feedbackResource}
+
+// matchRoute finds the route template matching path and extracts its
+// parameters.
+func matchRoute(path string) (string, map[string]string, bool) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for _, template := range routeTemplates {
+		parts := strings.Split(strings.Trim(template, "/"), "/")
+		if len(parts) != len(segments) {
+			continue
+		}
+		params := make(map[string]string)
+		matched := true
+		for i, part := range parts {
+			if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+				if segments[i] == "" {
+					matched = false
+					break
+				}
+				params[part[1:len(part)-1]] = segments[i]
+				continue
+			}
+			if part != segments[i] {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return template, params, true
+		}
+	}
+	return "", nil, false
+}
@@ -0,0 +1,171 @@
+package handler
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/require"
+
+	"portfolio-agent/internal/usecase"
+)
+
+func TestHandleHTTP_AskHappyPath(t *testing.T) {
+	ask := &stubUseCase{out: usecase.AskOutput{Answer: "hi", ConversationID: "conv-1", TurnID: "turn-1"}}
+	h, err := NewHandler(ask, &stubFeedback{})
+	require.NoError(t, err)
+
+	event := events.APIGatewayV2HTTPRequest{
+		RouteKey:        "POST /ask",
+		RawPath:         "/ask",
+		Headers:         map[string]string{"content-type": "application/json", "x-correlation-id": "corr-1"},
+		Body:            base64.StdEncoding.EncodeToString([]byte(`{"question":"What do you do?"}`)),
+		IsBase64Encoded: true,
+	}
+	event.RequestContext.HTTP.Method = http.MethodPost
+
+	resp, err := h.HandleHTTP(context.Background(), event)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "corr-1", resp.Headers["X-Correlation-Id"])
+	require.Equal(t, "What do you do?", ask.in.Question)
+	require.Equal(t, "hi", parseBody[askResponse](t, resp.Body).Answer)
+}
+
+func TestHandleHTTP_DefaultRouteMatchesFeedbackPath(t *testing.T) {
+	fb := &stubFeedback{out: usecase.FeedbackOutput{ConversationID: "conv-1", TurnID: "turn-1", Rating: "up"}}
+	h, err := NewHandler(&stubUseCase{}, fb)
+	require.NoError(t, err)
+
+	event := events.APIGatewayV2HTTPRequest{
+		RouteKey: "$default",
+		RawPath:  "/conversations/conv-1/turns/turn-1/feedback",
+		Headers:  map[string]string{"content-type": "application/json"},
+		Body:     `{"rating":"up"}`,
+	}
+	event.RequestContext.HTTP.Method = http.MethodPost
+
+	resp, err := h.HandleHTTP(context.Background(), event)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "conv-1", fb.in.ConversationID)
+	require.Equal(t, "turn-1", fb.in.TurnID)
+}
+
+func TestInvalidBase64BodyIsBadRequest(t *testing.T) {
+	ask := &stubUseCase{}
+	h, err := NewHandler(ask, &stubFeedback{})
+	require.NoError(t, err)
+	headers := map[string]string{"content-type": "application/json"}
+	ctx := context.Background()
+
+	rest, err := h.Handle(ctx, events.APIGatewayProxyRequest{
+		HTTPMethod: http.MethodPost, Path: "/ask", Resource: "/ask", Headers: headers, Body: "%%%", IsBase64Encoded: true,
+	})
+	require.NoError(t, err)
+
+	httpEvent := events.APIGatewayV2HTTPRequest{RouteKey: "POST /ask", RawPath: "/ask", Headers: headers, Body: "%%%", IsBase64Encoded: true}
+	httpEvent.RequestContext.HTTP.Method = http.MethodPost
+	httpAPI, err := h.HandleHTTP(ctx, httpEvent)
+	require.NoError(t, err)
+
+	urlEvent := events.LambdaFunctionURLRequest{RawPath: "/ask", Headers: headers, Body: "%%%", IsBase64Encoded: true}
+	urlEvent.RequestContext.HTTP.Method = http.MethodPost
+	functionURL, err := h.HandleFunctionURL(ctx, urlEvent)
+	require.NoError(t, err)
+
+	for name, resp := range map[string]Response{
+		"rest":         {StatusCode: rest.StatusCode, Body: rest.Body},
+		"http":         {StatusCode: httpAPI.StatusCode, Body: httpAPI.Body},
+		"function_url": {StatusCode: functionURL.StatusCode, Body: functionURL.Body},
+	} {
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode, name)
+		body := parseBody[errorResponse](t, resp.Body)
+		require.Equal(t, string(usecase.ErrorInvalidInput), body.Error, name)
+		require.Equal(t, "invalid_request", body.Reason, name)
+	}
+	require.Empty(t, ask.in.Question)
+}
+
+func TestHandleHTTP_NamedStageDefaultRoute(t *testing.T) {
+	fb := &stubFeedback{}
+	h, err := NewHandler(&stubUseCase{}, fb)
+	require.NoError(t, err)
+
+	event := events.APIGatewayV2HTTPRequest{
+		RouteKey: "$default",
+		RawPath:  "/prod/conversations/conv-1/turns/turn-1/feedback",
+		Headers:  map[string]string{"content-type": "application/json"},
+		Body:     `{"rating":"up"}`,
+	}
+	event.RequestContext.Stage = "prod"
+	event.RequestContext.HTTP.Method = http.MethodPost
+
+	resp, err := h.HandleHTTP(context.Background(), event)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "conv-1", fb.in.ConversationID)
+}
+
+func TestStripStage(t *testing.T) {
+	for _, tc := range []struct{ path, stage, want string }{
+		{"/prod/ask", "prod", "/ask"},
+		{"/ask", "$default", "/ask"},
+		{"/ask", "", "/ask"},
+		{"/production/ask", "prod", "/production/ask"},
+		{"/prod", "prod", ""},
+	} {
+		require.Equal(t, tc.want, stripStage(tc.path, tc.stage), tc.path)
+	}
+}
+
+func TestHandleFunctionURL_PathTenantAndFeedback(t *testing.T) {
+	resolver, err := NewTenantResolver(TenantSourcePath, map[string]string{"bob": "bob"})
+	require.NoError(t, err)
+	fb := &stubFeedback{}
+	h, err := NewHandler(&stubUseCase{}, fb, WithTenantResolver(resolver))
+	require.NoError(t, err)
+
+	event := events.LambdaFunctionURLRequest{
+		RawPath: "/bob/conversations/conv-1/turns/turn-1/feedback",
+		Headers: map[string]string{"content-type": "application/json"},
+		Body:    `{"rating":"down"}`,
+	}
+	event.RequestContext.HTTP.Method = http.MethodPost
+
+	resp, err := h.HandleFunctionURL(context.Background(), event)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "bob", fb.tenant)
+	require.Equal(t, "conv-1", fb.in.ConversationID)
+	require.Equal(t, "down", fb.in.Rating)
+}
+
+func TestHandleFunctionURL_UnknownRouteIsNotFound(t *testing.T) {
+	ask := &stubUseCase{}
+	h, err := NewHandler(ask, &stubFeedback{})
+	require.NoError(t, err)
+
+	event := events.LambdaFunctionURLRequest{RawPath: "/admin", Body: `{"question":"hi"}`}
+	event.RequestContext.HTTP.Method = http.MethodPost
+
+	resp, err := h.HandleFunctionURL(context.Background(), event)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	require.Equal(t, string(usecase.ErrorNotFound), parseBody[errorResponse](t, resp.Body).Error)
+	require.Empty(t, ask.in.Question)
+}
+
+func TestServe_PreflightReturnsCORSHeaders(t *testing.T) {
+	ask := &stubUseCase{}
+	h, err := NewHandler(ask, &stubFeedback{})
+	require.NoError(t, err)
+
+	resp := h.Serve(context.Background(), Request{Method: http.MethodOptions, Path: "/ask"})
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	require.Equal(t, "OPTIONS,POST", resp.Headers["Access-Control-Allow-Methods"])
+	require.Empty(t, resp.Body)
+	require.Empty(t, ask.in.Question)
+}
@@ -0,0 +1,166 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"mime"
+	"net/http"
+	"sort"
+	"time"
+	"unicode/utf8"
+
+	"portfolio-agent/internal/usecase"
+)
+
+// errorUnsupportedMediaType is returned for request bodies that are not JSON.
+const errorUnsupportedMediaType = "UNSUPPORTED_MEDIA_TYPE"
+
+// Field error reasons returned in errorResponse.Details.
+const (
+	fieldRequired     = "required"
+	fieldUnknown      = "unknown_field"
+	fieldInvalidType  = "invalid_type"
+	fieldTooShort     = "too_short"
+	fieldTooLong      = "too_long"
+	fieldInvalidValue = "invalid_value"
+)
+
+// bodySchema mirrors a request schema under components/schemas in
+// terraform/modules/api-gateway/open-api.yml: an object of string properties
+// with additionalProperties: false. TestSchemas_MatchOpenAPI fails when the
+// two drift apart.
+type bodySchema struct {
+	name   string
+	fields []fieldSchema
+}
+
+type fieldSchema struct {
+	name      string
+	required  bool
+	nullable  bool
+	minLength int
+	maxLength int // 0 means unbounded
+	enum      []string
+}
+
+// askRequestSchema leaves the question's maximum length to the use case,
+// which enforces MAX_QUESTION_LENGTH with reason question_too_long.
+var askRequestSchema = bodySchema{
+	name: "AskRequest",
+	fields: []fieldSchema{
+		{name: "question", required: true, minLength: 1},
+		{name: "conversationId", nullable: true, maxLength: 128},
+	},
+}
+
+var feedbackRequestSchema = bodySchema{
+	name: "FeedbackRequest",
+	fields: []fieldSchema{
+		{name: "rating", required: true, enum: []string{"up", "down"}},
+		{name: "comment", nullable: true, maxLength: 500},
+	},
+}
+
+// fieldError describes why one body field was rejected. Values are never
+// echoed back, only the field name and reason.
+type fieldError struct {
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
+}
+
+// validate checks body against the schema. It returns an error if body is
+// not a JSON object, and the field errors otherwise.
+func (s bodySchema) validate(body string) ([]fieldError, error) {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(body), &obj); err != nil {
+		return nil, err
+	}
+	if obj == nil {
+		return nil, errors.New("handler: body must be a JSON object")
+	}
+
+	var errs []fieldError
+	known := make(map[string]bool, len(s.fields))
+	for _, f := range s.fields {
+		known[f.name] = true
+		raw, ok := obj[f.name]
+		if !ok {
+			if f.required {
+				errs = append(errs, fieldError{Field: f.name, Reason: fieldRequired})
+			}
+			continue
+		}
+		if reason := f.check(raw); reason != "" {
+			errs = append(errs, fieldError{Field: f.name, Reason: reason})
+		}
+	}
+
+	var unknown []string
+	for name := range obj {
+		if !known[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	for _, name := range unknown {
+		errs = append(errs, fieldError{Field: name, Reason: fieldUnknown})
+	}
+	return errs, nil
+}
+
+func (f fieldSchema) check(raw json.RawMessage) string {
+	if bytes.Equal(raw, []byte("null")) {
+		if f.nullable {
+			return ""
+		}
+		return fieldInvalidType
+	}
+	var v string
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return fieldInvalidType
+	}
+	n := utf8.RuneCountInString(v)
+	switch {
+	case n < f.minLength:
+		return fieldTooShort
+	case f.maxLength > 0 && n > f.maxLength:
+		return fieldTooLong
+	}
+	if len(f.enum) > 0 {
+		for _, e := range f.enum {
+			if v == e {
+				return ""
+			}
+		}
+		return fieldInvalidValue
+	}
+	return ""
+}
+
+// decodeBody validates the request body against schema and decodes it into
+// v. On failure it returns the rejection response and false.
+func decodeBody(ctx context.Context, log *slog.Logger, op, correlationID string, req Request, schema bodySchema, v any, start time.Time) (Response, bool) {
+	if req.bodyErr != nil {
+		log = log.With("err", req.bodyErr)
+		return rejectResponse(ctx, log, op, correlationID, http.StatusBadRequest, string(usecase.ErrorInvalidInput), "invalid_request", start), false
+	}
+	mediaType, _, err := mime.ParseMediaType(headerValue(req.Headers, "Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		return rejectResponse(ctx, log, op, correlationID, http.StatusUnsupportedMediaType, errorUnsupportedMediaType, "unsupported_media_type", start), false
+	}
+	details, err := schema.validate(req.Body)
+	if err != nil {
+		return rejectResponse(ctx, log, op, correlationID, http.StatusBadRequest, string(usecase.ErrorInvalidInput), "invalid_body", start), false
+	}
+	if len(details) > 0 {
+		logRejection(ctx, log.With("fields", details), op, http.StatusBadRequest, "schema_violation", start)
+		return errorJSON(http.StatusBadRequest, string(usecase.ErrorInvalidInput), "schema_violation", correlationID, details), false
+	}
+	if err := json.Unmarshal([]byte(req.Body), v); err != nil {
+		return rejectResponse(ctx, log, op, correlationID, http.StatusBadRequest, string(usecase.ErrorInvalidInput), "invalid_body", start), false
+	}
+	return Response{}, true
+}
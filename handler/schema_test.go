@@ -0,0 +1,208 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+
+	"portfolio-agent/internal/usecase"
+)
+
+const openAPIPath = "../terraform/modules/api-gateway/open-api.yml"
+
+type openAPISchema struct {
+	Type                 string                   `yaml:"type"`
+	AdditionalProperties *bool                    `yaml:"additionalProperties"`
+	Required             []string                 `yaml:"required"`
+	Properties           map[string]openAPISchema `yaml:"properties"`
+	Nullable             bool                     `yaml:"nullable"`
+	MinLength            int                      `yaml:"minLength"`
+	MaxLength            int                      `yaml:"maxLength"`
+	Enum                 []string                 `yaml:"enum"`
+	Items                *openAPISchema           `yaml:"items"`
+	Ref                  string                   `yaml:"$ref"`
+}
+
+func loadOpenAPISchemas(t *testing.T) map[string]openAPISchema {
+	t.Helper()
+	raw, err := os.ReadFile(openAPIPath)
+	require.NoError(t, err)
+	var doc struct {
+		Components struct {
+			Schemas map[string]openAPISchema `yaml:"schemas"`
+		} `yaml:"components"`
+	}
+	require.NoError(t, yaml.Unmarshal(raw, &doc))
+	return doc.Components.Schemas
+}
+
+// jsonFields returns the JSON property names of a struct and those tagged
+// omitempty.
+func jsonFields(typ reflect.Type) (names, optional []string) {
+	for i := 0; i < typ.NumField(); i++ {
+		name, opts, _ := strings.Cut(typ.Field(i).Tag.Get("json"), ",")
+		names = append(names, name)
+		if opts == "omitempty" {
+			optional = append(optional, name)
+		}
+	}
+	return names, optional
+}
+
+func TestSchemas_MatchOpenAPI(t *testing.T) {
+	schemas := loadOpenAPISchemas(t)
+
+	// Request validators mirror the OpenAPI request schemas exactly.
+	for _, s := range []bodySchema{askRequestSchema, feedbackRequestSchema} {
+		closed := false
+		want := openAPISchema{Type: "object", AdditionalProperties: &closed, Properties: map[string]openAPISchema{}}
+		for _, f := range s.fields {
+			if f.required {
+				want.Required = append(want.Required, f.name)
+			}
+			want.Properties[f.name] = openAPISchema{Type: "string", Nullable: f.nullable, MinLength: f.minLength, MaxLength: f.maxLength, Enum: f.enum}
+		}
+		require.Equal(t, want, schemas[s.name], s.name)
+	}
+
+	// Go structs carry the same properties as their schema; response fields
+	// without omitempty are required.
+	structs := map[string]reflect.Type{
+		"AskRequest":       reflect.TypeOf(askRequest{}),
+		"AskResponse":      reflect.TypeOf(askResponse{}),
+		"FeedbackRequest":  reflect.TypeOf(feedbackRequest{}),
+		"FeedbackResponse": reflect.TypeOf(feedbackResponse{}),
+		"ErrorResponse":    reflect.TypeOf(errorResponse{}),
+		"FieldError":       reflect.TypeOf(fieldError{}),
+	}
+	for name, typ := range structs {
+		schema, ok := schemas[name]
+		require.True(t, ok, "open-api.yml has no %s schema", name)
+		names, optional := jsonFields(typ)
+		var props []string
+		for p := range schema.Properties {
+			props = append(props, p)
+		}
+		require.ElementsMatch(t, names, props, name)
+		if strings.HasSuffix(name, "Request") {
+			continue
+		}
+		var required []string
+		for _, n := range names {
+			if !contains(optional, n) {
+				required = append(required, n)
+			}
+		}
+		require.ElementsMatch(t, required, schema.Required, name)
+	}
+
+	require.ElementsMatch(t,
+		[]string{fieldRequired, fieldUnknown, fieldInvalidType, fieldTooShort, fieldTooLong, fieldInvalidValue},
+		schemas["FieldError"].Properties["reason"].Enum)
+}
+
+func contains(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+func TestBodySchema_Validate(t *testing.T) {
+	cases := []struct {
+		name string
+		body string
+		want []fieldError
+	}{
+		{name: "valid", body: `{"question":"What do you do?","conversationId":"conv-1"}`},
+		{name: "null optional", body: `{"question":"hi","conversationId":null}`},
+		{name: "missing required", body: `{}`, want: []fieldError{{Field: "question", Reason: fieldRequired}}},
+		{name: "wrong type", body: `{"question":42}`, want: []fieldError{{Field: "question", Reason: fieldInvalidType}}},
+		{name: "null required", body: `{"question":null}`, want: []fieldError{{Field: "question", Reason: fieldInvalidType}}},
+		{name: "empty", body: `{"question":""}`, want: []fieldError{{Field: "question", Reason: fieldTooShort}}},
+		{name: "question length is left to the use case", body: `{"question":"` + strings.Repeat("é", 5000) + `"}`},
+		{name: "too long", body: `{"question":"hi","conversationId":"` + strings.Repeat("c", 129) + `"}`, want: []fieldError{{Field: "conversationId", Reason: fieldTooLong}}},
+		{
+			name: "unknown fields after schema fields",
+			body: `{"zeta":1,"question":"hi","alpha":true,"conversationId":[]}`,
+			want: []fieldError{{Field: "conversationId", Reason: fieldInvalidType}, {Field: "alpha", Reason: fieldUnknown}, {Field: "zeta", Reason: fieldUnknown}},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := askRequestSchema.validate(tc.body)
+			require.NoError(t, err)
+			require.Equal(t, tc.want, got)
+		})
+	}
+
+	for _, body := range []string{`not-json`, `null`, `[]`, `"question"`} {
+		_, err := askRequestSchema.validate(body)
+		require.Error(t, err, body)
+	}
+
+	got, err := feedbackRequestSchema.validate(`{"rating":"sideways"}`)
+	require.NoError(t, err)
+	require.Equal(t, []fieldError{{Field: "rating", Reason: fieldInvalidValue}}, got)
+}
+
+func TestHandle_SchemaViolationReturnsFieldDetails(t *testing.T) {
+	uc := &stubUseCase{}
+	h, err := NewHandler(uc, &stubFeedback{})
+	require.NoError(t, err)
+
+	resp, err := h.Handle(context.Background(), makeEvent(`{"question":"hi","conversationID":"conv-1"}`))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	out := parseBody[errorResponse](t, resp.Body)
+	require.Equal(t, string(usecase.ErrorInvalidInput), out.Error)
+	require.Equal(t, "schema_violation", out.Reason)
+	require.Equal(t, []fieldError{{Field: "conversationID", Reason: fieldUnknown}}, out.Details)
+	require.Empty(t, uc.in.Question)
+}
+
+func TestHandle_RejectsNonJSONContentType(t *testing.T) {
+	for _, contentType := range []string{"", "text/plain", "application/x-www-form-urlencoded"} {
+		uc := &stubUseCase{}
+		h, err := NewHandler(uc, &stubFeedback{})
+		require.NoError(t, err)
+
+		event := makeEvent(`{"question":"hi"}`)
+		event.Headers = map[string]string{"Content-Type": contentType}
+		resp, err := h.Handle(context.Background(), event)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusUnsupportedMediaType, resp.StatusCode, contentType)
+		require.Equal(t, errorUnsupportedMediaType, parseBody[errorResponse](t, resp.Body).Error)
+		require.Empty(t, uc.in.Question)
+	}
+
+	uc := &stubUseCase{}
+	h, err := NewHandler(uc, &stubFeedback{})
+	require.NoError(t, err)
+	event := makeEvent(`{"question":"hi"}`)
+	event.Headers = map[string]string{"content-type": "application/json; charset=utf-8"}
+	resp, err := h.Handle(context.Background(), event)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestHandleFeedback_SchemaViolation(t *testing.T) {
+	fb := &stubFeedback{}
+	h, err := NewHandler(&stubUseCase{}, fb)
+	require.NoError(t, err)
+
+	resp, err := h.Handle(context.Background(), makeFeedbackEvent(`{"comment":"`+strings.Repeat("x", 501)+`"}`))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	require.Equal(t, []fieldError{{Field: "rating", Reason: fieldRequired}, {Field: "comment", Reason: fieldTooLong}},
+		parseBody[errorResponse](t, resp.Body).Details)
+	require.Empty(t, fb.in.Rating)
+}
@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"portfolio-agent/internal/domain"
+)
+
+// Tenant sources accepted by NewTenantResolver.
+const (
+	TenantSourceNone   = "none"
+	TenantSourceHost   = "host"
+	TenantSourcePath   = "path"
+	TenantSourceAPIKey = "api_key"
+)
+
+// ErrUnknownTenant is returned when a request cannot be mapped to a tenant.
+var ErrUnknownTenant = errors.New("handler: unknown tenant")
+
+// TenantResolver identifies the portfolio owner a request is addressed to.
+type TenantResolver interface {
+	ResolveTenant(req Request) (string, error)
+}
+
+// mappedTenantResolver reads a request attribute and maps its value to a
+// tenant ID through a fixed table; unmapped values are rejected.
+type mappedTenantResolver struct {
+	key     func(Request) string
+	tenants map[string]string
+}
+
+// NewTenantResolver returns a resolver that reads the tenant key from source
+// and looks it up in tenants:
+//   - "host": the Host header without port, e.g. {"alice.example.com": "alice"}
+//   - "path": the {tenant} path parameter, e.g. {"alice": "alice"}
+//   - "api_key": the API Gateway API key ID of the caller (REST API only)
+//
+// It returns nil for "none" or "", meaning every request uses the default tenant.
+func NewTenantResolver(source string, tenants map[string]string) (TenantResolver, error) {
+	var key func(Request) string
+	switch source {
+	case "", TenantSourceNone:
+		return nil, nil
+	case TenantSourceHost:
+		key = requestHost
+	case TenantSourcePath:
+		key = func(req Request) string { return req.PathParameters["tenant"] }
+	case TenantSourceAPIKey:
+		key = func(req Request) string { return req.APIKeyID }
+	default:
+		return nil, fmt.Errorf("handler: unknown tenant source %q", source)
+	}
+	if len(tenants) == 0 {
+		return nil, errors.New("handler: tenant map must not be empty")
+	}
+
+	normalized := make(map[string]string, len(tenants))
+	for k, id := range tenants {
+		if !domain.ValidTenantID(id) {
+			return nil, fmt.Errorf("handler: invalid tenant ID %q", id)
+		}
+		if source == TenantSourceHost {
+			k = strings.ToLower(k)
+		}
+		normalized[k] = id
+	}
+	return &mappedTenantResolver{key: key, tenants: normalized}, nil
+}
+
+func (r *mappedTenantResolver) ResolveTenant(req Request) (string, error) {
+	k := r.key(req)
+	if k == "" {
+		return "", ErrUnknownTenant
+	}
+	id, ok := r.tenants[k]
+	if !ok {
+		return "", ErrUnknownTenant
+	}
+	return id, nil
+}
+
+// requestHost returns the lower-cased Host header without its port.
+func requestHost(req Request) string {
+	host := strings.ToLower(headerValue(req.Headers, "Host"))
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"portfolio-agent/internal/usecase"
+)
+
+func TestNewTenantResolver_None(t *testing.T) {
+	r, err := NewTenantResolver(TenantSourceNone, nil)
+	require.NoError(t, err)
+	require.Nil(t, r)
+}
+
+func TestNewTenantResolver_Validates(t *testing.T) {
+	_, err := NewTenantResolver("cookie", map[string]string{"a": "a"})
+	require.Error(t, err)
+
+	_, err = NewTenantResolver(TenantSourceHost, nil)
+	require.Error(t, err)
+
+	_, err = NewTenantResolver(TenantSourceHost, map[string]string{"a.example.com": "Bad#ID"})
+	require.Error(t, err)
+}
+
+func TestTenantResolver_Sources(t *testing.T) {
+	host, err := NewTenantResolver(TenantSourceHost, map[string]string{"Alice.Example.com": "alice"})
+	require.NoError(t, err)
+	id, err := host.ResolveTenant(Request{Headers: map[string]string{"host": "alice.example.com:443"}})
+	require.NoError(t, err)
+	require.Equal(t, "alice", id)
+
+	path, err := NewTenantResolver(TenantSourcePath, map[string]string{"bob": "bob"})
+	require.NoError(t, err)
+	id, err = path.ResolveTenant(Request{PathParameters: map[string]string{"tenant": "bob"}})
+	require.NoError(t, err)
+	require.Equal(t, "bob", id)
+
+	apiKey, err := NewTenantResolver(TenantSourceAPIKey, map[string]string{"key-123": "carol"})
+	require.NoError(t, err)
+	id, err = apiKey.ResolveTenant(Request{APIKeyID: "key-123"})
+	require.NoError(t, err)
+	require.Equal(t, "carol", id)
+
+	_, err = apiKey.ResolveTenant(Request{})
+	require.ErrorIs(t, err, ErrUnknownTenant)
+}
+
+func TestHandle_ScopesUseCasesToResolvedTenant(t *testing.T) {
+	resolver, err := NewTenantResolver(TenantSourceHost, map[string]string{"alice.example.com": "alice"})
+	require.NoError(t, err)
+	ask := &stubUseCase{}
+	fb := &stubFeedback{}
+	h, err := NewHandler(ask, fb, WithTenantResolver(resolver))
+	require.NoError(t, err)
+
+	event := makeEvent(`{"question":"hi"}`)
+	event.Headers["Host"] = "alice.example.com"
+	resp, err := h.Handle(context.Background(), event)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "alice", ask.tenant)
+
+	fbEvent := makeFeedbackEvent(`{"rating":"up"}`)
+	fbEvent.Headers["Host"] = "alice.example.com"
+	resp, err = h.Handle(context.Background(), fbEvent)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "alice", fb.tenant)
+}
+
+func TestHandle_UnknownTenantIsNotFound(t *testing.T) {
+	resolver, err := NewTenantResolver(TenantSourceHost, map[string]string{"alice.example.com": "alice"})
+	require.NoError(t, err)
+	ask := &stubUseCase{}
+	h, err := NewHandler(ask, &stubFeedback{}, WithTenantResolver(resolver))
+	require.NoError(t, err)
+
+	event := makeEvent(`{"question":"hi"}`)
+	event.Headers["Host"] = "mallory.example.com"
+	resp, err := h.Handle(context.Background(), event)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	require.Equal(t, string(usecase.ErrorNotFound), parseBody[errorResponse](t, resp.Body).Error)
+	require.Empty(t, ask.in.Question)
+}
+
+func TestHandle_PathTenantRoutesFeedback(t *testing.T) {
+	resolver, err := NewTenantResolver(TenantSourcePath, map[string]string{"bob": "bob"})
+	require.NoError(t, err)
+	fb := &stubFeedback{}
+	h, err := NewHandler(&stubUseCase{}, fb, WithTenantResolver(resolver))
+	require.NoError(t, err)
+
+	event := makeFeedbackEvent(`{"rating":"down"}`)
+	event.Resource = "/t/{tenant}" + feedbackResource
+	event.PathParameters["tenant"] = "bob"
+	resp, err := h.Handle(context.Background(), event)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "bob", fb.tenant)
+	require.Equal(t, "down", fb.in.Rating)
+}
@@ -6,3 +6,33 @@ type ChatMessage struct {
 	Role    string `json:"role"`
 	Content string `json:"content"`
 }
+
+// ChatCompletion is the provider-agnostic result of a single chat call.
+type ChatCompletion struct {
+	Content string
+	Usage   Usage
+}
+
+// Usage records the tokens consumed by an LLM call and, once priced, its cost.
+type Usage struct {
+	PromptTokens     int
+	CompletionTokens int
+	CostUSD          float64
+}
+
+// Add returns the sum of u and other.
+func (u Usage) Add(other Usage) Usage {
+	return Usage{
+		PromptTokens:     u.PromptTokens + other.PromptTokens,
+		CompletionTokens: u.CompletionTokens + other.CompletionTokens,
+		CostUSD:          u.CostUSD + other.CostUSD,
+	}
+}
+
+// ModerationResult is the provider-agnostic verdict of a moderation call.
+// Category names follow the provider, e.g. "harassment" or "self-harm/intent".
+type ModerationResult struct {
+	Flagged    bool               // the provider's overall verdict
+	Categories map[string]bool    // the provider's verdict per category
+	Scores     map[string]float64 // confidence per category, from 0 to 1
+}
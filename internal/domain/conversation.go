@@ -1,12 +1,24 @@
 package domain
 
+import "errors"
+
+var (
+	// ErrTurnNotFound is returned when a referenced conversation turn does not exist.
+	ErrTurnNotFound = errors.New("domain: conversation turn not found")
+	// ErrConversationNotFound is returned when a referenced conversation does not exist.
+	ErrConversationNotFound = errors.New("domain: conversation not found")
+)
+
 // Message is a single persisted conversation turn.
 type Message struct {
 	PK             string
 	SK             string
 	ConversationID string
+	TurnID         string
 	Text           string
 	Answer         string
+	Usage          Usage
+	ProfileVersion string // profile content that produced Answer
 	TTL            int64
 }
 
@@ -17,5 +29,40 @@ type ConversationMeta struct {
 	ConversationID string
 	LastActivity   string
 	Turns          int
+	Usage          Usage // accumulated across all completed turns
+	TTL            int64
+}
+
+// Rating is a visitor's verdict on an answer.
+type Rating string
+
+const (
+	RatingUp   Rating = "up"
+	RatingDown Rating = "down"
+)
+
+// Feedback is a visitor rating attached to a completed conversation turn.
+type Feedback struct {
+	PK             string
+	SK             string
+	ConversationID string
+	TurnID         string
+	Rating         Rating
+	Comment        string
+	CreatedAt      string
 	TTL            int64
 }
+
+// Transcript is the full stored content of one conversation.
+type Transcript struct {
+	Meta     ConversationMeta
+	Messages []Message
+	Feedback []Feedback
+}
+
+// ConversationPage is one page of conversations ordered by most recent
+// activity first. NextCursor is empty on the last page.
+type ConversationPage struct {
+	Conversations []ConversationMeta
+	NextCursor    string
+}
@@ -0,0 +1,143 @@
+package domain
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrEmptyResume is returned when a resume carries no content to answer from.
+var ErrEmptyResume = errors.New("domain: resume is empty")
+
+// Resume is the subset of the JSON Resume schema (https://jsonresume.org/schema)
+// used to answer questions. Unknown fields such as "$schema" and "meta" are
+// ignored.
+type Resume struct {
+	Basics       ResumeBasics        `json:"basics"`
+	Work         []ResumeWork        `json:"work"`
+	Volunteer    []ResumeWork        `json:"volunteer"`
+	Education    []ResumeEducation   `json:"education"`
+	Awards       []ResumeAward       `json:"awards"`
+	Certificates []ResumeCertificate `json:"certificates"`
+	Publications []ResumePublication `json:"publications"`
+	Skills       []ResumeSkill       `json:"skills"`
+	Languages    []ResumeLanguage    `json:"languages"`
+	Interests    []ResumeInterest    `json:"interests"`
+	Projects     []ResumeProject     `json:"projects"`
+}
+
+// ResumeBasics is the "basics" section of a JSON Resume.
+type ResumeBasics struct {
+	Name     string          `json:"name"`
+	Label    string          `json:"label"`
+	Email    string          `json:"email"`
+	URL      string          `json:"url"`
+	Summary  string          `json:"summary"`
+	Location ResumeLocation  `json:"location"`
+	Profiles []ResumeProfile `json:"profiles"`
+}
+
+// ResumeLocation is where the resume owner is based.
+type ResumeLocation struct {
+	City        string `json:"city"`
+	Region      string `json:"region"`
+	CountryCode string `json:"countryCode"`
+}
+
+// ResumeProfile is an account on another site, e.g. GitHub.
+type ResumeProfile struct {
+	Network  string `json:"network"`
+	Username string `json:"username"`
+	URL      string `json:"url"`
+}
+
+// ResumeWork is a position in the "work" or "volunteer" section. Volunteer
+// entries name their organization instead of a company.
+type ResumeWork struct {
+	Name         string   `json:"name"`
+	Organization string   `json:"organization"`
+	Position     string   `json:"position"`
+	URL          string   `json:"url"`
+	StartDate    string   `json:"startDate"`
+	EndDate      string   `json:"endDate"`
+	Summary      string   `json:"summary"`
+	Highlights   []string `json:"highlights"`
+}
+
+// ResumeEducation is an entry of the "education" section.
+type ResumeEducation struct {
+	Institution string   `json:"institution"`
+	Area        string   `json:"area"`
+	StudyType   string   `json:"studyType"`
+	StartDate   string   `json:"startDate"`
+	EndDate     string   `json:"endDate"`
+	Score       string   `json:"score"`
+	Courses     []string `json:"courses"`
+}
+
+// ResumeAward is an entry of the "awards" section.
+type ResumeAward struct {
+	Title   string `json:"title"`
+	Date    string `json:"date"`
+	Awarder string `json:"awarder"`
+	Summary string `json:"summary"`
+}
+
+// ResumeCertificate is an entry of the "certificates" section.
+type ResumeCertificate struct {
+	Name   string `json:"name"`
+	Date   string `json:"date"`
+	Issuer string `json:"issuer"`
+	URL    string `json:"url"`
+}
+
+// ResumePublication is an entry of the "publications" section.
+type ResumePublication struct {
+	Name        string `json:"name"`
+	Publisher   string `json:"publisher"`
+	ReleaseDate string `json:"releaseDate"`
+	URL         string `json:"url"`
+	Summary     string `json:"summary"`
+}
+
+// ResumeSkill is a skill area with its keywords, e.g. "Backend": ["Go", "SQL"].
+type ResumeSkill struct {
+	Name     string   `json:"name"`
+	Level    string   `json:"level"`
+	Keywords []string `json:"keywords"`
+}
+
+// ResumeLanguage is a spoken language and fluency.
+type ResumeLanguage struct {
+	Language string `json:"language"`
+	Fluency  string `json:"fluency"`
+}
+
+// ResumeInterest is an interest with optional keywords.
+type ResumeInterest struct {
+	Name     string   `json:"name"`
+	Keywords []string `json:"keywords"`
+}
+
+// ResumeProject is an entry of the "projects" section.
+type ResumeProject struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	URL         string   `json:"url"`
+	StartDate   string   `json:"startDate"`
+	EndDate     string   `json:"endDate"`
+	Highlights  []string `json:"highlights"`
+	Keywords    []string `json:"keywords"`
+}
+
+// Validate reports ErrEmptyResume unless the resume names its owner or has at
+// least one populated section besides basics.
+func (r Resume) Validate() error {
+	if strings.TrimSpace(r.Basics.Name) != "" || strings.TrimSpace(r.Basics.Summary) != "" {
+		return nil
+	}
+	if len(r.Work)+len(r.Volunteer)+len(r.Education)+len(r.Awards)+len(r.Certificates)+
+		len(r.Publications)+len(r.Skills)+len(r.Languages)+len(r.Interests)+len(r.Projects) > 0 {
+		return nil
+	}
+	return ErrEmptyResume
+}
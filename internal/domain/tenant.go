@@ -0,0 +1,34 @@
+package domain
+
+import (
+	"context"
+	"regexp"
+)
+
+// DefaultTenant is the tenant of single-portfolio deployments. Its data uses
+// the unprefixed keys and parameters that predate multi-tenant hosting.
+const DefaultTenant = ""
+
+// tenantIDPattern keeps tenant IDs safe to embed in storage keys and
+// parameter paths.
+var tenantIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,31}$`)
+
+type tenantKey struct{}
+
+// ValidTenantID reports whether id is an acceptable non-default tenant ID:
+// 1-32 lowercase letters, digits or hyphens, not starting with a hyphen.
+func ValidTenantID(id string) bool {
+	return tenantIDPattern.MatchString(id)
+}
+
+// WithTenant returns a context scoped to the given portfolio owner.
+func WithTenant(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenantID)
+}
+
+// TenantFromContext returns the tenant a request is scoped to, or
+// DefaultTenant when none was set.
+func TenantFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(tenantKey{}).(string)
+	return id
+}
@@ -0,0 +1,224 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// keyRefreshInterval is the minimum time between two SSM reads of the API
+// keys, so that a revoked key cannot turn every request into an SSM call.
+const keyRefreshInterval = 30 * time.Second
+
+// tokenPayload is the expected JSON shape stored in SSM for the API keys:
+// either {"token": "sk-..."} or, to rotate without downtime,
+// {"tokens": ["sk-primary", "sk-secondary"]}. When both are set, token is
+// the primary key.
+type tokenPayload struct {
+	Token  string   `json:"token"`
+	Tokens []string `json:"tokens"`
+}
+
+// apiKeySet is a snapshot of the keys read from SSM. Slot 0 is the primary
+// key; generation counts the reads.
+type apiKeySet struct {
+	keys       []string
+	generation uint64
+	active     int
+}
+
+// apiKeys returns the cached keys, reading them from SSM on first use. A
+// failed read is not cached, so the next call tries again.
+func (c *Client) apiKeys(ctx context.Context) (apiKeySet, error) {
+	if set, ok := c.cachedKeySet(); ok {
+		return set, nil
+	}
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+	if set, ok := c.cachedKeySet(); ok {
+		return set, nil
+	}
+	return c.loadAPIKeys(ctx)
+}
+
+func (c *Client) cachedKeySet() (apiKeySet, bool) {
+	c.keyMu.Lock()
+	defer c.keyMu.Unlock()
+	return c.keySetLocked(), c.keys != nil
+}
+
+// refreshAPIKeys re-reads the keys after every key of set was rejected. If
+// another call refreshed them since set was taken it returns the newer keys
+// without reading SSM; if the last read is more recent than
+// keyRefreshInterval it reports false. Calls that still have working keys
+// are not held up by the read.
+func (c *Client) refreshAPIKeys(ctx context.Context, set apiKeySet) (apiKeySet, bool, error) {
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+	c.keyMu.Lock()
+	if c.keyGeneration != set.generation {
+		defer c.keyMu.Unlock()
+		return c.keySetLocked(), true, nil
+	}
+	readAt := c.keysReadAt
+	c.keyMu.Unlock()
+	if c.now().Sub(readAt) < keyRefreshInterval {
+		return apiKeySet{}, false, nil
+	}
+	next, err := c.loadAPIKeys(ctx)
+	if err != nil {
+		return apiKeySet{}, false, err
+	}
+	return next, true, nil
+}
+
+// loadAPIKeys reads the keys from SSM and swaps them in. Callers hold
+// refreshMu.
+func (c *Client) loadAPIKeys(ctx context.Context) (apiKeySet, error) {
+	c.keyMu.Lock()
+	c.keysReadAt = c.now()
+	c.keyMu.Unlock()
+	keys, err := fetchAPIKeysFromParamStore(ctx, c.getter, c.tokenParameterName())
+	if err != nil {
+		return apiKeySet{}, err
+	}
+
+	c.keyMu.Lock()
+	defer c.keyMu.Unlock()
+	if c.keyObserver != nil {
+		for _, key := range keys {
+			c.keyObserver(key)
+		}
+	}
+	c.keys = keys
+	c.keyGeneration++
+	c.activeSlot = -1
+	slog.InfoContext(ctx, "openai.api_key.loaded",
+		"event", "openai.api_key.loaded",
+		"slots", len(keys),
+		"generation", c.keyGeneration,
+	)
+	return c.keySetLocked(), nil
+}
+
+func (c *Client) keySetLocked() apiKeySet {
+	return apiKeySet{keys: c.keys, generation: c.keyGeneration, active: max(c.activeSlot, 0)}
+}
+
+// markActive makes slot of set the first key tried by later calls and logs
+// the slot whenever it changes.
+func (c *Client) markActive(ctx context.Context, set apiKeySet, slot int) {
+	c.keyMu.Lock()
+	defer c.keyMu.Unlock()
+	if c.keyGeneration != set.generation || c.activeSlot == slot {
+		return
+	}
+	c.activeSlot = slot
+	slog.InfoContext(ctx, "openai.api_key.slot",
+		"event", "openai.api_key.slot",
+		"slot", slot,
+		"generation", set.generation,
+	)
+}
+
+// withAPIKey calls send with the active API key. A 401 moves on to the next
+// slot; once every slot has been rejected the keys are re-read from SSM, at
+// most once per call, and the new keys are tried from the primary. With
+// anonymous auth send gets an empty key.
+func (c *Client) withAPIKey(ctx context.Context, send func(apiKey string) ([]byte, error)) ([]byte, error) {
+	if c.compat.AnonymousAuth {
+		return send("")
+	}
+	set, err := c.apiKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := c.trySlots(ctx, set, send)
+	if !isUnauthorized(err) {
+		return raw, err
+	}
+	next, ok, refreshErr := c.refreshAPIKeys(ctx, set)
+	if refreshErr != nil {
+		slog.WarnContext(ctx, "openai.api_key.refresh_failed",
+			"event", "openai.api_key.refresh_failed",
+			"err", refreshErr,
+		)
+		return nil, err
+	}
+	if !ok {
+		return nil, err
+	}
+	return c.trySlots(ctx, next, send)
+}
+
+// trySlots sends with each key of set from the active slot on until one is
+// not rejected with 401.
+func (c *Client) trySlots(ctx context.Context, set apiKeySet, send func(apiKey string) ([]byte, error)) ([]byte, error) {
+	var (
+		raw []byte
+		err error
+	)
+	for slot := set.active; slot < len(set.keys); slot++ {
+		raw, err = send(set.keys[slot])
+		if !isUnauthorized(err) {
+			if err == nil {
+				c.markActive(ctx, set, slot)
+			}
+			return raw, err
+		}
+		slog.WarnContext(ctx, "openai.api_key.rejected",
+			"event", "openai.api_key.rejected",
+			"slot", slot,
+			"generation", set.generation,
+		)
+	}
+	return raw, err
+}
+
+func isUnauthorized(err error) bool {
+	var statusErr *HTTPStatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusUnauthorized
+}
+
+func (c *Client) tokenParameterName() string {
+	return c.paramPrefix + "/open-ai-token"
+}
+
+// fetchAPIKeysFromParamStore reads the keys of name in slot order, dropping
+// empty and repeated keys.
+func fetchAPIKeysFromParamStore(ctx context.Context, getter Getter, name string) ([]string, error) {
+	if getter == nil {
+		return nil, errors.New("openai: paramstore getter is nil")
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, errors.New("openai: token parameter name is empty")
+	}
+
+	raw, err := getter.GetParameter(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("openai: fetch token from paramstore: %w", err)
+	}
+	var tp tokenPayload
+	if err := json.Unmarshal([]byte(raw), &tp); err != nil {
+		return nil, fmt.Errorf("openai: unmarshal paramstore token value as JSON: %w", err)
+	}
+	var keys []string
+	seen := make(map[string]bool)
+	for _, key := range append([]string{tp.Token}, tp.Tokens...) {
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("openai: API token is empty")
+	}
+	return keys, nil
+}
@@ -0,0 +1,297 @@
+package openai
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"portfolio-agent/internal/domain"
+)
+
+// keyVault stands in for the SSM parameter holding the API keys and the
+// upstream's set of valid keys, so a test can rotate both.
+type keyVault struct {
+	mu    sync.Mutex
+	value string
+	valid map[string]bool
+	reads int
+	used  []string
+	// reject answers that many requests with 401 whatever their key.
+	reject int
+	// rejectSchema answers json_schema chat requests with valid keys with 400.
+	rejectSchema bool
+	// arrive, if set, runs as each request reaches the upstream.
+	arrive func()
+	// gate, if set, holds the next SSM read until it is closed; reading is
+	// closed once that read has started.
+	gate    chan struct{}
+	reading chan struct{}
+}
+
+func (v *keyVault) GetParameter(_ context.Context, _ string) (string, error) {
+	v.mu.Lock()
+	v.reads++
+	value, gate, reading := v.value, v.gate, v.reading
+	v.gate, v.reading = nil, nil
+	v.mu.Unlock()
+	if gate != nil {
+		close(reading)
+		<-gate
+	}
+	return value, nil
+}
+
+// rotate stores value in SSM and makes the upstream accept only valid.
+func (v *keyVault) rotate(value string, valid ...string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.value = value
+	v.valid = make(map[string]bool, len(valid))
+	for _, key := range valid {
+		v.valid[key] = true
+	}
+}
+
+func (v *keyVault) readCount() int {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.reads
+}
+
+// serve answers chat and moderation requests, rejecting unknown keys with 401.
+func (v *keyVault) serve(w http.ResponseWriter, r *http.Request) {
+	if v.arrive != nil {
+		v.arrive()
+	}
+	key := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	v.mu.Lock()
+	v.used = append(v.used, key)
+	ok := v.valid[key] && v.reject == 0
+	if v.reject > 0 {
+		v.reject--
+	}
+	v.mu.Unlock()
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"error":{"message":"Incorrect API key provided","code":"invalid_api_key"}}`))
+		return
+	}
+	if strings.HasSuffix(r.URL.Path, "/moderations") {
+		writeChat(w, `{"results":[{"flagged":false}]}`)
+		return
+	}
+	if body, _ := io.ReadAll(r.Body); v.rejectSchema && strings.Contains(string(body), `"type":"json_schema"`) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":{"message":"response_format json_schema is not supported"}}`))
+		return
+	}
+	okChat(w, nil)
+}
+
+func (v *keyVault) takeUsed() []string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	used := v.used
+	v.used = nil
+	return used
+}
+
+// newRotationClient returns a client of vault whose clock the test moves.
+func newRotationClient(t *testing.T, vault *keyVault, opts ...Option) (*Client, func(time.Duration)) {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(vault.serve))
+	t.Cleanup(srv.Close)
+	clock := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	var mu sync.Mutex
+	now := func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return clock
+	}
+	c, err := NewClient(vault, "/portfolio-agent", append([]Option{WithBaseURL(srv.URL), WithClock(now)}, opts...)...)
+	require.NoError(t, err)
+	return c, func(d time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		clock = clock.Add(d)
+	}
+}
+
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return &buf
+}
+
+func rotationChat(c *Client) error {
+	_, err := c.Chat(context.Background(), "gpt-4o-mini", []domain.ChatMessage{{Role: "user", Content: "hi"}})
+	return err
+}
+
+func TestAPIKeyRotation_RefetchesOnUnauthorized(t *testing.T) {
+	vault := &keyVault{}
+	vault.rotate(`{"token":"sk-old"}`, "sk-old")
+	c, advance := newRotationClient(t, vault)
+	require.NoError(t, rotationChat(c))
+
+	vault.rotate(`{"token":"sk-new"}`, "sk-new")
+	advance(keyRefreshInterval)
+	require.NoError(t, rotationChat(c))
+	require.Equal(t, []string{"sk-old", "sk-old", "sk-new"}, vault.takeUsed())
+	require.Equal(t, 2, vault.readCount())
+
+	require.NoError(t, rotationChat(c))
+	require.Equal(t, []string{"sk-new"}, vault.takeUsed())
+	require.Equal(t, 2, vault.readCount(), "the new key is cached")
+}
+
+func TestAPIKeyRotation_RefreshIsRateLimited(t *testing.T) {
+	vault := &keyVault{}
+	vault.rotate(`{"token":"sk-old"}`, "sk-old")
+	c, advance := newRotationClient(t, vault)
+	require.NoError(t, rotationChat(c))
+
+	vault.rotate(`{"token":"sk-new"}`, "sk-new")
+	advance(keyRefreshInterval / 2)
+	err := rotationChat(c)
+	var statusErr *HTTPStatusError
+	require.ErrorAs(t, err, &statusErr)
+	require.Equal(t, http.StatusUnauthorized, statusErr.StatusCode)
+	require.Equal(t, 1, vault.readCount(), "the key was read too recently")
+
+	advance(keyRefreshInterval / 2)
+	require.NoError(t, rotationChat(c))
+	require.Equal(t, 2, vault.readCount())
+}
+
+func TestAPIKeyRotation_RefreshesOncePerRequest(t *testing.T) {
+	vault := &keyVault{}
+	vault.rotate(`{"tokens":["sk-revoked-1","sk-revoked-2"]}`, "sk-revoked-1")
+	c, advance := newRotationClient(t, vault)
+	require.NoError(t, rotationChat(c))
+	vault.takeUsed()
+
+	vault.rotate(`{"tokens":["sk-revoked-1","sk-revoked-2"]}`)
+	advance(keyRefreshInterval)
+	err := rotationChat(c)
+	var statusErr *HTTPStatusError
+	require.ErrorAs(t, err, &statusErr)
+	require.Equal(t, http.StatusUnauthorized, statusErr.StatusCode)
+	require.Equal(t, 2, vault.readCount(), "initial read and one refresh")
+	require.Equal(t, []string{"sk-revoked-1", "sk-revoked-2", "sk-revoked-1", "sk-revoked-2"}, vault.takeUsed())
+}
+
+func TestAPIKeyRotation_FallsBackToSecondarySlot(t *testing.T) {
+	logs := captureLogs(t)
+	vault := &keyVault{}
+	vault.rotate(`{"tokens":["sk-primary","sk-secondary"]}`, "sk-primary", "sk-secondary")
+	c, _ := newRotationClient(t, vault)
+	require.NoError(t, rotationChat(c))
+	require.Equal(t, []string{"sk-primary"}, vault.takeUsed())
+
+	// The primary is revoked; the secondary takes over without an SSM read.
+	vault.rotate(`{"tokens":["sk-primary","sk-secondary"]}`, "sk-secondary")
+	require.NoError(t, rotationChat(c))
+	_, err := c.Moderate(context.Background(), "hello")
+	require.NoError(t, err)
+	require.Equal(t, []string{"sk-primary", "sk-secondary", "sk-secondary"}, vault.takeUsed())
+	require.Equal(t, 1, vault.readCount())
+
+	out := logs.String()
+	require.Contains(t, out, `"msg":"openai.api_key.rejected","event":"openai.api_key.rejected","slot":0`)
+	require.Contains(t, out, `"msg":"openai.api_key.slot","event":"openai.api_key.slot","slot":1`)
+	require.NotContains(t, out, "sk-primary")
+	require.NotContains(t, out, "sk-secondary")
+}
+
+func TestAPIKeyRotation_ConcurrentRequestsDuringRotation(t *testing.T) {
+	vault := &keyVault{}
+	vault.rotate(`{"token":"sk-old"}`, "sk-old")
+	c, advance := newRotationClient(t, vault)
+	require.NoError(t, rotationChat(c))
+	vault.takeUsed()
+
+	// The key is rotated while the requests are in flight with sk-old.
+	var once sync.Once
+	vault.arrive = func() { once.Do(func() { vault.rotate(`{"token":"sk-new"}`, "sk-new") }) }
+	advance(keyRefreshInterval)
+	var wg sync.WaitGroup
+	errs := make([]error, 16)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = rotationChat(c)
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		require.NoError(t, err)
+	}
+	require.Equal(t, 2, vault.readCount(), "in-flight requests share one refresh")
+	require.Contains(t, vault.takeUsed(), "sk-old")
+}
+
+func TestAPIKeyRotation_SlowRefreshDoesNotBlockOtherRequests(t *testing.T) {
+	vault := &keyVault{}
+	vault.rotate(`{"token":"sk-live"}`, "sk-live")
+	c, advance := newRotationClient(t, vault)
+	require.NoError(t, rotationChat(c))
+
+	// One request is rejected and refreshes the keys while SSM hangs.
+	advance(keyRefreshInterval)
+	gate, reading := make(chan struct{}), make(chan struct{})
+	vault.mu.Lock()
+	vault.reject, vault.gate, vault.reading = 1, gate, reading
+	vault.mu.Unlock()
+	refreshed := make(chan error, 1)
+	go func() { refreshed <- rotationChat(c) }()
+	<-reading
+
+	done := make(chan error, 1)
+	go func() { done <- rotationChat(c) }()
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("a request with a working key waited for the SSM read")
+	}
+
+	close(gate)
+	require.NoError(t, <-refreshed)
+	require.Equal(t, 2, vault.readCount())
+}
+
+func TestAPIKeyRotation_FallbackReusesTheKey(t *testing.T) {
+	vault := &keyVault{rejectSchema: true}
+	vault.rotate(`{"tokens":["sk-primary","sk-secondary"]}`, "sk-secondary")
+	c, _ := newRotationClient(t, vault, WithCompatibility(Compatibility{StructuredOutput: StructuredOutputAuto}))
+
+	require.NoError(t, rotationChat(c))
+	require.Equal(t, []string{"sk-primary", "sk-secondary", "sk-secondary"}, vault.takeUsed(),
+		"the json_object retry is sent with the key that got past 401")
+	require.Equal(t, 1, vault.readCount())
+}
+
+func TestAPIKeyRotation_FailedReadIsNotCached(t *testing.T) {
+	vault := &keyVault{}
+	vault.rotate(`{"token":""}`)
+	c, _ := newRotationClient(t, vault)
+	require.ErrorContains(t, rotationChat(c), "API token is empty")
+
+	vault.rotate(`{"token":"sk-new"}`, "sk-new")
+	require.NoError(t, rotationChat(c))
+	require.Equal(t, 2, vault.readCount())
+}
@@ -0,0 +1,147 @@
+package openai
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// AzureConfig switches the client to Azure OpenAI. Requests go to
+// <base>/openai/deployments/{deployment}/... with an api-version query
+// parameter and authenticate with an api-key header instead of a bearer
+// token. The base URL is the resource endpoint, e.g.
+// https://my-resource.openai.azure.com.
+type AzureConfig struct {
+	// APIVersion is the api-version query parameter, e.g. "2024-10-21".
+	APIVersion string
+	// Deployments maps a configured model to the name of its deployment.
+	// Models without an entry use a deployment of the same name.
+	Deployments map[string]string
+}
+
+func (a AzureConfig) validate() error {
+	if strings.TrimSpace(a.APIVersion) == "" {
+		return errors.New("openai: azure api version must not be empty")
+	}
+	for model, deployment := range a.Deployments {
+		if strings.TrimSpace(deployment) == "" {
+			return fmt.Errorf("openai: azure deployment for model %s must not be empty", model)
+		}
+	}
+	return nil
+}
+
+// deployment returns the deployment serving model.
+func (a AzureConfig) deployment(model string) string {
+	if deployment, ok := a.Deployments[model]; ok {
+		return deployment
+	}
+	return model
+}
+
+// WithAzure talks to Azure OpenAI deployments. Azure has no Moderations
+// endpoint, so NewClient requires ModerationLocal or ModerationNone; the
+// deployment's content filters moderate as well, see ContentFilterError.
+func WithAzure(cfg AzureConfig) Option {
+	return func(c *Client) {
+		c.azure = &cfg
+	}
+}
+
+// ParseAzureDeployments decodes a JSON map of model to deployment name.
+func ParseAzureDeployments(raw string) (map[string]string, error) {
+	var deployments map[string]string
+	if err := json.Unmarshal([]byte(raw), &deployments); err != nil {
+		return nil, fmt.Errorf("openai: decode azure deployments: %w", err)
+	}
+	return deployments, nil
+}
+
+func azureChatURL(baseURL string, cfg AzureConfig, model string) string {
+	base := strings.TrimSuffix(strings.TrimRight(baseURL, "/"), "/openai")
+	return base + "/openai/deployments/" + url.PathEscape(cfg.deployment(model)) +
+		"/chat/completions?api-version=" + url.QueryEscape(cfg.APIVersion)
+}
+
+// Content filter sources.
+const (
+	ContentFilterPrompt     = "prompt"
+	ContentFilterCompletion = "completion"
+)
+
+// ContentFilterError is returned when the upstream's content filter refused
+// the prompt (Azure answers 400 with error code content_filter) or withheld
+// the completion (finish_reason content_filter).
+type ContentFilterError struct {
+	// Source is ContentFilterPrompt or ContentFilterCompletion.
+	Source string
+	// Categories are the filtered categories in Moderations API naming,
+	// sorted; empty when the upstream did not report them.
+	Categories []string
+	// Err is the underlying HTTPStatusError of a refused prompt.
+	Err error
+}
+
+func (e *ContentFilterError) Error() string {
+	return fmt.Sprintf("openai: %s filtered by content policy: %s", e.Source, strings.Join(e.Categories, ", "))
+}
+
+func (e *ContentFilterError) Unwrap() error {
+	return e.Err
+}
+
+// ContentFilterCategory returns the first filtered category, or
+// "content_filter" when none was reported.
+func (e *ContentFilterError) ContentFilterCategory() string {
+	if len(e.Categories) == 0 {
+		return "content_filter"
+	}
+	return e.Categories[0]
+}
+
+// contentFilterResults is Azure's per-category filter verdict.
+type contentFilterResults map[string]struct {
+	Filtered bool `json:"filtered"`
+}
+
+// filtered returns the filtered categories renamed to their Moderations API
+// equivalent, e.g. self_harm to self-harm.
+func (r contentFilterResults) filtered() []string {
+	var categories []string
+	for category, result := range r {
+		if result.Filtered {
+			categories = append(categories, strings.ReplaceAll(category, "_", "-"))
+		}
+	}
+	sort.Strings(categories)
+	return categories
+}
+
+// promptFilterError returns a ContentFilterError when err is a 400 response
+// whose error code is content_filter, and nil otherwise.
+func promptFilterError(err error) *ContentFilterError {
+	var statusErr *HTTPStatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusBadRequest {
+		return nil
+	}
+	var payload struct {
+		Error struct {
+			Code       string `json:"code"`
+			InnerError struct {
+				ContentFilterResult contentFilterResults `json:"content_filter_result"`
+			} `json:"innererror"`
+		} `json:"error"`
+	}
+	if json.Unmarshal([]byte(statusErr.Body), &payload) != nil || payload.Error.Code != "content_filter" {
+		return nil
+	}
+	return &ContentFilterError{
+		Source:     ContentFilterPrompt,
+		Categories: payload.Error.InnerError.ContentFilterResult.filtered(),
+		Err:        statusErr,
+	}
+}
@@ -0,0 +1,199 @@
+package openai
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"portfolio-agent/internal/domain"
+)
+
+// azureServer answers Azure chat requests with respond and records each
+// request URL and the api-key and Authorization headers.
+type azureServer struct {
+	*httptest.Server
+	mu      sync.Mutex
+	urls    []string
+	apiKeys []string
+	authz   []string
+}
+
+func newAzureServer(t *testing.T, respond func(w http.ResponseWriter)) *azureServer {
+	t.Helper()
+	as := &azureServer{}
+	as.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		as.mu.Lock()
+		as.urls = append(as.urls, r.URL.String())
+		as.apiKeys = append(as.apiKeys, r.Header.Get("api-key"))
+		as.authz = append(as.authz, r.Header.Get("Authorization"))
+		as.mu.Unlock()
+		respond(w)
+	}))
+	t.Cleanup(as.Close)
+	return as
+}
+
+// newAzureClient returns an Azure client of srv. Moderation is off unless
+// opts set another Compatibility.
+func newAzureClient(t *testing.T, srv *httptest.Server, cfg AzureConfig, opts ...Option) *Client {
+	t.Helper()
+	opts = append([]Option{WithBaseURL(srv.URL), WithAzure(cfg), WithCompatibility(Compatibility{Moderation: ModerationNone})}, opts...)
+	c, err := NewClient(&fakeGetter{val: `{"token":"azure-key"}`}, "/portfolio-agent", opts...)
+	require.NoError(t, err)
+	return c
+}
+
+func azureChat(c *Client, model string) (domain.ChatCompletion, error) {
+	return c.Chat(context.Background(), model, []domain.ChatMessage{{Role: "user", Content: "hi"}})
+}
+
+func TestNewClient_RejectsInvalidAzureConfig(t *testing.T) {
+	for name, cfg := range map[string]AzureConfig{
+		"missing api version": {},
+		"empty deployment":    {APIVersion: "2024-10-21", Deployments: map[string]string{"gpt-4o-mini": " "}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewClient(&fakeGetter{}, "/portfolio-agent", WithAzure(cfg),
+				WithCompatibility(Compatibility{Moderation: ModerationNone}))
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestNewClient_AzureRequiresLocalOrNoModeration(t *testing.T) {
+	cfg := AzureConfig{APIVersion: "2024-10-21"}
+	for _, mode := range []string{"", ModerationAPI} {
+		_, err := NewClient(&fakeGetter{}, "/portfolio-agent", WithAzure(cfg),
+			WithCompatibility(Compatibility{Moderation: mode}))
+		require.ErrorContains(t, err, "moderation must be local or none", mode)
+	}
+
+	logs := captureLogs(t)
+	_, err := NewClient(&fakeGetter{}, "/portfolio-agent", WithAzure(cfg),
+		WithCompatibility(Compatibility{Moderation: ModerationNone}))
+	require.NoError(t, err)
+	require.Contains(t, logs.String(), `"msg":"openai.moderation.disabled","event":"openai.moderation.disabled","azure":true`)
+}
+
+func TestAzure_DeploymentURLAndAPIKey(t *testing.T) {
+	srv := newAzureServer(t, func(w http.ResponseWriter) { okChat(w, nil) })
+	c := newAzureClient(t, srv.Server, AzureConfig{
+		APIVersion:  "2024-10-21",
+		Deployments: map[string]string{"gpt-4o-mini": "portfolio-mini"},
+	})
+
+	out, err := azureChat(c, "gpt-4o-mini")
+	require.NoError(t, err)
+	require.JSONEq(t, `{"in_scope":true,"answer":"Go"}`, out.Content)
+	_, err = azureChat(c, "gpt-4o")
+	require.NoError(t, err)
+
+	require.Equal(t, []string{
+		"/openai/deployments/portfolio-mini/chat/completions?api-version=2024-10-21",
+		"/openai/deployments/gpt-4o/chat/completions?api-version=2024-10-21",
+	}, srv.urls, "unmapped models use a deployment of the same name")
+	require.Equal(t, []string{"azure-key", "azure-key"}, srv.apiKeys)
+	require.Equal(t, []string{"", ""}, srv.authz, "no bearer token is sent")
+}
+
+func TestAzureChatURL_BaseURLForms(t *testing.T) {
+	cfg := AzureConfig{APIVersion: "2024-10-21"}
+	want := "https://res.openai.azure.com/openai/deployments/gpt-4o/chat/completions?api-version=2024-10-21"
+	for _, base := range []string{"https://res.openai.azure.com", "https://res.openai.azure.com/", "https://res.openai.azure.com/openai"} {
+		require.Equal(t, want, azureChatURL(base, cfg, "gpt-4o"), base)
+	}
+}
+
+func TestAzure_AnonymousAuthSendsNoKey(t *testing.T) {
+	srv := newAzureServer(t, func(w http.ResponseWriter) { okChat(w, nil) })
+	c := newAzureClient(t, srv.Server, AzureConfig{APIVersion: "2024-10-21"}, WithCompatibility(Compatibility{AnonymousAuth: true, Moderation: ModerationNone}))
+
+	_, err := azureChat(c, "gpt-4o")
+	require.NoError(t, err)
+	require.Equal(t, []string{""}, srv.apiKeys)
+}
+
+func TestAzure_PromptContentFilter(t *testing.T) {
+	const body = `{"error":{"message":"The response was filtered due to the prompt triggering Azure OpenAI's content management policy.",` +
+		`"param":"prompt","code":"content_filter","status":400,"innererror":{"code":"ResponsibleAIPolicyViolation","content_filter_result":{` +
+		`"hate":{"filtered":false,"severity":"safe"},"self_harm":{"filtered":true,"severity":"medium"},` +
+		`"sexual":{"filtered":false,"severity":"safe"},"violence":{"filtered":true,"severity":"high"}}}}}`
+	srv := newAzureServer(t, func(w http.ResponseWriter) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(body))
+	})
+	c := newAzureClient(t, srv.Server, AzureConfig{APIVersion: "2024-10-21"},
+		WithCompatibility(Compatibility{StructuredOutput: StructuredOutputAuto, Moderation: ModerationNone}))
+
+	_, err := azureChat(c, "gpt-4o")
+	var filterErr *ContentFilterError
+	require.ErrorAs(t, err, &filterErr)
+	require.Equal(t, ContentFilterPrompt, filterErr.Source)
+	require.Equal(t, []string{"self-harm", "violence"}, filterErr.Categories)
+	require.Equal(t, "self-harm", filterErr.ContentFilterCategory())
+	var statusErr *HTTPStatusError
+	require.ErrorAs(t, err, &statusErr, "the upstream status stays reachable")
+	require.Len(t, srv.urls, 1, "a filtered prompt is not retried as json_object")
+}
+
+func TestAzure_CompletionContentFilter(t *testing.T) {
+	srv := newAzureServer(t, func(w http.ResponseWriter) {
+		writeChat(w, `{"choices":[{"index":0,"finish_reason":"content_filter","message":{"role":"assistant","content":""},`+
+			`"content_filter_results":{"hate":{"filtered":true,"severity":"medium"},"violence":{"filtered":false,"severity":"safe"}}}]}`)
+	})
+	c := newAzureClient(t, srv.Server, AzureConfig{APIVersion: "2024-10-21"})
+
+	_, err := azureChat(c, "gpt-4o")
+	var filterErr *ContentFilterError
+	require.ErrorAs(t, err, &filterErr)
+	require.Equal(t, ContentFilterCompletion, filterErr.Source)
+	require.Equal(t, []string{"hate"}, filterErr.Categories)
+}
+
+func TestAzure_OtherBadRequestsAreStatusErrors(t *testing.T) {
+	srv := newAzureServer(t, func(w http.ResponseWriter) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":{"code":"DeploymentNotFound","message":"The API deployment for this resource does not exist."}}`))
+	})
+	c := newAzureClient(t, srv.Server, AzureConfig{APIVersion: "2024-10-21"})
+
+	_, err := azureChat(c, "gpt-4o")
+	var filterErr *ContentFilterError
+	require.False(t, errors.As(err, &filterErr))
+	var statusErr *HTTPStatusError
+	require.ErrorAs(t, err, &statusErr)
+	require.Equal(t, http.StatusBadRequest, statusErr.StatusCode)
+}
+
+func TestAzure_Moderation(t *testing.T) {
+	srv := newAzureServer(t, func(w http.ResponseWriter) { w.WriteHeader(http.StatusNotFound) })
+
+	c := newAzureClient(t, srv.Server, AzureConfig{APIVersion: "2024-10-21"})
+	result, err := c.Moderate(context.Background(), "you idiot")
+	require.NoError(t, err)
+	require.False(t, result.Flagged, "moderation is explicitly off")
+
+	moderator, err := NewPatternModerator(map[string][]string{"harassment": {`\bidiot\b`}})
+	require.NoError(t, err)
+	c = newAzureClient(t, srv.Server, AzureConfig{APIVersion: "2024-10-21"},
+		WithCompatibility(Compatibility{Moderation: ModerationLocal, Moderator: moderator}))
+	result, err = c.Moderate(context.Background(), "you idiot")
+	require.NoError(t, err)
+	require.True(t, result.Flagged)
+
+	require.Empty(t, srv.urls, "the upstream is never called")
+}
+
+func TestParseAzureDeployments(t *testing.T) {
+	deployments, err := ParseAzureDeployments(`{"gpt-4o-mini":"portfolio-mini"}`)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"gpt-4o-mini": "portfolio-mini"}, deployments)
+
+	_, err = ParseAzureDeployments(`["gpt-4o-mini"]`)
+	require.Error(t, err)
+}
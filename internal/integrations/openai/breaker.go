@@ -0,0 +1,204 @@
+package openai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Circuit breaker states.
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half_open"
+)
+
+// Breaker log events. They are stable: CloudWatch metric filters count them.
+const (
+	eventBreakerOpened     = "openai.breaker.opened"
+	eventBreakerHalfOpened = "openai.breaker.half_opened"
+	eventBreakerClosed     = "openai.breaker.closed"
+	eventBreakerRejected   = "openai.breaker.rejected"
+)
+
+// transitionEvents names the event logged on entering each state.
+var transitionEvents = map[string]string{
+	CircuitOpen:     eventBreakerOpened,
+	CircuitHalfOpen: eventBreakerHalfOpened,
+	CircuitClosed:   eventBreakerClosed,
+}
+
+// BreakerConfig tunes the circuit breaker shared by Chat and Moderate.
+type BreakerConfig struct {
+	// Window is the period over which the failure rate is measured.
+	Window time.Duration
+	// MinRequests is the number of calls in a window before it can trip.
+	MinRequests int
+	// FailureRatio trips the breaker when failures/calls in the window reach it.
+	FailureRatio float64
+	// CoolDown is how long the breaker stays open before a single probe call
+	// is let through.
+	CoolDown time.Duration
+}
+
+// DefaultBreakerConfig trips after half of at least 5 calls within 30 seconds
+// fail, and probes again after 15 seconds.
+var DefaultBreakerConfig = BreakerConfig{
+	Window:       30 * time.Second,
+	MinRequests:  5,
+	FailureRatio: 0.5,
+	CoolDown:     15 * time.Second,
+}
+
+// CircuitOpenError is returned without calling the upstream while the
+// breaker is open.
+type CircuitOpenError struct {
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("openai: circuit open, retry after %s", e.RetryAfter)
+}
+
+// CircuitOpen reports that the call was rejected by the circuit breaker.
+func (e *CircuitOpenError) CircuitOpen() bool {
+	return true
+}
+
+// callOutcome classifies a finished upstream call for the breaker.
+type callOutcome int
+
+const (
+	outcomeSuccess callOutcome = iota
+	outcomeFailure
+	// outcomeIgnored is a call the caller cancelled; it says nothing about
+	// upstream health. A call that ran out its deadline is a failure.
+	outcomeIgnored
+)
+
+// breaker is a closed/open/half-open circuit breaker. Its state lives in the
+// Client and so is per Lambda container.
+type breaker struct {
+	cfg BreakerConfig
+	now func() time.Time
+
+	mu          sync.Mutex
+	state       string
+	windowStart time.Time
+	calls       int
+	failures    int
+	openedAt    time.Time
+	probing     bool
+}
+
+func newBreaker(cfg BreakerConfig, now func() time.Time) *breaker {
+	return &breaker{cfg: cfg, now: now, state: CircuitClosed}
+}
+
+// allow reports whether a call may proceed. The caller must report the
+// outcome of an allowed call through done.
+func (b *breaker) allow(ctx context.Context, op string) (done func(callOutcome), err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	if b.state == CircuitOpen {
+		if wait := b.openedAt.Add(b.cfg.CoolDown).Sub(now); wait > 0 {
+			slog.InfoContext(ctx, eventBreakerRejected, "event", eventBreakerRejected, "operation", op)
+			return nil, &CircuitOpenError{RetryAfter: wait}
+		}
+		b.transition(ctx, CircuitHalfOpen)
+	}
+	if b.state == CircuitHalfOpen {
+		if b.probing {
+			slog.InfoContext(ctx, eventBreakerRejected, "event", eventBreakerRejected, "operation", op)
+			return nil, &CircuitOpenError{RetryAfter: b.cfg.CoolDown}
+		}
+		b.probing = true
+	}
+	return func(o callOutcome) { b.record(ctx, o) }, nil
+}
+
+func (b *breaker) record(ctx context.Context, o callOutcome) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	if b.state == CircuitHalfOpen {
+		b.probing = false
+		switch o {
+		case outcomeSuccess:
+			b.transition(ctx, CircuitClosed)
+			b.resetWindow(now)
+		case outcomeFailure:
+			b.openedAt = now
+			b.transition(ctx, CircuitOpen)
+		}
+		return
+	}
+	if b.state != CircuitClosed || o == outcomeIgnored {
+		return
+	}
+
+	if now.Sub(b.windowStart) >= b.cfg.Window {
+		b.resetWindow(now)
+	}
+	b.calls++
+	if o == outcomeFailure {
+		b.failures++
+	}
+	if b.calls >= b.cfg.MinRequests && float64(b.failures)/float64(b.calls) >= b.cfg.FailureRatio {
+		b.openedAt = now
+		b.transition(ctx, CircuitOpen)
+	}
+}
+
+func (b *breaker) resetWindow(now time.Time) {
+	b.windowStart = now
+	b.calls = 0
+	b.failures = 0
+}
+
+// transition changes state and logs the event of the new state; callers
+// hold b.mu.
+func (b *breaker) transition(ctx context.Context, to string) {
+	from := b.state
+	b.state = to
+	event := transitionEvents[to]
+	slog.WarnContext(ctx, event,
+		"event", event,
+		"from", from,
+		"to", to,
+		"window_calls", b.calls,
+		"window_failures", b.failures,
+	)
+}
+
+func (b *breaker) currentState() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// outcomeOf classifies the result of an upstream call. Transport errors,
+// deadlines and 5xx responses count as failures; other statuses show the
+// upstream is up. Only calls cancelled by the caller are ignored.
+func outcomeOf(ctx context.Context, err error) callOutcome {
+	if err == nil {
+		return outcomeSuccess
+	}
+	var statusErr *HTTPStatusError
+	if errors.As(err, &statusErr) {
+		if statusErr.StatusCode >= 500 {
+			return outcomeFailure
+		}
+		return outcomeSuccess
+	}
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return outcomeIgnored
+	}
+	return outcomeFailure
+}
@@ -0,0 +1,261 @@
+package openai
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"portfolio-agent/internal/domain"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func testBreakerConfig() BreakerConfig {
+	return BreakerConfig{Window: 10 * time.Second, MinRequests: 4, FailureRatio: 0.5, CoolDown: 5 * time.Second}
+}
+
+func requireCircuitOpen(t *testing.T, err error) {
+	t.Helper()
+	var open *CircuitOpenError
+	require.ErrorAs(t, err, &open)
+}
+
+// upstream serves status for every call and counts the calls it received.
+type upstream struct {
+	status atomic.Int32
+	calls  atomic.Int32
+}
+
+func newBreakerClient(t *testing.T, up *upstream, clock *fakeClock) *Client {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		up.calls.Add(1)
+		status := int(up.status.Load())
+		w.WriteHeader(status)
+		if status != http.StatusOK {
+			return
+		}
+		if r.URL.Path == "/v1/moderations" {
+			_, _ = w.Write([]byte(`{"results":[{"flagged":false}]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"choices":[{"index":0,"message":{"role":"assistant","content":"ok"}}]}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	return newTestClient(t, srv, WithCircuitBreaker(testBreakerConfig()), WithClock(clock.Now))
+}
+
+func TestBreaker_OpensOnFailureRateAndFailsFast(t *testing.T) {
+	up := &upstream{}
+	up.status.Store(http.StatusOK)
+	clock := newFakeClock()
+	c := newBreakerClient(t, up, clock)
+	ctx := context.Background()
+
+	_, err := c.Moderate(ctx, "hi")
+	require.NoError(t, err)
+	_, err = c.Moderate(ctx, "hi")
+	require.NoError(t, err)
+
+	up.status.Store(http.StatusServiceUnavailable)
+	_, err = c.Chat(ctx, "gpt-mock", nil)
+	require.Error(t, err)
+	require.Equal(t, CircuitClosed, c.breaker.currentState(), "1 of 3 failed: below minimum calls")
+	_, err = c.Moderate(ctx, "hi")
+	require.Error(t, err)
+	require.Equal(t, CircuitOpen, c.breaker.currentState(), "2 of 4 failed")
+
+	// Both operations now fail fast without reaching the upstream.
+	calls := up.calls.Load()
+	_, err = c.Chat(ctx, "gpt-mock", nil)
+	requireCircuitOpen(t, err)
+	_, err = c.Moderate(ctx, "hi")
+	requireCircuitOpen(t, err)
+	require.Equal(t, calls, up.calls.Load())
+
+	var open *CircuitOpenError
+	require.ErrorAs(t, err, &open)
+	require.Equal(t, 5*time.Second, open.RetryAfter)
+}
+
+func TestBreaker_HalfOpenProbe(t *testing.T) {
+	up := &upstream{}
+	up.status.Store(http.StatusBadGateway)
+	clock := newFakeClock()
+	c := newBreakerClient(t, up, clock)
+	ctx := context.Background()
+
+	for i := 0; i < 4; i++ {
+		_, _ = c.Moderate(ctx, "hi")
+	}
+	require.Equal(t, CircuitOpen, c.breaker.currentState())
+
+	// A failed probe re-opens the breaker for another cool-down.
+	clock.Advance(5 * time.Second)
+	_, err := c.Moderate(ctx, "hi")
+	require.Error(t, err)
+	require.False(t, errors.As(err, new(*CircuitOpenError)), "probe reached the upstream")
+	require.Equal(t, CircuitOpen, c.breaker.currentState())
+	clock.Advance(4 * time.Second)
+	_, err = c.Moderate(ctx, "hi")
+	requireCircuitOpen(t, err)
+
+	// Only one probe is let through while half-open.
+	clock.Advance(time.Second)
+	done, err := c.breaker.allow(ctx, "moderate")
+	require.NoError(t, err)
+	require.Equal(t, CircuitHalfOpen, c.breaker.currentState())
+	_, err = c.Moderate(ctx, "hi")
+	requireCircuitOpen(t, err)
+	done(outcomeIgnored)
+	require.Equal(t, CircuitHalfOpen, c.breaker.currentState())
+
+	// A successful probe closes it.
+	up.status.Store(http.StatusOK)
+	_, err = c.Chat(ctx, "gpt-mock", nil)
+	require.NoError(t, err)
+	require.Equal(t, CircuitClosed, c.breaker.currentState())
+	_, err = c.Moderate(ctx, "hi")
+	require.NoError(t, err)
+}
+
+func TestBreaker_LogsStableEvents(t *testing.T) {
+	logs := captureLogs(t)
+	up := &upstream{}
+	up.status.Store(http.StatusBadGateway)
+	clock := newFakeClock()
+	c := newBreakerClient(t, up, clock)
+	ctx := context.Background()
+
+	for i := 0; i < 4; i++ {
+		_, _ = c.Moderate(ctx, "hi")
+	}
+	_, err := c.Chat(ctx, "gpt-mock", nil)
+	requireCircuitOpen(t, err)
+	clock.Advance(5 * time.Second)
+	up.status.Store(http.StatusOK)
+	_, err = c.Moderate(ctx, "hi")
+	require.NoError(t, err)
+
+	out := logs.String()
+	require.Contains(t, out, `"msg":"openai.breaker.opened","event":"openai.breaker.opened","from":"closed","to":"open"`)
+	require.Contains(t, out, `"msg":"openai.breaker.rejected","event":"openai.breaker.rejected","operation":"chat"`)
+	require.Contains(t, out, `"event":"openai.breaker.half_opened","from":"open","to":"half_open"`)
+	require.Contains(t, out, `"event":"openai.breaker.closed","from":"half_open","to":"closed"`)
+}
+
+func TestBreaker_FailuresOutsideWindowDoNotTrip(t *testing.T) {
+	up := &upstream{}
+	up.status.Store(http.StatusInternalServerError)
+	clock := newFakeClock()
+	c := newBreakerClient(t, up, clock)
+
+	for i := 0; i < 6; i++ {
+		_, _ = c.Moderate(context.Background(), "hi")
+		if i%3 == 2 {
+			clock.Advance(10 * time.Second)
+		}
+	}
+	require.Equal(t, CircuitClosed, c.breaker.currentState())
+}
+
+func TestBreaker_ClientErrorsAndCancellationsDoNotTrip(t *testing.T) {
+	up := &upstream{}
+	up.status.Store(http.StatusTooManyRequests)
+	c := newBreakerClient(t, up, newFakeClock())
+
+	for i := 0; i < 6; i++ {
+		_, err := c.Chat(context.Background(), "gpt-mock", []domain.ChatMessage{{Role: "user", Content: "hi"}})
+		require.Error(t, err)
+	}
+	require.Equal(t, CircuitClosed, c.breaker.currentState())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for i := 0; i < 6; i++ {
+		_, err := c.Moderate(ctx, "hi")
+		require.ErrorIs(t, err, context.Canceled)
+	}
+	require.Equal(t, CircuitClosed, c.breaker.currentState())
+}
+
+func TestBreaker_DeadlinesTrip(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	t.Cleanup(srv.Close)
+	c := newTestClient(t, srv, WithCircuitBreaker(testBreakerConfig()), WithClock(newFakeClock().Now))
+
+	for i := 0; i < 4; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		_, err := c.Moderate(ctx, "hi")
+		cancel()
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	}
+	require.Equal(t, CircuitOpen, c.breaker.currentState(), "a hanging upstream opens the breaker")
+	_, err := c.Moderate(context.Background(), "hi")
+	requireCircuitOpen(t, err)
+}
+
+func TestBreaker_ClientTimeoutsTrip(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	t.Cleanup(srv.Close)
+	c, err := NewClient(&fakeGetter{val: `{"token":"sk-test"}`}, "/portfolio-agent",
+		WithBaseURL(srv.URL),
+		WithHTTPClient(&http.Client{Timeout: 20 * time.Millisecond}),
+		WithCircuitBreaker(testBreakerConfig()),
+	)
+	require.NoError(t, err)
+
+	// No context deadline: only the client timeout bounds the calls.
+	for i := 0; i < 4; i++ {
+		_, err = c.Moderate(context.Background(), "hi")
+		require.Error(t, err)
+	}
+	_, err = c.Moderate(context.Background(), "hi")
+	requireCircuitOpen(t, err)
+}
+
+func TestBreaker_TransportErrorsTrip(t *testing.T) {
+	c, err := NewClient(&fakeGetter{val: `{"token":"sk-test"}`}, "/portfolio-agent",
+		WithBaseURL("http://127.0.0.1:1"),
+		WithCircuitBreaker(testBreakerConfig()),
+	)
+	require.NoError(t, err)
+
+	for i := 0; i < 4; i++ {
+		_, err = c.Moderate(context.Background(), "hi")
+		require.Error(t, err)
+	}
+	_, err = c.Moderate(context.Background(), "hi")
+	requireCircuitOpen(t, err)
+}
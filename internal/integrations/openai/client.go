@@ -7,9 +7,11 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"portfolio-agent/internal/domain"
@@ -21,11 +23,13 @@ type chatRequest struct {
 	Messages       []domain.ChatMessage `json:"messages"`
 	Temperature    *float64             `json:"temperature,omitempty"`
 	ResponseFormat *responseFormat      `json:"response_format,omitempty"`
+	// GuidedJSON is the grammar constraint of StructuredOutputGuidedJSON.
+	GuidedJSON json.RawMessage `json:"guided_json,omitempty"`
 }
 
 type responseFormat struct {
-	Type       string           `json:"type"`
-	JSONSchema jsonSchemaConfig `json:"json_schema"`
+	Type       string            `json:"type"`
+	JSONSchema *jsonSchemaConfig `json:"json_schema,omitempty"`
 }
 
 type jsonSchemaConfig struct {
@@ -34,15 +38,29 @@ type jsonSchemaConfig struct {
 	Schema json.RawMessage `json:"schema"`
 }
 
-// chatResponse is the minimal response shape returned by the Chat Completions endpoint.
+// chatResponse is the minimal response shape returned by the Chat Completions
+// endpoint. Choices may carry the legacy completions text instead of a
+// message, and some compatible servers report errors with a 200 status.
 type chatResponse struct {
 	ID      string `json:"id"`
 	Object  string `json:"object"`
 	Created int64  `json:"created"`
 	Choices []struct {
-		Index   int                `json:"index"`
-		Message domain.ChatMessage `json:"message"`
+		Index   int `json:"index"`
+		Message struct {
+			Role    string         `json:"role"`
+			Content messageContent `json:"content"`
+		} `json:"message"`
+		Text                 string               `json:"text"`
+		FinishReason         string               `json:"finish_reason"`
+		ContentFilterResults contentFilterResults `json:"content_filter_results"`
 	} `json:"choices"`
+	Error *upstreamError `json:"error"`
+	Usage struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+		TotalTokens      int `json:"total_tokens"`
+	} `json:"usage"`
 }
 
 // moderationRequest is the request shape for the Moderations endpoint.
@@ -53,15 +71,12 @@ type moderationRequest struct {
 // moderationResponse is the minimal response shape for the Moderations endpoint.
 type moderationResponse struct {
 	Results []struct {
-		Flagged bool `json:"flagged"`
+		Flagged        bool               `json:"flagged"`
+		Categories     map[string]bool    `json:"categories"`
+		CategoryScores map[string]float64 `json:"category_scores"`
 	} `json:"results"`
 }
 
-// tokenPayload is the expected JSON shape stored in SSM for the API token.
-type tokenPayload struct {
-	Token string `json:"token"`
-}
-
 type Getter interface {
 	GetParameter(ctx context.Context, name string) (string, error)
 }
@@ -88,9 +103,27 @@ type Client struct {
 	getter      Getter
 	paramPrefix string
 
-	keyOnce sync.Once
-	apiKey  string
-	keyErr  error
+	// keyMu guards the API keys and their rotation state; see withAPIKey.
+	// refreshMu lets one call at a time read the keys from SSM, without
+	// holding keyMu during the read.
+	keyMu         sync.Mutex
+	refreshMu     sync.Mutex
+	keys          []string
+	keyGeneration uint64
+	activeSlot    int
+	keysReadAt    time.Time
+	keyObserver   func(key string)
+	now           func() time.Time
+
+	breakerCfg BreakerConfig
+	breaker    *breaker
+
+	compat Compatibility
+	// azure is set by WithAzure.
+	azure *AzureConfig
+	// schemaRejected is set once the server rejects json_schema in
+	// StructuredOutputAuto mode.
+	schemaRejected atomic.Bool
 }
 
 type Option func(*Client)
@@ -107,9 +140,34 @@ func WithHTTPClient(httpClient *http.Client) Option {
 	}
 }
 
+// WithKeyObserver calls observe with the API key once it has been fetched,
+// e.g. to register it with a log redactor.
+func WithKeyObserver(observe func(key string)) Option {
+	return func(c *Client) {
+		c.keyObserver = observe
+	}
+}
+
+// WithCircuitBreaker replaces DefaultBreakerConfig. While the breaker is open,
+// Chat and Moderate fail fast with a *CircuitOpenError instead of waiting for
+// the HTTP timeout.
+func WithCircuitBreaker(cfg BreakerConfig) Option {
+	return func(c *Client) {
+		c.breakerCfg = cfg
+	}
+}
+
+// WithClock replaces time.Now as the clock of the circuit breaker and of the
+// API key refresh interval.
+func WithClock(now func() time.Time) Option {
+	return func(c *Client) {
+		c.now = now
+	}
+}
+
 // NewClient creates a new Client backed by the given paramstore.Getter for
-// API key retrieval. The key is fetched from SSM on the first call to Chat or
-// Moderate and reused for the lifetime of the process.
+// API key retrieval. The keys are fetched from SSM on the first call to Chat
+// or Moderate and reused until the upstream rejects them with 401.
 func NewClient(ps Getter, paramPrefix string, opts ...Option) (*Client, error) {
 	if ps == nil {
 		return nil, errors.New("openai: paramstore getter must not be nil")
@@ -123,26 +181,33 @@ func NewClient(ps Getter, paramPrefix string, opts ...Option) (*Client, error) {
 		httpClient:  &http.Client{Timeout: 10 * time.Second},
 		getter:      ps,
 		paramPrefix: paramPrefix,
+		breakerCfg:  DefaultBreakerConfig,
+		now:         time.Now,
 	}
 	for _, opt := range opts {
 		opt(c)
 	}
+	if err := c.compat.validate(); err != nil {
+		return nil, err
+	}
+	if c.azure != nil {
+		if err := c.azure.validate(); err != nil {
+			return nil, err
+		}
+		if c.compat.Moderation != ModerationLocal && c.compat.Moderation != ModerationNone {
+			return nil, errors.New("openai: azure has no moderations endpoint; moderation must be local or none")
+		}
+	}
+	if c.compat.Moderation == ModerationNone {
+		slog.Warn("openai.moderation.disabled",
+			"event", "openai.moderation.disabled",
+			"azure", c.azure != nil,
+		)
+	}
+	c.breaker = newBreaker(c.breakerCfg, c.now)
 	return c, nil
 }
 
-// resolveAPIKey fetches the API apiKey from SSM on the first call and returns the
-// cached result on every subsequent call within the same process lifetime.
-func (c *Client) resolveAPIKey(ctx context.Context) (string, error) {
-	c.keyOnce.Do(func() {
-		c.apiKey, c.keyErr = fetchAPIKeyFromParamStore(ctx, c.getter, c.tokenParameterName())
-	})
-	return c.apiKey, c.keyErr
-}
-
-func (c *Client) tokenParameterName() string {
-	return c.paramPrefix + "/open-ai-token"
-}
-
 // httpClient returns the configured HTTP client, or a default with a 10s timeout
 // if none was set (e.g. in tests that nil out the field).
 func (c *Client) resolvedHTTPClient() *http.Client {
@@ -163,70 +228,147 @@ func chatURL(baseURL string) string {
 	return base + "/v1/chat/completions"
 }
 
-func (c *Client) Chat(ctx context.Context, model string, messages []domain.ChatMessage) (string, error) {
+// Chat calls the Chat Completions API and returns the first choice together
+// with the token usage reported by the upstream.
+func (c *Client) Chat(ctx context.Context, model string, messages []domain.ChatMessage) (domain.ChatCompletion, error) {
 	if model == "" {
-		return "", errors.New("openai: model must not be empty")
+		return domain.ChatCompletion{}, errors.New("openai: model must not be empty")
+	}
+
+	// The json_object fallback reuses the key of the rejected attempt, so a
+	// request reads the keys from SSM at most once.
+	raw, err := c.withAPIKey(ctx, func(apiKey string) ([]byte, error) {
+		mode := c.structuredOutputMode()
+		raw, err := c.postChat(ctx, apiKey, model, messages, mode)
+		var statusErr *HTTPStatusError
+		if mode == StructuredOutputJSONSchema && c.compat.StructuredOutput == StructuredOutputAuto && promptFilterError(err) == nil &&
+			errors.As(err, &statusErr) && (statusErr.StatusCode == http.StatusBadRequest || statusErr.StatusCode == http.StatusUnprocessableEntity) {
+			c.schemaRejected.Store(true)
+			slog.WarnContext(ctx, "openai.structured_output.fallback",
+				"event", "openai.structured_output.fallback",
+				"from", StructuredOutputJSONSchema,
+				"to", StructuredOutputJSONObject,
+				"status", statusErr.StatusCode,
+			)
+			raw, err = c.postChat(ctx, apiKey, model, messages, StructuredOutputJSONObject)
+		}
+		return raw, err
+	})
+	if filterErr := promptFilterError(err); filterErr != nil {
+		return domain.ChatCompletion{}, fmt.Errorf("openai: request failed: %w", filterErr)
 	}
-
-	apiKey, err := c.resolveAPIKey(ctx)
 	if err != nil {
-		return "", err
+		return domain.ChatCompletion{}, fmt.Errorf("openai: request failed: %w", err)
 	}
 
-	body, err := json.Marshal(chatRequest{
-		Model:          model,
-		Messages:       messages,
-		ResponseFormat: scopedAnswerResponseFormat(),
-	})
-	if err != nil {
-		return "", fmt.Errorf("openai: marshal request: %w", err)
+	var payload chatResponse
+	if decErr := json.Unmarshal(raw, &payload); decErr != nil {
+		return domain.ChatCompletion{}, fmt.Errorf("openai: decode response: %w", decErr)
+	}
+	if payload.Error != nil && len(payload.Choices) == 0 {
+		return domain.ChatCompletion{}, fmt.Errorf("openai: error in response: %s", payload.Error.Message)
+	}
+	if len(payload.Choices) == 0 {
+		return domain.ChatCompletion{}, errors.New("openai: no choices in response")
+	}
+	if payload.Choices[0].FinishReason == "content_filter" {
+		return domain.ChatCompletion{}, &ContentFilterError{
+			Source:     ContentFilterCompletion,
+			Categories: payload.Choices[0].ContentFilterResults.filtered(),
+		}
+	}
+	content := string(payload.Choices[0].Message.Content)
+	if content == "" {
+		content = payload.Choices[0].Text
 	}
 
-	url := chatURL(c.baseURL)
+	return domain.ChatCompletion{
+		Content: content,
+		Usage: domain.Usage{
+			PromptTokens:     payload.Usage.PromptTokens,
+			CompletionTokens: payload.Usage.CompletionTokens,
+		},
+	}, nil
+}
 
-	req, reqErr := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
-	if reqErr != nil {
-		return "", fmt.Errorf("openai: create request: %w", reqErr)
+// structuredOutputMode returns the mode of the next chat request.
+func (c *Client) structuredOutputMode() string {
+	switch c.compat.StructuredOutput {
+	case "", StructuredOutputAuto:
+		if c.schemaRejected.Load() {
+			return StructuredOutputJSONObject
+		}
+		return StructuredOutputJSONSchema
+	default:
+		return c.compat.StructuredOutput
 	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+apiKey)
+}
 
-	raw, err := c.doJSONRequest(req, url)
+// postChat sends one chat request asking for the scoped answer in mode.
+func (c *Client) postChat(ctx context.Context, apiKey, model string, messages []domain.ChatMessage, mode string) ([]byte, error) {
+	chatReq := chatRequest{Model: model, Messages: messages}
+	switch mode {
+	case StructuredOutputJSONObject:
+		chatReq.ResponseFormat = &responseFormat{Type: "json_object"}
+	case StructuredOutputGuidedJSON:
+		chatReq.GuidedJSON = scopedAnswerSchema
+	default:
+		chatReq.ResponseFormat = scopedAnswerResponseFormat()
+	}
+	body, err := json.Marshal(chatReq)
 	if err != nil {
-		return "", fmt.Errorf("openai: request failed: %w", err)
+		return nil, fmt.Errorf("openai: marshal request: %w", err)
 	}
 
-	var payload chatResponse
-	if decErr := json.Unmarshal(raw, &payload); decErr != nil {
-		return "", fmt.Errorf("openai: decode response: %w", decErr)
+	url := chatURL(c.baseURL)
+	if c.azure != nil {
+		url = azureChatURL(c.baseURL, *c.azure, model)
 	}
-	if len(payload.Choices) == 0 {
-		return "", errors.New("openai: no choices in response")
+
+	req, reqErr := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if reqErr != nil {
+		return nil, fmt.Errorf("openai: create request: %w", reqErr)
 	}
-	result := payload.Choices[0].Message.Content
+	req.Header.Set("Content-Type", "application/json")
+	c.setAuthorization(req, apiKey)
 
-	return result, nil
+	return c.doJSONRequest(req, url, "chat")
 }
 
+// scopedAnswerSchema is the JSON schema of the scoped answer.
+var scopedAnswerSchema = json.RawMessage(`{
+	"type":"object",
+	"additionalProperties":false,
+	"properties":{
+		"in_scope":{"type":"boolean"},
+		"answer":{"type":"string"}
+	},
+	"required":["in_scope","answer"]
+}`)
+
 func scopedAnswerResponseFormat() *responseFormat {
 	return &responseFormat{
 		Type: "json_schema",
-		JSONSchema: jsonSchemaConfig{
+		JSONSchema: &jsonSchemaConfig{
 			Name:   "scoped_answer",
 			Strict: true,
-			Schema: json.RawMessage(`{
-				"type":"object",
-				"additionalProperties":false,
-				"properties":{
-					"in_scope":{"type":"boolean"},
-					"answer":{"type":"string"}
-				},
-				"required":["in_scope","answer"]
-			}`),
+			Schema: scopedAnswerSchema,
 		},
 	}
 }
 
+// setAuthorization sets the bearer token, or the api-key header for Azure,
+// unless auth is anonymous.
+func (c *Client) setAuthorization(req *http.Request, apiKey string) {
+	switch {
+	case apiKey == "":
+	case c.azure != nil:
+		req.Header.Set("api-key", apiKey)
+	default:
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+}
+
 func moderationURL(baseURL string) string {
 	base := strings.TrimRight(baseURL, "/")
 	if base == "" {
@@ -238,45 +380,66 @@ func moderationURL(baseURL string) string {
 	return base + "/v1/moderations"
 }
 
-// Moderate calls the OpenAI Moderations API and returns true if the input is flagged.
-func (c *Client) Moderate(ctx context.Context, input string) (bool, error) {
-	apiKey, err := c.resolveAPIKey(ctx)
-	if err != nil {
-		return false, err
+// Moderate calls the OpenAI Moderations API and returns its overall verdict
+// together with the flag and score of every category. Depending on the
+// Compatibility moderation mode it instead passes every input or asks the
+// local Moderator.
+func (c *Client) Moderate(ctx context.Context, input string) (domain.ModerationResult, error) {
+	switch c.compat.Moderation {
+	case ModerationNone:
+		return domain.ModerationResult{}, nil
+	case ModerationLocal:
+		return c.compat.Moderator.Moderate(ctx, input)
 	}
 
 	body, err := json.Marshal(moderationRequest{Input: input})
 	if err != nil {
-		return false, fmt.Errorf("openai: marshal moderation request: %w", err)
+		return domain.ModerationResult{}, fmt.Errorf("openai: marshal moderation request: %w", err)
 	}
 
 	url := moderationURL(c.baseURL)
 
-	req, reqErr := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
-	if reqErr != nil {
-		return false, fmt.Errorf("openai: create moderation request: %w", reqErr)
-	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+apiKey)
-
-	raw, err := c.doJSONRequest(req, url)
+	raw, err := c.withAPIKey(ctx, func(apiKey string) ([]byte, error) {
+		req, reqErr := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+		if reqErr != nil {
+			return nil, fmt.Errorf("openai: create moderation request: %w", reqErr)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		c.setAuthorization(req, apiKey)
+		return c.doJSONRequest(req, url, "moderate")
+	})
 	if err != nil {
-		return false, fmt.Errorf("openai: moderation request failed: %w", err)
+		return domain.ModerationResult{}, fmt.Errorf("openai: moderation request failed: %w", err)
 	}
 
 	var payload moderationResponse
 	if decErr := json.Unmarshal(raw, &payload); decErr != nil {
-		return false, fmt.Errorf("openai: decode moderation response: %w", decErr)
+		return domain.ModerationResult{}, fmt.Errorf("openai: decode moderation response: %w", decErr)
 	}
 	if len(payload.Results) == 0 {
-		return false, errors.New("openai: no results in moderation response")
+		return domain.ModerationResult{}, errors.New("openai: no results in moderation response")
 	}
-	flagged := payload.Results[0].Flagged
+	result := payload.Results[0]
+
+	return domain.ModerationResult{
+		Flagged:    result.Flagged,
+		Categories: result.Categories,
+		Scores:     result.CategoryScores,
+	}, nil
+}
 
-	return flagged, nil
+// doJSONRequest sends req through the circuit breaker.
+func (c *Client) doJSONRequest(req *http.Request, url, op string) ([]byte, error) {
+	done, err := c.breaker.allow(req.Context(), op)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := c.send(req, url)
+	done(outcomeOf(req.Context(), err))
+	return raw, err
 }
 
-func (c *Client) doJSONRequest(req *http.Request, url string) ([]byte, error) {
+func (c *Client) send(req *http.Request, url string) ([]byte, error) {
 	res, doErr := c.resolvedHTTPClient().Do(req)
 	if doErr != nil {
 		return nil, doErr
@@ -298,26 +461,3 @@ func (c *Client) doJSONRequest(req *http.Request, url string) ([]byte, error) {
 	}
 	return buf, nil
 }
-
-func fetchAPIKeyFromParamStore(ctx context.Context, getter Getter, name string) (string, error) {
-	if getter == nil {
-		return "", errors.New("openai: paramstore getter is nil")
-	}
-	name = strings.TrimSpace(name)
-	if name == "" {
-		return "", errors.New("openai: token parameter name is empty")
-	}
-
-	raw, err := getter.GetParameter(ctx, name)
-	if err != nil {
-		return "", fmt.Errorf("openai: fetch token from paramstore: %w", err)
-	}
-	var tp tokenPayload
-	if err := json.Unmarshal([]byte(raw), &tp); err != nil {
-		return "", fmt.Errorf("openai: unmarshal paramstore token value as JSON: %w", err)
-	}
-	if tp.Token == "" {
-		return "", fmt.Errorf("openai: API token is empty")
-	}
-	return tp.Token, nil
-}
@@ -10,6 +10,10 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 
 	"portfolio-agent/internal/domain"
 )
@@ -52,29 +56,41 @@ func TestNewClient_Valid(t *testing.T) {
 }
 
 // ---------------------------------------------------------------------------
-// resolveAPIKey — SSM caching behaviour
+// apiKeys — SSM caching behaviour
 // ---------------------------------------------------------------------------
 
-func TestResolveAPIKey_FetchedOnFirstCall(t *testing.T) {
+func TestAPIKeys_FetchedOnFirstCall(t *testing.T) {
 	calls := 0
 	g := &fakeGetter{val: `{"token":"sk-from-ssm"}`}
 	g.onCall = func() { calls++ }
 	c, err := NewClient(g, "/portfolio-agent")
 	require.NoError(t, err)
 
-	key, err := c.resolveAPIKey(context.Background())
+	set, err := c.apiKeys(context.Background())
 	require.NoError(t, err)
-	require.Equal(t, "sk-from-ssm", key)
+	require.Equal(t, []string{"sk-from-ssm"}, set.keys)
 	require.Equal(t, 1, calls)
 
-	// subsequent calls must never hit SSM again
-	_, _ = c.resolveAPIKey(context.Background())
-	_, _ = c.resolveAPIKey(context.Background())
-	require.Equal(t, 1, calls, "SSM must only be called once per process lifetime")
+	// subsequent calls must not hit SSM again until a key is rejected
+	_, _ = c.apiKeys(context.Background())
+	_, _ = c.apiKeys(context.Background())
+	require.Equal(t, 1, calls, "SSM must only be called once while the key is accepted")
+}
+
+func TestAPIKeys_NotifiesKeyObserverOnce(t *testing.T) {
+	var observed []string
+	c, err := NewClient(&fakeGetter{val: `{"token":"sk-from-ssm"}`}, "/portfolio-agent",
+		WithKeyObserver(func(key string) { observed = append(observed, key) }),
+	)
+	require.NoError(t, err)
+
+	_, _ = c.apiKeys(context.Background())
+	_, _ = c.apiKeys(context.Background())
+	require.Equal(t, []string{"sk-from-ssm"}, observed)
 }
 
 // ---------------------------------------------------------------------------
-// fetchAPIKeyFromParamStore
+// fetchAPIKeysFromParamStore
 // ---------------------------------------------------------------------------
 
 // fakeGetter is a minimal paramstore.Getter stub for use within this package.
@@ -93,41 +109,57 @@ func (f *fakeGetter) GetParameter(_ context.Context, _ string) (string, error) {
 
 func TestFetchAPIKey_JSONToken(t *testing.T) {
 	g := &fakeGetter{val: `{"token":"sk-from-json"}`}
-	key, err := fetchAPIKeyFromParamStore(context.Background(), g, "/portfolio-agent/open-ai-token")
+	keys, err := fetchAPIKeysFromParamStore(context.Background(), g, "/portfolio-agent/open-ai-token")
 	require.NoError(t, err)
-	require.Equal(t, "sk-from-json", key)
+	require.Equal(t, []string{"sk-from-json"}, keys)
+}
+
+func TestFetchAPIKey_JSONTokenList(t *testing.T) {
+	g := &fakeGetter{val: `{"tokens":["sk-primary","","sk-secondary","sk-primary"]}`}
+	keys, err := fetchAPIKeysFromParamStore(context.Background(), g, "/portfolio-agent/open-ai-token")
+	require.NoError(t, err)
+	require.Equal(t, []string{"sk-primary", "sk-secondary"}, keys)
+
+	g = &fakeGetter{val: `{"token":"sk-primary","tokens":["sk-secondary"]}`}
+	keys, err = fetchAPIKeysFromParamStore(context.Background(), g, "/portfolio-agent/open-ai-token")
+	require.NoError(t, err)
+	require.Equal(t, []string{"sk-primary", "sk-secondary"}, keys)
+
+	g = &fakeGetter{val: `{"tokens":[]}`}
+	_, err = fetchAPIKeysFromParamStore(context.Background(), g, "/portfolio-agent/open-ai-token")
+	require.ErrorContains(t, err, "API token is empty")
 }
 
 func TestFetchAPIKey_JSONMissingTokenField(t *testing.T) {
 	g := &fakeGetter{val: `{"other":"value"}`}
-	_, err := fetchAPIKeyFromParamStore(context.Background(), g, "/portfolio-agent/open-ai-token")
+	_, err := fetchAPIKeysFromParamStore(context.Background(), g, "/portfolio-agent/open-ai-token")
 	require.Error(t, err)
 	require.Contains(t, err.Error(), "API token is empty")
 }
 
 func TestFetchAPIKey_MalformedJSON(t *testing.T) {
 	g := &fakeGetter{val: `{"broken`}
-	_, err := fetchAPIKeyFromParamStore(context.Background(), g, "/portfolio-agent/open-ai-token")
+	_, err := fetchAPIKeysFromParamStore(context.Background(), g, "/portfolio-agent/open-ai-token")
 	require.Error(t, err)
 	require.Contains(t, err.Error(), "unmarshal")
 }
 
 func TestFetchAPIKey_GetterError(t *testing.T) {
 	g := &fakeGetter{err: errors.New("ssm unavailable")}
-	_, err := fetchAPIKeyFromParamStore(context.Background(), g, "/portfolio-agent/open-ai-token")
+	_, err := fetchAPIKeysFromParamStore(context.Background(), g, "/portfolio-agent/open-ai-token")
 	require.Error(t, err)
 	require.Contains(t, err.Error(), "ssm unavailable")
 }
 
 func TestFetchAPIKey_NilGetter(t *testing.T) {
-	_, err := fetchAPIKeyFromParamStore(context.Background(), nil, "/portfolio-agent/open-ai-token")
+	_, err := fetchAPIKeysFromParamStore(context.Background(), nil, "/portfolio-agent/open-ai-token")
 	require.Error(t, err)
 	require.Contains(t, err.Error(), "nil")
 }
 
 func TestFetchAPIKey_EmptyName(t *testing.T) {
 	g := &fakeGetter{val: `{"token":"sk-from-json"}`}
-	_, err := fetchAPIKeyFromParamStore(context.Background(), g, " ")
+	_, err := fetchAPIKeysFromParamStore(context.Background(), g, " ")
 	require.Error(t, err)
 	require.Contains(t, err.Error(), "empty")
 }
@@ -136,14 +168,13 @@ func TestFetchAPIKey_EmptyName(t *testing.T) {
 // Client.Chat
 // ---------------------------------------------------------------------------
 
-func newTestClient(t *testing.T, srv *httptest.Server) *Client {
+func newTestClient(t *testing.T, srv *httptest.Server, opts ...Option) *Client {
 	t.Helper()
-	c, err := NewClient(
-		&fakeGetter{val: `{"token":"sk-test"}`},
-		"/portfolio-agent",
+	opts = append([]Option{
 		WithBaseURL(srv.URL),
 		WithHTTPClient(&http.Client{Timeout: 2 * time.Second}),
-	)
+	}, opts...)
+	c, err := NewClient(&fakeGetter{val: `{"token":"sk-test"}`}, "/portfolio-agent", opts...)
 	require.NoError(t, err)
 	return c
 }
@@ -166,7 +197,8 @@ func TestClient_Chat_HappyPath(t *testing.T) {
 			"choices": [{
 				"index": 0,
 				"message": { "role": "assistant", "content": "Hello from mock" }
-			}]
+			}],
+			"usage": { "prompt_tokens": 120, "completion_tokens": 30, "total_tokens": 150 }
 		}`))
 	}))
 	defer srv.Close()
@@ -174,7 +206,22 @@ func TestClient_Chat_HappyPath(t *testing.T) {
 	c := newTestClient(t, srv)
 	resp, err := c.Chat(context.Background(), "gpt-mock", []domain.ChatMessage{{Role: "user", Content: "hi"}})
 	require.NoError(t, err)
-	require.Equal(t, "Hello from mock", resp)
+	require.Equal(t, "Hello from mock", resp.Content)
+	require.Equal(t, domain.Usage{PromptTokens: 120, CompletionTokens: 30}, resp.Usage)
+}
+
+func TestClient_Chat_MissingUsage(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+		_, _ = w.Write([]byte(`{"choices":[{"index":0,"message":{"role":"assistant","content":"ok"}}]}`))
+	}))
+	defer srv.Close()
+
+	c := newTestClient(t, srv)
+	resp, err := c.Chat(context.Background(), "gpt-mock", []domain.ChatMessage{{Role: "user", Content: "hi"}})
+	require.NoError(t, err)
+	require.Equal(t, "ok", resp.Content)
+	require.Zero(t, resp.Usage)
 }
 
 func TestClient_Chat_Non200(t *testing.T) {
@@ -324,23 +371,35 @@ func TestClient_Moderate_NotFlagged(t *testing.T) {
 	defer srv.Close()
 
 	c := newTestClient(t, srv)
-	flagged, err := c.Moderate(context.Background(), "What technologies do you use?")
+	result, err := c.Moderate(context.Background(), "What technologies do you use?")
 	require.NoError(t, err)
-	require.False(t, flagged)
+	require.False(t, result.Flagged)
 }
 
 func TestClient_Moderate_Flagged(t *testing.T) {
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(200)
-		_, _ = w.Write([]byte(`{"results":[{"flagged":true}]}`))
+		_, _ = w.Write([]byte(`{
+			"id": "modr-0d9740456c391e43c445bf0f010940c7",
+			"model": "omni-moderation-latest",
+			"results": [{
+				"flagged": true,
+				"categories": {"harassment": true, "harassment/threatening": false, "violence": false},
+				"category_scores": {"harassment": 0.8189, "harassment/threatening": 0.0421, "violence": 0.0053},
+				"category_applied_input_types": {"harassment": ["text"]}
+			}]
+		}`))
 	}))
 	defer srv.Close()
 
 	c := newTestClient(t, srv)
-	flagged, err := c.Moderate(context.Background(), "some unsafe content")
+	result, err := c.Moderate(context.Background(), "some unsafe content")
 	require.NoError(t, err)
-	require.True(t, flagged)
+	require.True(t, result.Flagged)
+	require.Equal(t, map[string]bool{"harassment": true, "harassment/threatening": false, "violence": false}, result.Categories)
+	require.InDelta(t, 0.8189, result.Scores["harassment"], 1e-9)
+	require.InDelta(t, 0.0421, result.Scores["harassment/threatening"], 1e-9)
 }
 
 func TestClient_Moderate_429(t *testing.T) {
@@ -394,3 +453,46 @@ func TestClient_Moderate_EmptyResults(t *testing.T) {
 	require.Error(t, err)
 	require.Contains(t, err.Error(), "no results")
 }
+
+// ---------------------------------------------------------------------------
+// Instrumented HTTP client
+// ---------------------------------------------------------------------------
+
+func TestClient_Chat_InstrumentedHTTPClientPropagatesTrace(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec))
+
+	var gotTraceparent string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotTraceparent = r.Header.Get("traceparent")
+		w.WriteHeader(200)
+		_, _ = w.Write([]byte(`{"choices":[{"index":0,"message":{"role":"assistant","content":"ok"}}]}`))
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(
+		&fakeGetter{val: `{"token":"sk-test"}`},
+		"/portfolio-agent",
+		WithBaseURL(srv.URL),
+		WithHTTPClient(&http.Client{
+			Timeout: 2 * time.Second,
+			Transport: otelhttp.NewTransport(http.DefaultTransport,
+				otelhttp.WithTracerProvider(tp),
+				otelhttp.WithPropagators(propagation.TraceContext{}),
+			),
+		}),
+	)
+	require.NoError(t, err)
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "parent")
+	_, err = c.Chat(ctx, "gpt-mock", []domain.ChatMessage{{Role: "user", Content: "hi"}})
+	parent.End()
+	require.NoError(t, err)
+
+	spans := rec.Ended()
+	require.Len(t, spans, 2)
+	client := spans[0]
+	require.Equal(t, parent.SpanContext().SpanID(), client.Parent().SpanID())
+	require.Contains(t, gotTraceparent, parent.SpanContext().TraceID().String())
+	require.Contains(t, gotTraceparent, client.SpanContext().SpanID().String())
+}
@@ -0,0 +1,185 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"portfolio-agent/internal/domain"
+)
+
+// Structured output modes, i.e. how the scoped answer schema is requested.
+const (
+	// StructuredOutputJSONSchema sends the schema as a strict json_schema
+	// response format. It is the default and what OpenAI supports.
+	StructuredOutputJSONSchema = "json_schema"
+	// StructuredOutputJSONObject requests JSON mode only; the prompt carries
+	// the output contract.
+	StructuredOutputJSONObject = "json_object"
+	// StructuredOutputGuidedJSON sends the schema as a guided_json
+	// grammar constraint, as understood by vLLM.
+	StructuredOutputGuidedJSON = "guided_json"
+	// StructuredOutputAuto sends json_schema and falls back to json_object for
+	// the rest of the process once the server rejects it with 400 or 422.
+	StructuredOutputAuto = "auto"
+)
+
+// Moderation modes.
+const (
+	// ModerationAPI calls the /v1/moderations endpoint. It is the default.
+	ModerationAPI = "api"
+	// ModerationNone skips moderation; every input passes unflagged.
+	ModerationNone = "none"
+	// ModerationLocal classifies inputs with Compatibility.Moderator instead
+	// of calling the upstream.
+	ModerationLocal = "local"
+)
+
+// Compatibility adapts the client to OpenAI-compatible servers such as
+// Ollama or vLLM. The zero value talks to OpenAI itself.
+type Compatibility struct {
+	// AnonymousAuth sends requests without an Authorization header, so no
+	// token is read from SSM.
+	AnonymousAuth bool
+	// StructuredOutput is one of the StructuredOutput* modes; empty means
+	// StructuredOutputJSONSchema.
+	StructuredOutput string
+	// Moderation is one of the Moderation* modes; empty means ModerationAPI.
+	Moderation string
+	// Moderator classifies inputs when Moderation is ModerationLocal.
+	Moderator Moderator
+}
+
+func (c Compatibility) validate() error {
+	switch c.StructuredOutput {
+	case "", StructuredOutputJSONSchema, StructuredOutputJSONObject, StructuredOutputGuidedJSON, StructuredOutputAuto:
+	default:
+		return fmt.Errorf("openai: unknown structured output mode %q", c.StructuredOutput)
+	}
+	switch c.Moderation {
+	case "", ModerationAPI, ModerationNone:
+	case ModerationLocal:
+		if c.Moderator == nil {
+			return errors.New("openai: local moderation requires a moderator")
+		}
+	default:
+		return fmt.Errorf("openai: unknown moderation mode %q", c.Moderation)
+	}
+	return nil
+}
+
+// WithCompatibility configures auth, structured output and moderation for
+// servers that implement only part of the OpenAI API.
+func WithCompatibility(compat Compatibility) Option {
+	return func(c *Client) {
+		c.compat = compat
+	}
+}
+
+// Moderator classifies text in place of the Moderations API.
+type Moderator interface {
+	Moderate(ctx context.Context, input string) (domain.ModerationResult, error)
+}
+
+// PatternModerator is a local classifier that flags a category when the
+// input matches one of its case-insensitive regular expressions.
+type PatternModerator struct {
+	categories []string
+	patterns   map[string][]*regexp.Regexp
+}
+
+// NewPatternModerator compiles patterns keyed by moderation category, e.g.
+// {"harassment": ["\\bidiot\\b"], "violence": ["\\bhurt you\\b"]}.
+func NewPatternModerator(patterns map[string][]string) (*PatternModerator, error) {
+	m := &PatternModerator{patterns: make(map[string][]*regexp.Regexp, len(patterns))}
+	for category, exprs := range patterns {
+		if strings.TrimSpace(category) == "" {
+			return nil, errors.New("openai: moderation pattern category must not be empty")
+		}
+		for _, expr := range exprs {
+			re, err := regexp.Compile("(?i)" + expr)
+			if err != nil {
+				return nil, fmt.Errorf("openai: moderation pattern for %s: %w", category, err)
+			}
+			m.patterns[category] = append(m.patterns[category], re)
+		}
+		m.categories = append(m.categories, category)
+	}
+	sort.Strings(m.categories)
+	return m, nil
+}
+
+// ParsePatternModerator builds a PatternModerator from its JSON form; see
+// NewPatternModerator.
+func ParsePatternModerator(raw string) (*PatternModerator, error) {
+	var patterns map[string][]string
+	if err := json.Unmarshal([]byte(raw), &patterns); err != nil {
+		return nil, fmt.Errorf("openai: decode moderation patterns: %w", err)
+	}
+	return NewPatternModerator(patterns)
+}
+
+// Moderate reports every category with a matching pattern as flagged, with
+// a score of 1.
+func (m *PatternModerator) Moderate(_ context.Context, input string) (domain.ModerationResult, error) {
+	result := domain.ModerationResult{
+		Categories: make(map[string]bool, len(m.categories)),
+		Scores:     make(map[string]float64, len(m.categories)),
+	}
+	for _, category := range m.categories {
+		matched := false
+		for _, re := range m.patterns[category] {
+			if re.MatchString(input) {
+				matched = true
+				break
+			}
+		}
+		result.Categories[category] = matched
+		if matched {
+			result.Scores[category] = 1
+			result.Flagged = true
+		} else {
+			result.Scores[category] = 0
+		}
+	}
+	return result, nil
+}
+
+// messageContent is an assistant message content. Besides the usual string
+// it accepts null and the array-of-parts form some servers return.
+type messageContent string
+
+func (m *messageContent) UnmarshalJSON(b []byte) error {
+	var s *string
+	if err := json.Unmarshal(b, &s); err == nil {
+		if s != nil {
+			*m = messageContent(*s)
+		}
+		return nil
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(b, &parts); err != nil {
+		return fmt.Errorf("message content is neither a string nor an array of parts: %w", err)
+	}
+	var sb strings.Builder
+	for _, p := range parts {
+		if p.Type == "" || p.Type == "text" || p.Type == "output_text" {
+			sb.WriteString(p.Text)
+		}
+	}
+	*m = messageContent(sb.String())
+	return nil
+}
+
+// upstreamError is the error object some servers return with a 200 status.
+type upstreamError struct {
+	Message string `json:"message"`
+	Type    string `json:"type"`
+}
@@ -0,0 +1,215 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"portfolio-agent/internal/domain"
+)
+
+const scopedContent = `{\"in_scope\":true,\"answer\":\"Go\"}`
+
+// recordingServer answers chat requests with respond and records each
+// request body and Authorization header.
+type recordingServer struct {
+	*httptest.Server
+	mu      sync.Mutex
+	bodies  []map[string]json.RawMessage
+	authz   []string
+	paths   []string
+	respond func(w http.ResponseWriter, body map[string]json.RawMessage)
+}
+
+func newRecordingServer(t *testing.T, respond func(w http.ResponseWriter, body map[string]json.RawMessage)) *recordingServer {
+	t.Helper()
+	rs := &recordingServer{respond: respond}
+	rs.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]json.RawMessage
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		rs.mu.Lock()
+		rs.bodies = append(rs.bodies, body)
+		rs.authz = append(rs.authz, r.Header.Get("Authorization"))
+		rs.paths = append(rs.paths, r.URL.Path)
+		rs.mu.Unlock()
+		rs.respond(w, body)
+	}))
+	t.Cleanup(rs.Close)
+	return rs
+}
+
+func writeChat(w http.ResponseWriter, payload string) {
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write([]byte(payload))
+}
+
+func okChat(w http.ResponseWriter, _ map[string]json.RawMessage) {
+	writeChat(w, `{"choices":[{"index":0,"message":{"role":"assistant","content":"`+scopedContent+`"}}]}`)
+}
+
+func newCompatClient(t *testing.T, srv *httptest.Server, compat Compatibility, getter Getter) *Client {
+	t.Helper()
+	if getter == nil {
+		getter = &fakeGetter{val: `{"token":"sk-test"}`}
+	}
+	c, err := NewClient(getter, "/portfolio-agent", WithBaseURL(srv.URL), WithCompatibility(compat))
+	require.NoError(t, err)
+	return c
+}
+
+func chatOnce(t *testing.T, c *Client) domain.ChatCompletion {
+	t.Helper()
+	out, err := c.Chat(context.Background(), "llama3.1", []domain.ChatMessage{{Role: "user", Content: "hi"}})
+	require.NoError(t, err)
+	return out
+}
+
+func TestNewClient_RejectsInvalidCompatibility(t *testing.T) {
+	for name, compat := range map[string]Compatibility{
+		"unknown structured output": {StructuredOutput: "xml"},
+		"unknown moderation":        {Moderation: "llama-guard"},
+		"local without a moderator": {Moderation: ModerationLocal},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewClient(&fakeGetter{}, "/portfolio-agent", WithCompatibility(compat))
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestCompat_AnonymousAuth(t *testing.T) {
+	srv := newRecordingServer(t, okChat)
+	calls := 0
+	getter := &fakeGetter{onCall: func() { calls++ }}
+	c := newCompatClient(t, srv.Server, Compatibility{AnonymousAuth: true}, getter)
+
+	chatOnce(t, c)
+	require.Zero(t, calls, "no token is read from SSM")
+	require.Equal(t, []string{""}, srv.authz)
+}
+
+func TestCompat_StructuredOutputModes(t *testing.T) {
+	t.Run("json_object", func(t *testing.T) {
+		srv := newRecordingServer(t, okChat)
+		chatOnce(t, newCompatClient(t, srv.Server, Compatibility{StructuredOutput: StructuredOutputJSONObject}, nil))
+
+		require.JSONEq(t, `{"type":"json_object"}`, string(srv.bodies[0]["response_format"]))
+		require.NotContains(t, srv.bodies[0], "guided_json")
+	})
+	t.Run("guided_json", func(t *testing.T) {
+		srv := newRecordingServer(t, okChat)
+		chatOnce(t, newCompatClient(t, srv.Server, Compatibility{StructuredOutput: StructuredOutputGuidedJSON}, nil))
+
+		require.NotContains(t, srv.bodies[0], "response_format")
+		require.JSONEq(t, string(scopedAnswerSchema), string(srv.bodies[0]["guided_json"]))
+	})
+}
+
+func TestCompat_AutoFallsBackToJSONMode(t *testing.T) {
+	srv := newRecordingServer(t, func(w http.ResponseWriter, body map[string]json.RawMessage) {
+		var format responseFormat
+		_ = json.Unmarshal(body["response_format"], &format)
+		if format.Type == "json_schema" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":{"message":"response_format json_schema is not supported"}}`))
+			return
+		}
+		okChat(w, body)
+	})
+	c := newCompatClient(t, srv.Server, Compatibility{StructuredOutput: StructuredOutputAuto}, nil)
+
+	require.JSONEq(t, `{"in_scope":true,"answer":"Go"}`, chatOnce(t, c).Content)
+	require.Len(t, srv.bodies, 2, "rejected json_schema request and its json_object retry")
+
+	chatOnce(t, c)
+	require.Len(t, srv.bodies, 3, "later requests go straight to json_object")
+	require.JSONEq(t, `{"type":"json_object"}`, string(srv.bodies[2]["response_format"]))
+}
+
+func TestCompat_AutoDoesNotFallBackOnServerErrors(t *testing.T) {
+	srv := newRecordingServer(t, func(w http.ResponseWriter, _ map[string]json.RawMessage) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	c := newCompatClient(t, srv.Server, Compatibility{StructuredOutput: StructuredOutputAuto}, nil)
+
+	_, err := c.Chat(context.Background(), "llama3.1", []domain.ChatMessage{{Role: "user", Content: "hi"}})
+	var statusErr *HTTPStatusError
+	require.ErrorAs(t, err, &statusErr)
+	require.Len(t, srv.bodies, 1)
+}
+
+func TestCompat_DefaultModeDoesNotFallBack(t *testing.T) {
+	srv := newRecordingServer(t, func(w http.ResponseWriter, _ map[string]json.RawMessage) {
+		w.WriteHeader(http.StatusBadRequest)
+	})
+	c := newCompatClient(t, srv.Server, Compatibility{}, nil)
+
+	_, err := c.Chat(context.Background(), "gpt-4o-mini", []domain.ChatMessage{{Role: "user", Content: "hi"}})
+	require.Error(t, err)
+	require.Len(t, srv.bodies, 1)
+}
+
+func TestCompat_ToleratesResponseShapes(t *testing.T) {
+	cases := map[string]string{
+		"content parts":     `{"choices":[{"message":{"role":"assistant","content":[{"type":"text","text":"{\"in_scope\":true,"},{"type":"text","text":"\"answer\":\"Go\"}"}]}}]}`,
+		"legacy text":       `{"choices":[{"index":0,"text":"` + scopedContent + `","finish_reason":"stop"}]}`,
+		"no usage, no role": `{"choices":[{"message":{"content":"` + scopedContent + `"}}]}`,
+	}
+	for name, payload := range cases {
+		t.Run(name, func(t *testing.T) {
+			srv := newRecordingServer(t, func(w http.ResponseWriter, _ map[string]json.RawMessage) { writeChat(w, payload) })
+			out := chatOnce(t, newCompatClient(t, srv.Server, Compatibility{}, nil))
+			require.JSONEq(t, `{"in_scope":true,"answer":"Go"}`, out.Content)
+			require.Equal(t, domain.Usage{}, out.Usage)
+		})
+	}
+}
+
+func TestCompat_ErrorObjectWithOKStatus(t *testing.T) {
+	srv := newRecordingServer(t, func(w http.ResponseWriter, _ map[string]json.RawMessage) {
+		writeChat(w, `{"error":{"message":"model \"llama3.1\" not found, try pulling it first","type":"api_error"}}`)
+	})
+	_, err := newCompatClient(t, srv.Server, Compatibility{}, nil).Chat(context.Background(), "llama3.1", []domain.ChatMessage{{Role: "user", Content: "hi"}})
+	require.ErrorContains(t, err, "not found, try pulling it first")
+}
+
+func TestCompat_ModerationModes(t *testing.T) {
+	srv := newRecordingServer(t, func(w http.ResponseWriter, _ map[string]json.RawMessage) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	t.Run("none", func(t *testing.T) {
+		c := newCompatClient(t, srv.Server, Compatibility{Moderation: ModerationNone}, nil)
+		result, err := c.Moderate(context.Background(), "you idiot")
+		require.NoError(t, err)
+		require.False(t, result.Flagged)
+	})
+	t.Run("local", func(t *testing.T) {
+		moderator, err := ParsePatternModerator(`{"harassment":["\\bidiot\\b"],"violence":["hurt you"]}`)
+		require.NoError(t, err)
+		c := newCompatClient(t, srv.Server, Compatibility{Moderation: ModerationLocal, Moderator: moderator}, nil)
+
+		result, err := c.Moderate(context.Background(), "You IDIOT")
+		require.NoError(t, err)
+		require.True(t, result.Flagged)
+		require.Equal(t, map[string]bool{"harassment": true, "violence": false}, result.Categories)
+		require.Equal(t, 1.0, result.Scores["harassment"])
+
+		result, err = c.Moderate(context.Background(), "What do you work on?")
+		require.NoError(t, err)
+		require.False(t, result.Flagged)
+	})
+	require.Empty(t, srv.paths, "the upstream is never called")
+}
+
+func TestParsePatternModerator_Invalid(t *testing.T) {
+	for _, raw := range []string{`not json`, `{"harassment":["("]}`, `{"":["x"]}`} {
+		_, err := ParsePatternModerator(raw)
+		require.Error(t, err, raw)
+	}
+}
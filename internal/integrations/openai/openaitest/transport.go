@@ -0,0 +1,277 @@
+// Package openaitest provides an HTTP transport that records OpenAI API
+// exchanges to a fixture file and replays them in tests, so clients can be
+// exercised against realistic responses without network access.
+//
+// Fixtures are replayed by default. Setting OPENAI_RECORD=1 makes New send
+// requests to the real API and rewrite the fixture when the test passes;
+// OPENAI_API_KEY then replaces the key the client under test sends.
+package openaitest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+const (
+	// RecordEnv selects record mode in New when set to a non-empty value.
+	RecordEnv = "OPENAI_RECORD"
+	// APIKeyEnv holds the API key sent in record mode.
+	APIKeyEnv = "OPENAI_API_KEY"
+
+	scrubbed = "[scrubbed]"
+)
+
+// scrubbedHeaders are never written to a fixture.
+var scrubbedHeaders = []string{"Authorization", "Cookie", "Set-Cookie", "Openai-Organization", "Openai-Project"}
+
+// fixture is the file format: the exchanges of one test, in request order.
+// Synthetic marks a hand-written fixture that follows the documented API
+// shapes but was never sent to the API; recorded fixtures leave it unset.
+type fixture struct {
+	Synthetic    bool          `json:"synthetic,omitempty"`
+	Interactions []interaction `json:"interactions"`
+}
+
+type interaction struct {
+	Request  recordedRequest  `json:"request"`
+	Response recordedResponse `json:"response"`
+}
+
+// recordedRequest is matched on Method, Path and BodySHA256. Header and Body
+// are kept for reading the fixture.
+type recordedRequest struct {
+	Method     string          `json:"method"`
+	Path       string          `json:"path"`
+	BodySHA256 string          `json:"bodySha256"`
+	Header     http.Header     `json:"header,omitempty"`
+	Body       json.RawMessage `json:"body,omitempty"`
+	Text       string          `json:"text,omitempty"`
+}
+
+type recordedResponse struct {
+	StatusCode int             `json:"status"`
+	Header     http.Header     `json:"header,omitempty"`
+	Body       json.RawMessage `json:"body,omitempty"`
+	Text       string          `json:"text,omitempty"`
+}
+
+// Transport is an http.RoundTripper that replays the interactions of a
+// fixture file, or records them while forwarding requests.
+type Transport struct {
+	t    testing.TB
+	path string
+	next http.RoundTripper // nil when replaying
+
+	mu           sync.Mutex
+	interactions []interaction
+	used         []bool
+}
+
+// New returns a recording Transport sending requests to the real API when
+// OPENAI_RECORD is set, and a replaying one otherwise.
+func New(t testing.TB, path string) *Transport {
+	t.Helper()
+	if os.Getenv(RecordEnv) != "" {
+		return Record(t, path, http.DefaultTransport)
+	}
+	return Replay(t, path)
+}
+
+// Replay returns a Transport answering requests from the fixture at path.
+// Each recorded interaction answers one request with the same method, path
+// and body. Other requests fail the test, as do interactions left unused
+// when it ends.
+func Replay(t testing.TB, path string) *Transport {
+	t.Helper()
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("openaitest: read fixture: %v", err)
+	}
+	var f fixture
+	if err := json.Unmarshal(raw, &f); err != nil {
+		t.Fatalf("openaitest: decode fixture %s: %v", path, err)
+	}
+	tr := &Transport{t: t, path: path, interactions: f.Interactions, used: make([]bool, len(f.Interactions))}
+	t.Cleanup(func() {
+		if t.Failed() {
+			return
+		}
+		for i, used := range tr.used {
+			if !used {
+				req := tr.interactions[i].Request
+				t.Errorf("openaitest: %s: interaction %d (%s %s) was not requested", path, i, req.Method, req.Path)
+			}
+		}
+	})
+	return tr
+}
+
+// Record returns a Transport forwarding requests to next and writing the
+// exchanges to path when the test ends without failing.
+func Record(t testing.TB, path string, next http.RoundTripper) *Transport {
+	t.Helper()
+	tr := &Transport{t: t, path: path, next: next}
+	t.Cleanup(func() {
+		if t.Failed() {
+			return
+		}
+		if err := tr.write(); err != nil {
+			t.Errorf("openaitest: %v", err)
+		}
+	})
+	return tr
+}
+
+// Client returns an HTTP client using the transport, for WithHTTPClient.
+func (tr *Transport) Client() *http.Client {
+	return &http.Client{Transport: tr}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (tr *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readBody(req)
+	if err != nil {
+		return nil, fmt.Errorf("openaitest: read request body: %w", err)
+	}
+	if tr.next == nil {
+		return tr.replay(req, body)
+	}
+	return tr.record(req, body)
+}
+
+func (tr *Transport) replay(req *http.Request, body []byte) (*http.Response, error) {
+	hash := bodyHash(body)
+
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	for i, in := range tr.interactions {
+		r := in.Request
+		if tr.used[i] || r.Method != req.Method || r.Path != req.URL.Path || r.BodySHA256 != hash {
+			continue
+		}
+		tr.used[i] = true
+		respBody := []byte(in.Response.Text)
+		if in.Response.Body != nil {
+			respBody = in.Response.Body
+		}
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", in.Response.StatusCode, http.StatusText(in.Response.StatusCode)),
+			StatusCode:    in.Response.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        in.Response.Header.Clone(),
+			Body:          io.NopCloser(bytes.NewReader(respBody)),
+			ContentLength: int64(len(respBody)),
+			Request:       req,
+		}, nil
+	}
+
+	tr.t.Errorf("openaitest: %s: unexpected request %s %s with body sha256 %s; re-record with %s=1 if the request changed:\n%s",
+		tr.path, req.Method, req.URL.Path, hash, RecordEnv, body)
+	return nil, errors.New("openaitest: no recorded interaction matches the request")
+}
+
+func (tr *Transport) record(req *http.Request, body []byte) (*http.Response, error) {
+	out := req.Clone(req.Context())
+	out.Body = io.NopCloser(bytes.NewReader(body))
+	if key := os.Getenv(APIKeyEnv); key != "" {
+		out.Header.Set("Authorization", "Bearer "+key)
+	}
+	resp, err := tr.next.RoundTrip(out)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("openaitest: read response body: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	in := interaction{
+		Request: recordedRequest{
+			Method:     req.Method,
+			Path:       req.URL.Path,
+			BodySHA256: bodyHash(body),
+			Header:     scrub(req.Header),
+		},
+		Response: recordedResponse{StatusCode: resp.StatusCode, Header: scrub(resp.Header)},
+	}
+	// Fixture bodies are re-indented, so the recorded length would not match.
+	if in.Response.Header != nil {
+		in.Response.Header.Del("Content-Length")
+	}
+	in.Request.Body, in.Request.Text = splitBody(body)
+	in.Response.Body, in.Response.Text = splitBody(respBody)
+
+	tr.mu.Lock()
+	tr.interactions = append(tr.interactions, in)
+	tr.mu.Unlock()
+	return resp, nil
+}
+
+func (tr *Transport) write() error {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	raw, err := json.MarshalIndent(fixture{Interactions: tr.interactions}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode fixture: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(tr.path), 0o755); err != nil {
+		return fmt.Errorf("create fixture directory: %w", err)
+	}
+	if err := os.WriteFile(tr.path, append(raw, '\n'), 0o644); err != nil {
+		return fmt.Errorf("write fixture: %w", err)
+	}
+	return nil
+}
+
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil {
+		return nil, nil
+	}
+	defer req.Body.Close()
+	return io.ReadAll(req.Body)
+}
+
+func bodyHash(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// splitBody stores JSON bodies as JSON, so fixtures stay readable, and
+// anything else as text.
+func splitBody(body []byte) (json.RawMessage, string) {
+	if len(body) == 0 {
+		return nil, ""
+	}
+	if json.Valid(body) {
+		return json.RawMessage(body), ""
+	}
+	return nil, string(body)
+}
+
+// scrub copies h with credentials replaced.
+func scrub(h http.Header) http.Header {
+	if len(h) == 0 {
+		return nil
+	}
+	out := h.Clone()
+	for _, name := range scrubbedHeaders {
+		if out.Get(name) != "" {
+			out.Set(name, scrubbed)
+		}
+	}
+	return out
+}
@@ -0,0 +1,156 @@
+package openaitest
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTB records failures instead of failing the test running it.
+type fakeTB struct {
+	testing.TB
+	errors   []string
+	cleanups []func()
+}
+
+func (f *fakeTB) Helper() {}
+
+func (f *fakeTB) Errorf(format string, args ...any) {
+	f.errors = append(f.errors, fmt.Sprintf(format, args...))
+}
+
+func (f *fakeTB) Fatalf(format string, args ...any) {
+	f.Errorf(format, args...)
+}
+
+func (f *fakeTB) Failed() bool {
+	return len(f.errors) > 0
+}
+
+func (f *fakeTB) Cleanup(fn func()) {
+	f.cleanups = append(f.cleanups, fn)
+}
+
+func (f *fakeTB) finish() {
+	for i := len(f.cleanups) - 1; i >= 0; i-- {
+		f.cleanups[i]()
+	}
+}
+
+func post(t *testing.T, client *http.Client, url, body string) (int, string, error) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer sk-secret")
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, string(raw), nil
+}
+
+func TestRecordThenReplay(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Set-Cookie", "__cf_bm=secret-cookie")
+		if strings.Contains(string(body), "limit") {
+			w.WriteHeader(http.StatusTooManyRequests)
+			_, _ = w.Write([]byte(`{"error":{"code":"rate_limit_exceeded"}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"echo":` + string(body) + `}`))
+	}))
+	defer srv.Close()
+	path := filepath.Join(t.TempDir(), "fixture.json")
+
+	t.Run("record", func(t *testing.T) {
+		client := Record(t, path, http.DefaultTransport).Client()
+		status, body, err := post(t, client, srv.URL+"/v1/moderations", `{"input":"hi"}`)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, status)
+		require.JSONEq(t, `{"echo":{"input":"hi"}}`, body)
+		status, _, err = post(t, client, srv.URL+"/v1/chat/completions", `{"input":"limit"}`)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusTooManyRequests, status)
+	})
+	require.EqualValues(t, 2, calls.Load())
+
+	raw, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.NotContains(t, string(raw), "sk-secret")
+	require.NotContains(t, string(raw), "secret-cookie")
+	require.Contains(t, string(raw), scrubbed)
+
+	t.Run("replay", func(t *testing.T) {
+		client := Replay(t, path).Client()
+		// Recorded interactions match in any order, against any host.
+		status, body, err := post(t, client, "https://api.openai.com/v1/chat/completions", `{"input":"limit"}`)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusTooManyRequests, status)
+		require.JSONEq(t, `{"error":{"code":"rate_limit_exceeded"}}`, body)
+		status, body, err = post(t, client, "https://api.openai.com/v1/moderations", `{"input":"hi"}`)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, status)
+		require.JSONEq(t, `{"echo":{"input":"hi"}}`, body)
+	})
+	require.EqualValues(t, 2, calls.Load())
+}
+
+func TestReplay_UnexpectedRequestFails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fixture.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"interactions":[{
+		"request":{"method":"POST","path":"/v1/moderations","bodySha256":"`+bodyHash([]byte(`{"input":"hi"}`))+`"},
+		"response":{"status":200,"body":{"results":[]}}
+	}]}`), 0o644))
+
+	cases := map[string]struct{ path, body string }{
+		"other body": {path: "/v1/moderations", body: `{"input":"bye"}`},
+		"other path": {path: "/v1/chat/completions", body: `{"input":"hi"}`},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			tb := &fakeTB{}
+			_, _, err := post(t, Replay(tb, path).Client(), "https://api.openai.com"+tc.path, tc.body)
+			require.Error(t, err)
+			require.Len(t, tb.errors, 1)
+			require.Contains(t, tb.errors[0], "unexpected request POST "+tc.path)
+		})
+	}
+
+	// A recorded interaction answers only one request.
+	tb := &fakeTB{}
+	client := Replay(tb, path).Client()
+	_, _, err := post(t, client, "https://api.openai.com/v1/moderations", `{"input":"hi"}`)
+	require.NoError(t, err)
+	_, _, err = post(t, client, "https://api.openai.com/v1/moderations", `{"input":"hi"}`)
+	require.Error(t, err)
+}
+
+func TestReplay_UnusedInteractionFails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fixture.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"interactions":[{
+		"request":{"method":"POST","path":"/v1/moderations","bodySha256":"abc"},
+		"response":{"status":200}
+	}]}`), 0o644))
+
+	tb := &fakeTB{}
+	Replay(tb, path)
+	tb.finish()
+	require.Len(t, tb.errors, 1)
+	require.Contains(t, tb.errors[0], "was not requested")
+}
@@ -36,12 +36,20 @@ func New(api ssmAPI) (*Client, error) {
 }
 
 func (c *Client) GetParameter(ctx context.Context, name string) (string, error) {
+	value, _, err := c.GetParameterVersion(ctx, name)
+	return value, err
+}
+
+// GetParameterVersion returns the value of a parameter together with its SSM
+// version. name may carry a version selector ("name:version") to read a
+// specific, possibly older, version.
+func (c *Client) GetParameterVersion(ctx context.Context, name string) (string, int64, error) {
 	if c.api == nil {
-		return "", errors.New("paramstore: client not initialized")
+		return "", 0, errors.New("paramstore: client not initialized")
 	}
 	name = strings.TrimSpace(name)
 	if name == "" {
-		return "", errors.New("paramstore: name is required")
+		return "", 0, errors.New("paramstore: name is required")
 	}
 
 	withDecryption := true
@@ -50,10 +58,10 @@ func (c *Client) GetParameter(ctx context.Context, name string) (string, error)
 		WithDecryption: &withDecryption,
 	})
 	if err != nil {
-		return "", fmt.Errorf("paramstore: get parameter %q: %w", name, err)
+		return "", 0, fmt.Errorf("paramstore: get parameter %q: %w", name, err)
 	}
 	if out == nil || out.Parameter == nil || out.Parameter.Value == nil {
-		return "", errors.New("paramstore: parameter missing value")
+		return "", 0, errors.New("paramstore: parameter missing value")
 	}
-	return *out.Parameter.Value, nil
+	return *out.Parameter.Value, out.Parameter.Version, nil
 }
@@ -14,9 +14,11 @@ import (
 type fakeAPI struct {
 	getOut *ssm.GetParameterOutput
 	getErr error
+	lastIn *ssm.GetParameterInput
 }
 
-func (f *fakeAPI) GetParameter(_ context.Context, _ *ssm.GetParameterInput, _ ...func(*ssm.Options)) (*ssm.GetParameterOutput, error) {
+func (f *fakeAPI) GetParameter(_ context.Context, in *ssm.GetParameterInput, _ ...func(*ssm.Options)) (*ssm.GetParameterOutput, error) {
+	f.lastIn = in
 	return f.getOut, f.getErr
 }
 
@@ -45,6 +47,19 @@ func TestGetParameter_HappyPath_SecureString(t *testing.T) {
 	require.Equal(t, `{"k":"v"}`, v)
 }
 
+func TestGetParameterVersion_ReturnsVersionAndPassesSelector(t *testing.T) {
+	api := &fakeAPI{getOut: &ssm.GetParameterOutput{Parameter: &types.Parameter{
+		Name: strPtr("/prefix/resume"), Value: strPtr("old resume"), Version: 3,
+	}}}
+	client, err := New(api)
+	require.NoError(t, err)
+	v, version, err := client.GetParameterVersion(context.Background(), "/prefix/resume:3")
+	require.NoError(t, err)
+	require.Equal(t, "old resume", v)
+	require.Equal(t, int64(3), version)
+	require.Equal(t, "/prefix/resume:3", *api.lastIn.Name)
+}
+
 func TestGetParameter_MissingValue(t *testing.T) {
 	api := &fakeAPI{getOut: &ssm.GetParameterOutput{Parameter: &types.Parameter{Name: strPtr("p"), Value: nil}}}
 	client, err := New(api)
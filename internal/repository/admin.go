@@ -0,0 +1,423 @@
+package repository
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"portfolio-agent/internal/domain"
+	"portfolio-agent/internal/telemetry"
+)
+
+const (
+	// batchWriteLimit is the maximum number of requests in one BatchWriteItem call.
+	batchWriteLimit = 25
+	// maxBatchRetries bounds how often unprocessed batch items are resubmitted.
+	maxBatchRetries = 5
+	// listPageSize is the number of conversations returned per ListConversations page.
+	listPageSize = 50
+)
+
+// ErrInvalidCursor is returned when a ListConversations cursor cannot be decoded.
+var ErrInvalidCursor = errors.New("repository: invalid cursor")
+
+// ScanConversations returns the metadata record of every conversation of the
+// tenant in ctx. It reads the whole table and is intended for operator
+// tooling only.
+func (c *Client) ScanConversations(ctx context.Context) (_ []domain.ConversationMeta, err error) {
+	ctx, span := c.startSpan(ctx, "ScanConversations", "Scan")
+	defer func() { telemetry.EndSpan(span, err) }()
+
+	in := &dynamodb.ScanInput{
+		TableName:        aws.String(c.tableName),
+		FilterExpression: aws.String("SK = :meta AND begins_with(PK, :conv)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":meta": &types.AttributeValueMemberS{Value: skMeta},
+			":conv": &types.AttributeValueMemberS{Value: tenantPrefix(domain.TenantFromContext(ctx)) + pkPrefixConv},
+		},
+	}
+
+	var metas []domain.ConversationMeta
+	for {
+		out, err := c.api.Scan(ctx, in)
+		if err != nil {
+			return nil, fmt.Errorf("repository: ScanConversations scan: %w", err)
+		}
+		for _, item := range out.Items {
+			meta, err := itemToMeta(item)
+			if err != nil {
+				return nil, fmt.Errorf("repository: ScanConversations unmarshal: %w", err)
+			}
+			metas = append(metas, meta)
+		}
+		if len(out.LastEvaluatedKey) == 0 {
+			return metas, nil
+		}
+		in.ExclusiveStartKey = out.LastEvaluatedKey
+	}
+}
+
+// ListRecentConversations returns up to limit conversations ordered by most
+// recent activity first.
+func (c *Client) ListRecentConversations(ctx context.Context, limit int) ([]domain.ConversationMeta, error) {
+	metas, err := c.ScanConversations(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("repository: ListRecentConversations: %w", err)
+	}
+	sort.SliceStable(metas, func(i, j int) bool {
+		return metas[i].LastActivity > metas[j].LastActivity
+	})
+	if limit > 0 && len(metas) > limit {
+		metas = metas[:limit]
+	}
+	return metas, nil
+}
+
+// ListConversations returns conversations whose lastActivity lies within
+// [since, until], most recent first, using the activity index. Pass the
+// NextCursor of the previous page as cursor to continue; "" starts at until.
+// Conversations last written before the index existed are not returned.
+func (c *Client) ListConversations(ctx context.Context, since, until time.Time, cursor string) (_ domain.ConversationPage, err error) {
+	ctx, span := c.startSpan(ctx, "ListConversations", "Query")
+	defer func() { telemetry.EndSpan(span, err) }()
+
+	if until.Before(since) {
+		return domain.ConversationPage{}, errors.New("repository: ListConversations: until must not be before since")
+	}
+	sinceDay := since.UTC().Truncate(24 * time.Hour)
+	day := until.UTC().Truncate(24 * time.Hour)
+	var startKey map[string]types.AttributeValue
+	if cursor != "" {
+		cur, err := decodeListCursor(cursor)
+		if err != nil {
+			return domain.ConversationPage{}, fmt.Errorf("repository: ListConversations: %w", err)
+		}
+		day, startKey = cur.day, cur.key
+	}
+
+	var page domain.ConversationPage
+	for !day.Before(sinceDay) {
+		out, err := c.api.Query(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String(c.tableName),
+			IndexName:              aws.String(activityIndex),
+			KeyConditionExpression: aws.String("activityDay = :day AND lastActivity BETWEEN :since AND :until"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":day":   &types.AttributeValueMemberS{Value: tenantPrefix(domain.TenantFromContext(ctx)) + day.Format(time.DateOnly)},
+				":since": &types.AttributeValueMemberS{Value: since.UTC().Format(time.RFC3339)},
+				":until": &types.AttributeValueMemberS{Value: until.UTC().Format(time.RFC3339)},
+			},
+			ScanIndexForward:  aws.Bool(false),
+			Limit:             aws.Int32(int32(listPageSize - len(page.Conversations))),
+			ExclusiveStartKey: startKey,
+		})
+		if err != nil {
+			return domain.ConversationPage{}, fmt.Errorf("repository: ListConversations query: %w", err)
+		}
+		for _, item := range out.Items {
+			meta, err := itemToMeta(item)
+			if err != nil {
+				return domain.ConversationPage{}, fmt.Errorf("repository: ListConversations unmarshal: %w", err)
+			}
+			page.Conversations = append(page.Conversations, meta)
+		}
+
+		startKey = out.LastEvaluatedKey
+		if len(startKey) == 0 {
+			day = day.AddDate(0, 0, -1)
+		}
+		if len(page.Conversations) >= listPageSize {
+			break
+		}
+	}
+
+	if !day.Before(sinceDay) {
+		page.NextCursor, err = encodeListCursor(listCursor{day: day, key: startKey})
+		if err != nil {
+			return domain.ConversationPage{}, fmt.Errorf("repository: ListConversations: %w", err)
+		}
+	}
+	return page, nil
+}
+
+// listCursor is the decoded position of a ListConversations page: the day
+// bucket to read next and, within it, the index key to resume after.
+type listCursor struct {
+	day time.Time
+	key map[string]types.AttributeValue
+}
+
+type listCursorJSON struct {
+	Day string            `json:"d"`
+	Key map[string]string `json:"k,omitempty"`
+}
+
+// encodeListCursor serialises c as opaque URL-safe base64 JSON. Only string
+// key attributes are supported, which covers the table and index keys.
+func encodeListCursor(c listCursor) (string, error) {
+	raw := listCursorJSON{Day: c.day.Format(time.DateOnly)}
+	if len(c.key) > 0 {
+		raw.Key = make(map[string]string, len(c.key))
+		for name, v := range c.key {
+			s, ok := v.(*types.AttributeValueMemberS)
+			if !ok {
+				return "", fmt.Errorf("cursor key attribute %q is not a string", name)
+			}
+			raw.Key[name] = s.Value
+		}
+	}
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func decodeListCursor(s string) (listCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return listCursor{}, ErrInvalidCursor
+	}
+	var raw listCursorJSON
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return listCursor{}, ErrInvalidCursor
+	}
+	day, err := time.Parse(time.DateOnly, raw.Day)
+	if err != nil {
+		return listCursor{}, ErrInvalidCursor
+	}
+	c := listCursor{day: day}
+	if len(raw.Key) > 0 {
+		c.key = make(map[string]types.AttributeValue, len(raw.Key))
+		for name, v := range raw.Key {
+			c.key[name] = &types.AttributeValueMemberS{Value: v}
+		}
+	}
+	return c, nil
+}
+
+// GetTranscript returns the metadata, messages and feedback of a conversation
+// in chronological order. It returns an error wrapping
+// domain.ErrConversationNotFound when the partition is empty.
+func (c *Client) GetTranscript(ctx context.Context, conversationID string) (_ domain.Transcript, err error) {
+	ctx, span := c.startSpan(ctx, "GetTranscript", "Query")
+	defer func() { telemetry.EndSpan(span, err) }()
+
+	items, err := c.queryPartition(ctx, convPK(domain.TenantFromContext(ctx), conversationID), false)
+	if err != nil {
+		return domain.Transcript{}, fmt.Errorf("repository: GetTranscript query: %w", err)
+	}
+	if len(items) == 0 {
+		return domain.Transcript{}, fmt.Errorf("repository: GetTranscript: %w", domain.ErrConversationNotFound)
+	}
+
+	transcript := domain.Transcript{Meta: domain.ConversationMeta{ConversationID: conversationID}}
+	for _, item := range items {
+		sk, err := strAttr(item, "SK")
+		if err != nil {
+			return domain.Transcript{}, fmt.Errorf("repository: GetTranscript unmarshal: %w", err)
+		}
+		switch {
+		case sk == skMeta:
+			transcript.Meta, err = itemToMeta(item)
+		case strings.HasPrefix(sk, skPrefixMsg):
+			var msg domain.Message
+			msg, err = itemToMessage(item)
+			msg.ConversationID = conversationID
+			transcript.Messages = append(transcript.Messages, msg)
+		case strings.HasPrefix(sk, skPrefixFeedback):
+			var fb domain.Feedback
+			fb, err = itemToFeedback(item)
+			transcript.Feedback = append(transcript.Feedback, fb)
+		}
+		if err != nil {
+			return domain.Transcript{}, fmt.Errorf("repository: GetTranscript unmarshal %s: %w", sk, err)
+		}
+	}
+	return transcript, nil
+}
+
+// DeleteConversation removes every item stored for a conversation.
+func (c *Client) DeleteConversation(ctx context.Context, conversationID string) (err error) {
+	ctx, span := c.startSpan(ctx, "DeleteConversation", "BatchWriteItem")
+	defer func() { telemetry.EndSpan(span, err) }()
+
+	items, err := c.queryPartition(ctx, convPK(domain.TenantFromContext(ctx), conversationID), true)
+	if err != nil {
+		return fmt.Errorf("repository: DeleteConversation query: %w", err)
+	}
+	if len(items) == 0 {
+		return fmt.Errorf("repository: DeleteConversation: %w", domain.ErrConversationNotFound)
+	}
+
+	requests := make([]types.WriteRequest, 0, len(items))
+	for _, item := range items {
+		requests = append(requests, types.WriteRequest{
+			DeleteRequest: &types.DeleteRequest{Key: map[string]types.AttributeValue{
+				"PK": item["PK"],
+				"SK": item["SK"],
+			}},
+		})
+	}
+	for start := 0; start < len(requests); start += batchWriteLimit {
+		end := min(start+batchWriteLimit, len(requests))
+		if err := c.batchWrite(ctx, requests[start:end]); err != nil {
+			return fmt.Errorf("repository: DeleteConversation: %w", err)
+		}
+	}
+	return nil
+}
+
+// ResetTurnCount overwrites the persisted turn count of an existing conversation.
+func (c *Client) ResetTurnCount(ctx context.Context, conversationID string, turns int) (err error) {
+	ctx, span := c.startSpan(ctx, "ResetTurnCount", "UpdateItem")
+	defer func() { telemetry.EndSpan(span, err) }()
+
+	if turns < 0 {
+		return errors.New("repository: ResetTurnCount: turns must not be negative")
+	}
+
+	_, err = c.api.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(c.tableName),
+		Key: map[string]types.AttributeValue{
+			"PK": &types.AttributeValueMemberS{Value: convPK(domain.TenantFromContext(ctx), conversationID)},
+			"SK": &types.AttributeValueMemberS{Value: skMeta},
+		},
+		UpdateExpression:    aws.String("SET turns = :turns"),
+		ConditionExpression: aws.String("attribute_exists(PK)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":turns": &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", turns)},
+		},
+	})
+	if err != nil {
+		var condErr *types.ConditionalCheckFailedException
+		if errors.As(err, &condErr) {
+			return fmt.Errorf("repository: ResetTurnCount: %w", domain.ErrConversationNotFound)
+		}
+		return fmt.Errorf("repository: ResetTurnCount: %w", err)
+	}
+	return nil
+}
+
+// queryPartition reads every item of a partition in ascending SK order. When
+// keysOnly is set only the primary key attributes are returned.
+func (c *Client) queryPartition(ctx context.Context, pk string, keysOnly bool) ([]map[string]types.AttributeValue, error) {
+	in := &dynamodb.QueryInput{
+		TableName:              aws.String(c.tableName),
+		KeyConditionExpression: aws.String("PK = :pk"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk": &types.AttributeValueMemberS{Value: pk},
+		},
+		ConsistentRead: aws.Bool(true),
+	}
+	if keysOnly {
+		in.ProjectionExpression = aws.String("PK, SK")
+	}
+
+	var items []map[string]types.AttributeValue
+	for {
+		out, err := c.api.Query(ctx, in)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, out.Items...)
+		if len(out.LastEvaluatedKey) == 0 {
+			return items, nil
+		}
+		in.ExclusiveStartKey = out.LastEvaluatedKey
+	}
+}
+
+// batchWrite submits requests and resubmits unprocessed items a bounded
+// number of times.
+func (c *Client) batchWrite(ctx context.Context, requests []types.WriteRequest) error {
+	pending := map[string][]types.WriteRequest{c.tableName: requests}
+	for attempt := 0; attempt <= maxBatchRetries; attempt++ {
+		out, err := c.api.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{RequestItems: pending})
+		if err != nil {
+			return fmt.Errorf("batch write: %w", err)
+		}
+		if len(out.UnprocessedItems[c.tableName]) == 0 {
+			return nil
+		}
+		pending = out.UnprocessedItems
+	}
+	return fmt.Errorf("batch write: %d items left unprocessed", len(pending[c.tableName]))
+}
+
+// itemToMeta converts a DynamoDB attribute map to a ConversationMeta.
+func itemToMeta(item map[string]types.AttributeValue) (domain.ConversationMeta, error) {
+	pk, err := strAttr(item, "PK")
+	if err != nil {
+		return domain.ConversationMeta{}, err
+	}
+	_, conversationID := splitConvPK(pk)
+	sk, err := strAttr(item, "SK")
+	if err != nil {
+		return domain.ConversationMeta{}, err
+	}
+	turns, err := intAttr(item, "turns")
+	if err != nil {
+		return domain.ConversationMeta{}, err
+	}
+	lastActivity, _ := strAttr(item, "lastActivity") // allow empty
+	usage, err := itemToUsage(item)
+	if err != nil {
+		return domain.ConversationMeta{}, err
+	}
+	var ttl int64
+	if _, ok := item["ttl"]; ok {
+		n, err := intAttr(item, "ttl")
+		if err != nil {
+			return domain.ConversationMeta{}, err
+		}
+		ttl = int64(n)
+	}
+
+	return domain.ConversationMeta{
+		PK:             pk,
+		SK:             sk,
+		ConversationID: conversationID,
+		LastActivity:   lastActivity,
+		Turns:          turns,
+		Usage:          usage,
+		TTL:            ttl,
+	}, nil
+}
+
+// itemToFeedback converts a DynamoDB attribute map to a Feedback.
+func itemToFeedback(item map[string]types.AttributeValue) (domain.Feedback, error) {
+	pk, err := strAttr(item, "PK")
+	if err != nil {
+		return domain.Feedback{}, err
+	}
+	_, conversationID := splitConvPK(pk)
+	sk, err := strAttr(item, "SK")
+	if err != nil {
+		return domain.Feedback{}, err
+	}
+	rating, err := strAttr(item, "rating")
+	if err != nil {
+		return domain.Feedback{}, err
+	}
+	comment, _ := strAttr(item, "comment")     // allow empty
+	createdAt, _ := strAttr(item, "createdAt") // allow empty
+
+	return domain.Feedback{
+		PK:             pk,
+		SK:             sk,
+		ConversationID: conversationID,
+		TurnID:         strings.TrimPrefix(sk, skPrefixFeedback),
+		Rating:         domain.Rating(rating),
+		Comment:        comment,
+		CreatedAt:      createdAt,
+	}, nil
+}
@@ -0,0 +1,224 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/require"
+
+	"portfolio-agent/internal/domain"
+)
+
+func makeActiveMetaItem(id, lastActivity string, turns int) map[string]types.AttributeValue {
+	item := makeMetaItem(convPK("", id), turns)
+	item["lastActivity"] = &types.AttributeValueMemberS{Value: lastActivity}
+	return item
+}
+
+func TestListRecentConversations_SortsAndLimits(t *testing.T) {
+	db := &fakeDynamo{scanOut: &dynamodb.ScanOutput{Items: []map[string]types.AttributeValue{
+		makeActiveMetaItem("old", "2026-02-25T10:00:00Z", 1),
+		makeActiveMetaItem("new", "2026-02-27T10:00:00Z", 3),
+		makeActiveMetaItem("mid", "2026-02-26T10:00:00Z", 2),
+	}}}
+	c := mustNewClient(t, db)
+
+	metas, err := c.ListRecentConversations(context.Background(), 2)
+	require.NoError(t, err)
+	require.Len(t, metas, 2)
+	require.Equal(t, "new", metas[0].ConversationID)
+	require.Equal(t, 3, metas[0].Turns)
+	require.Equal(t, "mid", metas[1].ConversationID)
+	require.Equal(t, "SK = :meta AND begins_with(PK, :conv)", *db.lastScanIn.FilterExpression)
+}
+
+func TestListRecentConversations_ScanError(t *testing.T) {
+	db := &fakeDynamo{scanErr: errors.New("boom")}
+	c := mustNewClient(t, db)
+	_, err := c.ListRecentConversations(context.Background(), 10)
+	require.Error(t, err)
+}
+
+func TestGetTranscript_SplitsItemsByKind(t *testing.T) {
+	fb := feedbackItem(NewFeedback("", "abc", "2026-02-27T12:00:00Z", domain.RatingUp, "nice"))
+	db := &fakeDynamo{queryOut: &dynamodb.QueryOutput{Items: []map[string]types.AttributeValue{
+		fb,
+		makeActiveMetaItem("abc", "2026-02-27T12:00:01Z", 1),
+		makeItem("CONV#abc", "MSG#2026-02-27T12:00:00Z", "Hi", "Hello"),
+	}}}
+	c := mustNewClient(t, db)
+
+	transcript, err := c.GetTranscript(context.Background(), "abc")
+	require.NoError(t, err)
+	require.Equal(t, "abc", transcript.Meta.ConversationID)
+	require.Equal(t, 1, transcript.Meta.Turns)
+	require.Len(t, transcript.Messages, 1)
+	require.Equal(t, "2026-02-27T12:00:00Z", transcript.Messages[0].TurnID)
+	require.Equal(t, "Hello", transcript.Messages[0].Answer)
+	require.Len(t, transcript.Feedback, 1)
+	require.Equal(t, domain.RatingUp, transcript.Feedback[0].Rating)
+	require.Equal(t, "2026-02-27T12:00:00Z", transcript.Feedback[0].TurnID)
+	require.Equal(t, "PK = :pk", *db.lastQueryIn.KeyConditionExpression)
+}
+
+func TestGetTranscript_NotFound(t *testing.T) {
+	db := &fakeDynamo{queryOut: &dynamodb.QueryOutput{}}
+	c := mustNewClient(t, db)
+	_, err := c.GetTranscript(context.Background(), "missing")
+	require.ErrorIs(t, err, domain.ErrConversationNotFound)
+}
+
+func TestDeleteConversation_BatchesAndRetriesUnprocessed(t *testing.T) {
+	items := make([]map[string]types.AttributeValue, 0, 30)
+	items = append(items, makeMetaItem("CONV#abc", 29))
+	for i := range 29 {
+		items = append(items, makeItem("CONV#abc", fmt.Sprintf("MSG#%02d", i), "q", "a"))
+	}
+	unprocessed := []types.WriteRequest{{DeleteRequest: &types.DeleteRequest{Key: map[string]types.AttributeValue{
+		"PK": &types.AttributeValueMemberS{Value: "CONV#abc"},
+		"SK": &types.AttributeValueMemberS{Value: "MSG#00"},
+	}}}}
+	db := &fakeDynamo{
+		queryOut:  &dynamodb.QueryOutput{Items: items},
+		batchOuts: []*dynamodb.BatchWriteItemOutput{{UnprocessedItems: map[string][]types.WriteRequest{"test-table": unprocessed}}},
+	}
+	c := mustNewClient(t, db)
+
+	err := c.DeleteConversation(context.Background(), "abc")
+	require.NoError(t, err)
+	require.Equal(t, "PK, SK", *db.lastQueryIn.ProjectionExpression)
+	require.Len(t, db.batchIns, 3)
+	require.Len(t, db.batchIns[0].RequestItems["test-table"], 25)
+	require.Len(t, db.batchIns[1].RequestItems["test-table"], 1) // retry of the unprocessed item
+	require.Len(t, db.batchIns[2].RequestItems["test-table"], 5)
+}
+
+func TestDeleteConversation_NotFound(t *testing.T) {
+	db := &fakeDynamo{queryOut: &dynamodb.QueryOutput{}}
+	c := mustNewClient(t, db)
+	err := c.DeleteConversation(context.Background(), "missing")
+	require.ErrorIs(t, err, domain.ErrConversationNotFound)
+	require.Empty(t, db.batchIns)
+}
+
+func TestDeleteConversation_BatchError(t *testing.T) {
+	db := &fakeDynamo{
+		queryOut: &dynamodb.QueryOutput{Items: []map[string]types.AttributeValue{makeMetaItem("CONV#abc", 1)}},
+		batchErr: errors.New("throttled"),
+	}
+	c := mustNewClient(t, db)
+	err := c.DeleteConversation(context.Background(), "abc")
+	require.Error(t, err)
+}
+
+func TestResetTurnCount_HappyPath(t *testing.T) {
+	db := &fakeDynamo{}
+	c := mustNewClient(t, db)
+	err := c.ResetTurnCount(context.Background(), "abc", 0)
+	require.NoError(t, err)
+	require.Equal(t, "CONV#abc", db.lastUpdateIn.Key["PK"].(*types.AttributeValueMemberS).Value)
+	require.Equal(t, "SET turns = :turns", *db.lastUpdateIn.UpdateExpression)
+	require.Equal(t, "attribute_exists(PK)", *db.lastUpdateIn.ConditionExpression)
+	require.Equal(t, "0", db.lastUpdateIn.ExpressionAttributeValues[":turns"].(*types.AttributeValueMemberN).Value)
+}
+
+func TestResetTurnCount_NotFound(t *testing.T) {
+	db := &fakeDynamo{updateErr: &types.ConditionalCheckFailedException{}}
+	c := mustNewClient(t, db)
+	err := c.ResetTurnCount(context.Background(), "missing", 0)
+	require.ErrorIs(t, err, domain.ErrConversationNotFound)
+}
+
+func TestResetTurnCount_NegativeTurns(t *testing.T) {
+	db := &fakeDynamo{}
+	c := mustNewClient(t, db)
+	err := c.ResetTurnCount(context.Background(), "abc", -1)
+	require.Error(t, err)
+	require.Nil(t, db.lastUpdateIn)
+}
+
+func TestListConversations_WalksDayBucketsNewestFirst(t *testing.T) {
+	db := &fakeDynamo{queryOuts: []*dynamodb.QueryOutput{
+		{Items: []map[string]types.AttributeValue{makeActiveMetaItem("b", "2026-02-27T09:00:00Z", 2)}},
+		{}, // 2026-02-26 is empty
+		{Items: []map[string]types.AttributeValue{makeActiveMetaItem("a", "2026-02-25T18:00:00Z", 1)}},
+	}}
+	c := mustNewClient(t, db)
+	since := time.Date(2026, 2, 25, 12, 0, 0, 0, time.UTC)
+	until := time.Date(2026, 2, 27, 23, 0, 0, 0, time.UTC)
+
+	page, err := c.ListConversations(context.Background(), since, until, "")
+	require.NoError(t, err)
+	require.Empty(t, page.NextCursor)
+	require.Len(t, page.Conversations, 2)
+	require.Equal(t, "b", page.Conversations[0].ConversationID)
+	require.Equal(t, "a", page.Conversations[1].ConversationID)
+
+	require.Len(t, db.queryIns, 3)
+	for i, day := range []string{"2026-02-27", "2026-02-26", "2026-02-25"} {
+		in := db.queryIns[i]
+		require.Equal(t, activityIndex, *in.IndexName)
+		require.False(t, *in.ScanIndexForward)
+		require.Equal(t, day, in.ExpressionAttributeValues[":day"].(*types.AttributeValueMemberS).Value)
+		require.Equal(t, "2026-02-25T12:00:00Z", in.ExpressionAttributeValues[":since"].(*types.AttributeValueMemberS).Value)
+	}
+}
+
+func TestListConversations_CursorResumesWithinDay(t *testing.T) {
+	lastKey := map[string]types.AttributeValue{
+		"PK":           &types.AttributeValueMemberS{Value: "CONV#b"},
+		"SK":           &types.AttributeValueMemberS{Value: skMeta},
+		"activityDay":  &types.AttributeValueMemberS{Value: "2026-02-27"},
+		"lastActivity": &types.AttributeValueMemberS{Value: "2026-02-27T09:00:00Z"},
+	}
+	items := make([]map[string]types.AttributeValue, listPageSize)
+	for i := range items {
+		items[i] = makeActiveMetaItem(fmt.Sprintf("c%02d", i), "2026-02-27T09:00:00Z", 1)
+	}
+	db := &fakeDynamo{queryOuts: []*dynamodb.QueryOutput{{Items: items, LastEvaluatedKey: lastKey}}}
+	c := mustNewClient(t, db)
+	since := time.Date(2026, 2, 27, 0, 0, 0, 0, time.UTC)
+	until := time.Date(2026, 2, 27, 23, 0, 0, 0, time.UTC)
+
+	page, err := c.ListConversations(context.Background(), since, until, "")
+	require.NoError(t, err)
+	require.Len(t, page.Conversations, listPageSize)
+	require.NotEmpty(t, page.NextCursor)
+
+	db.queryOut = &dynamodb.QueryOutput{Items: []map[string]types.AttributeValue{makeActiveMetaItem("z", "2026-02-27T08:00:00Z", 1)}}
+	page, err = c.ListConversations(context.Background(), since, until, page.NextCursor)
+	require.NoError(t, err)
+	require.Len(t, page.Conversations, 1)
+	require.Empty(t, page.NextCursor)
+	require.Equal(t, lastKey, db.lastQueryIn.ExclusiveStartKey)
+	require.Equal(t, "2026-02-27", db.lastQueryIn.ExpressionAttributeValues[":day"].(*types.AttributeValueMemberS).Value)
+}
+
+func TestListConversations_InvalidCursor(t *testing.T) {
+	c := mustNewClient(t, &fakeDynamo{})
+	now := time.Now()
+	_, err := c.ListConversations(context.Background(), now.Add(-time.Hour), now, "not-a-cursor!")
+	require.ErrorIs(t, err, ErrInvalidCursor)
+}
+
+func TestListConversations_InvertedRange(t *testing.T) {
+	c := mustNewClient(t, &fakeDynamo{})
+	now := time.Now()
+	_, err := c.ListConversations(context.Background(), now, now.Add(-time.Hour), "")
+	require.Error(t, err)
+}
+
+func TestMetaItem_SetsActivityDay(t *testing.T) {
+	meta := NewConversationMeta("", "abc", 1)
+	meta.LastActivity = "2026-02-27T23:59:59Z"
+	item := metaItem(meta)
+	require.Equal(t, "2026-02-27", item["activityDay"].(*types.AttributeValueMemberS).Value)
+
+	meta.LastActivity = ""
+	require.NotContains(t, metaItem(meta), "activityDay")
+}
@@ -11,14 +11,26 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
 	"portfolio-agent/internal/domain"
+	"portfolio-agent/internal/telemetry"
 )
 
 const (
-	skPrefixMsg = "MSG#"
-	skMeta      = "META#"
-	ttlDuration = 30 * 24 * time.Hour // 30-day TTL
+	pkPrefixTenant   = "TENANT#"
+	pkPrefixConv     = "CONV#"
+	skPrefixMsg      = "MSG#"
+	skPrefixFeedback = "FEEDBACK#"
+	skMeta           = "META#"
+	ttlDuration      = 30 * 24 * time.Hour // 30-day TTL
+
+	// activityIndex is the GSI over META# items keyed by activityDay (UTC
+	// yyyy-mm-dd) and sorted by lastActivity.
+	activityIndex = "activity-index"
+
+	tracerScope = "portfolio-agent/internal/repository"
 )
 
 // dynamodbAPI is the minimal DynamoDB interface required by Client.
@@ -26,20 +38,29 @@ const (
 type dynamodbAPI interface {
 	GetItem(ctx context.Context, in *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
 	PutItem(ctx context.Context, in *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	UpdateItem(ctx context.Context, in *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error)
 	Query(ctx context.Context, in *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
 	TransactWriteItems(ctx context.Context, in *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error)
+	Scan(ctx context.Context, in *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error)
+	BatchWriteItem(ctx context.Context, in *dynamodb.BatchWriteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error)
 }
 
 // ReadWriter defines the conversation state operations consumed by the handler.
 type ReadWriter interface {
 	GetConversationTurnCount(ctx context.Context, conversationID string) (int, error)
 	GetHistory(ctx context.Context, conversationID string, limit int) ([]domain.Message, error)
-	SaveCompletedTurn(ctx context.Context, conversationID, question, answer string, turns int) error
+	SaveCompletedTurn(ctx context.Context, conversationID, question, answer string, turns int, usage domain.Usage, profileVersion string) (string, error)
+	RecordFeedback(ctx context.Context, conversationID, turnID string, rating domain.Rating, comment string) error
+	SaveFeedback(ctx context.Context, fb domain.Feedback) error
 	WriteMessage(ctx context.Context, msg domain.Message) error
 	UpsertMeta(ctx context.Context, meta domain.ConversationMeta) error
+	GetDailySpend(ctx context.Context, day time.Time) (domain.Usage, error)
+	AddDailySpend(ctx context.Context, day time.Time, usage domain.Usage) error
 }
 
-// Client wraps a DynamoDB table for conversation state.
+// Client wraps a DynamoDB table for conversation state. Every method scopes
+// its keys to the tenant carried by ctx (see domain.TenantFromContext), so one
+// tenant can never read or write another tenant's items.
 type Client struct {
 	api       dynamodbAPI
 	tableName string
@@ -56,14 +77,73 @@ func New(api dynamodbAPI, tableName string) (*Client, error) {
 	return &Client{api: api, tableName: tableName}, nil
 }
 
-// convPK returns the DynamoDB partition key for a conversation.
-func convPK(conversationID string) string {
-	return "CONV#" + conversationID
+// startSpan starts a span for a repository operation backed by the given
+// DynamoDB API call.
+func (c *Client) startSpan(ctx context.Context, op, apiCall string) (context.Context, trace.Span) {
+	return telemetry.StartSpan(ctx, tracerScope, "repository."+op,
+		attribute.String("db.system", "dynamodb"),
+		attribute.String("db.operation", apiCall),
+		attribute.String("aws.dynamodb.table_names", c.tableName),
+	)
+}
+
+// tenantPrefix returns the key prefix that isolates a tenant's items. The
+// default tenant keeps the unprefixed single-tenant keys.
+func tenantPrefix(tenantID string) string {
+	if tenantID == domain.DefaultTenant {
+		return ""
+	}
+	return pkPrefixTenant + tenantID + "#"
+}
+
+// convPK returns the DynamoDB partition key for a tenant's conversation.
+func convPK(tenantID, conversationID string) string {
+	return tenantPrefix(tenantID) + pkPrefixConv + conversationID
+}
+
+// splitConvPK splits a conversation partition key into its tenant prefix and
+// conversation ID.
+func splitConvPK(pk string) (prefix, conversationID string) {
+	prefix, conversationID, ok := strings.Cut(pk, pkPrefixConv)
+	if !ok {
+		return "", pk
+	}
+	return prefix, conversationID
+}
+
+// spendPK returns the partition key of a tenant's spend counter for the UTC
+// day of ts.
+func spendPK(tenantID string, ts time.Time) string {
+	return tenantPrefix(tenantID) + "SPEND#" + ts.UTC().Format(time.DateOnly)
 }
 
 // msgSK returns the sort key for a message using the current UTC timestamp.
 func msgSK(ts time.Time) string {
-	return skPrefixMsg + ts.UTC().Format(time.RFC3339Nano)
+	return skPrefixMsg + turnID(ts)
+}
+
+// turnID returns the stable public identifier of a turn written at ts. It is
+// the message sort key without its MSG# prefix.
+func turnID(ts time.Time) string {
+	return ts.UTC().Format(time.RFC3339Nano)
+}
+
+// activityDay returns the activity-index partition key of a META# item: the
+// tenant prefix of its PK followed by the UTC day of its RFC3339 lastActivity.
+// It returns "" when lastActivity cannot be parsed.
+func activityDay(pk, lastActivity string) string {
+	ts, err := time.Parse(time.RFC3339, lastActivity)
+	if err != nil {
+		return ""
+	}
+	prefix, _ := splitConvPK(pk)
+	return prefix + ts.UTC().Format(time.DateOnly)
+}
+
+// feedbackSK returns the sort key of the feedback record for a turn, placed
+// next to the MSG# record in the conversation partition.
+func feedbackSK(turnID string) string {
+	return skPrefixFeedback + turnID
 }
 
 // ttlValue returns a Unix timestamp 30 days in the future.
@@ -72,8 +152,11 @@ func ttlValue() int64 {
 }
 
 // GetHistory queries all MSG# items for a conversation ordered chronologically.
-func (c *Client) GetHistory(ctx context.Context, conversationID string, limit int) ([]domain.Message, error) {
-	pk := convPK(conversationID)
+func (c *Client) GetHistory(ctx context.Context, conversationID string, limit int) (_ []domain.Message, err error) {
+	ctx, span := c.startSpan(ctx, "GetHistory", "Query")
+	defer func() { telemetry.EndSpan(span, err) }()
+
+	pk := convPK(domain.TenantFromContext(ctx), conversationID)
 
 	in := &dynamodb.QueryInput{
 		TableName:              aws.String(c.tableName),
@@ -108,11 +191,14 @@ func (c *Client) GetHistory(ctx context.Context, conversationID string, limit in
 }
 
 // GetConversationTurnCount returns the persisted successful turn count for a conversation.
-func (c *Client) GetConversationTurnCount(ctx context.Context, conversationID string) (int, error) {
+func (c *Client) GetConversationTurnCount(ctx context.Context, conversationID string) (_ int, err error) {
+	ctx, span := c.startSpan(ctx, "GetConversationTurnCount", "GetItem")
+	defer func() { telemetry.EndSpan(span, err) }()
+
 	out, err := c.api.GetItem(ctx, &dynamodb.GetItemInput{
 		TableName: aws.String(c.tableName),
 		Key: map[string]types.AttributeValue{
-			"PK": &types.AttributeValueMemberS{Value: convPK(conversationID)},
+			"PK": &types.AttributeValueMemberS{Value: convPK(domain.TenantFromContext(ctx), conversationID)},
 			"SK": &types.AttributeValueMemberS{Value: skMeta},
 		},
 		ConsistentRead: aws.Bool(true),
@@ -132,12 +218,15 @@ func (c *Client) GetConversationTurnCount(ctx context.Context, conversationID st
 }
 
 // WriteMessage persists a new message record with status=pending.
-func (c *Client) WriteMessage(ctx context.Context, msg domain.Message) error {
+func (c *Client) WriteMessage(ctx context.Context, msg domain.Message) (err error) {
+	ctx, span := c.startSpan(ctx, "WriteMessage", "PutItem")
+	defer func() { telemetry.EndSpan(span, err) }()
+
 	if msg.PK == "" || msg.SK == "" {
 		return errors.New("repository: WriteMessage: PK and SK are required")
 	}
 
-	_, err := c.api.PutItem(ctx, &dynamodb.PutItemInput{
+	_, err = c.api.PutItem(ctx, &dynamodb.PutItemInput{
 		TableName:           aws.String(c.tableName),
 		Item:                messageItem(msg),
 		ConditionExpression: aws.String("attribute_not_exists(PK) AND attribute_not_exists(SK)"),
@@ -149,8 +238,11 @@ func (c *Client) WriteMessage(ctx context.Context, msg domain.Message) error {
 }
 
 // UpsertMeta writes or replaces the conversation metadata record.
-func (c *Client) UpsertMeta(ctx context.Context, meta domain.ConversationMeta) error {
-	_, err := c.api.PutItem(ctx, &dynamodb.PutItemInput{
+func (c *Client) UpsertMeta(ctx context.Context, meta domain.ConversationMeta) (err error) {
+	ctx, span := c.startSpan(ctx, "UpsertMeta", "PutItem")
+	defer func() { telemetry.EndSpan(span, err) }()
+
+	_, err = c.api.PutItem(ctx, &dynamodb.PutItemInput{
 		TableName: aws.String(c.tableName),
 		Item:      metaItem(meta),
 	})
@@ -161,15 +253,24 @@ func (c *Client) UpsertMeta(ctx context.Context, meta domain.ConversationMeta) e
 }
 
 // SaveTurn writes the completed message and updated metadata in one transaction.
-func (c *Client) SaveTurn(ctx context.Context, msg domain.Message, meta domain.ConversationMeta) error {
+// The message usage is added to the usage totals already stored on the
+// metadata record.
+func (c *Client) SaveTurn(ctx context.Context, msg domain.Message, meta domain.ConversationMeta) (err error) {
+	ctx, span := c.startSpan(ctx, "SaveTurn", "TransactWriteItems")
+	defer func() { telemetry.EndSpan(span, err) }()
+
 	if msg.PK == "" || msg.SK == "" {
 		return errors.New("repository: SaveTurn: message PK and SK are required")
 	}
 	if meta.PK == "" || meta.SK == "" {
 		return errors.New("repository: SaveTurn: meta PK and SK are required")
 	}
+	day := activityDay(meta.PK, meta.LastActivity)
+	if day == "" {
+		return errors.New("repository: SaveTurn: meta lastActivity must be an RFC3339 timestamp")
+	}
 
-	_, err := c.api.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+	_, err = c.api.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
 		TransactItems: []types.TransactWriteItem{
 			{
 				Put: &types.Put{
@@ -179,9 +280,22 @@ func (c *Client) SaveTurn(ctx context.Context, msg domain.Message, meta domain.C
 				},
 			},
 			{
-				Put: &types.Put{
+				Update: &types.Update{
 					TableName: aws.String(c.tableName),
-					Item:      metaItem(meta),
+					Key: map[string]types.AttributeValue{
+						"PK": &types.AttributeValueMemberS{Value: meta.PK},
+						"SK": &types.AttributeValueMemberS{Value: meta.SK},
+					},
+					UpdateExpression: aws.String("SET conversationId = :cid, lastActivity = :la, activityDay = :day, turns = :turns, #ttl = :ttl " +
+						"ADD promptTokens :pt, completionTokens :ct, costUsd :cost"),
+					ExpressionAttributeNames: map[string]string{"#ttl": "ttl"},
+					ExpressionAttributeValues: mergeAttrs(map[string]types.AttributeValue{
+						":cid":   &types.AttributeValueMemberS{Value: meta.ConversationID},
+						":la":    &types.AttributeValueMemberS{Value: meta.LastActivity},
+						":day":   &types.AttributeValueMemberS{Value: day},
+						":turns": &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", meta.Turns)},
+						":ttl":   &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", meta.TTL)},
+					}, usageValues(msg.Usage)),
 				},
 			},
 		},
@@ -192,33 +306,138 @@ func (c *Client) SaveTurn(ctx context.Context, msg domain.Message, meta domain.C
 	return nil
 }
 
-// SaveCompletedTurn persists the successful user turn and updates metadata.
-func (c *Client) SaveCompletedTurn(ctx context.Context, conversationID, question, answer string, turns int) error {
-	msg := NewMessage(conversationID, question)
+// SaveCompletedTurn persists the successful user turn, with the version of
+// the profile that answered it, and updates metadata. It returns the ID of
+// the stored turn.
+func (c *Client) SaveCompletedTurn(ctx context.Context, conversationID, question, answer string, turns int, usage domain.Usage, profileVersion string) (string, error) {
+	tenantID := domain.TenantFromContext(ctx)
+	msg := NewMessage(tenantID, conversationID, question)
 	msg.Answer = answer
-	meta := NewConversationMeta(conversationID, turns)
+	msg.Usage = usage
+	msg.ProfileVersion = profileVersion
+	meta := NewConversationMeta(tenantID, conversationID, turns)
 	if err := c.SaveTurn(ctx, msg, meta); err != nil {
-		return fmt.Errorf("repository: SaveCompletedTurn: %w", err)
+		return "", fmt.Errorf("repository: SaveCompletedTurn: %w", err)
+	}
+	return msg.TurnID, nil
+}
+
+// RecordFeedback attaches a visitor rating to an existing turn.
+func (c *Client) RecordFeedback(ctx context.Context, conversationID, turnID string, rating domain.Rating, comment string) error {
+	if err := c.SaveFeedback(ctx, NewFeedback(domain.TenantFromContext(ctx), conversationID, turnID, rating, comment)); err != nil {
+		return fmt.Errorf("repository: RecordFeedback: %w", err)
+	}
+	return nil
+}
+
+// SaveFeedback writes (or replaces) the feedback record of a turn. The write
+// is conditional on the turn's MSG# record existing; otherwise an error
+// wrapping domain.ErrTurnNotFound is returned.
+func (c *Client) SaveFeedback(ctx context.Context, fb domain.Feedback) (err error) {
+	ctx, span := c.startSpan(ctx, "SaveFeedback", "TransactWriteItems")
+	defer func() { telemetry.EndSpan(span, err) }()
+
+	if fb.PK == "" || fb.SK == "" || fb.TurnID == "" {
+		return errors.New("repository: SaveFeedback: PK, SK and turn ID are required")
+	}
+
+	_, err = c.api.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{
+				ConditionCheck: &types.ConditionCheck{
+					TableName: aws.String(c.tableName),
+					Key: map[string]types.AttributeValue{
+						"PK": &types.AttributeValueMemberS{Value: fb.PK},
+						"SK": &types.AttributeValueMemberS{Value: skPrefixMsg + fb.TurnID},
+					},
+					ConditionExpression: aws.String("attribute_exists(PK)"),
+				},
+			},
+			{
+				Put: &types.Put{
+					TableName: aws.String(c.tableName),
+					Item:      feedbackItem(fb),
+				},
+			},
+		},
+	})
+	if err != nil {
+		if isConditionCheckFailure(err, 0) {
+			return fmt.Errorf("repository: SaveFeedback: %w", domain.ErrTurnNotFound)
+		}
+		return fmt.Errorf("repository: SaveFeedback: %w", err)
+	}
+	return nil
+}
+
+// GetDailySpend returns the usage accumulated for the UTC day containing day.
+func (c *Client) GetDailySpend(ctx context.Context, day time.Time) (_ domain.Usage, err error) {
+	ctx, span := c.startSpan(ctx, "GetDailySpend", "GetItem")
+	defer func() { telemetry.EndSpan(span, err) }()
+
+	out, err := c.api.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(c.tableName),
+		Key: map[string]types.AttributeValue{
+			"PK": &types.AttributeValueMemberS{Value: spendPK(domain.TenantFromContext(ctx), day)},
+			"SK": &types.AttributeValueMemberS{Value: skMeta},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return domain.Usage{}, fmt.Errorf("repository: GetDailySpend get item: %w", err)
+	}
+	if out == nil || len(out.Item) == 0 {
+		return domain.Usage{}, nil
+	}
+
+	usage, err := itemToUsage(out.Item)
+	if err != nil {
+		return domain.Usage{}, fmt.Errorf("repository: GetDailySpend decode usage: %w", err)
+	}
+	return usage, nil
+}
+
+// AddDailySpend atomically adds usage to the counter for the UTC day containing day.
+func (c *Client) AddDailySpend(ctx context.Context, day time.Time, usage domain.Usage) (err error) {
+	ctx, span := c.startSpan(ctx, "AddDailySpend", "UpdateItem")
+	defer func() { telemetry.EndSpan(span, err) }()
+
+	_, err = c.api.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(c.tableName),
+		Key: map[string]types.AttributeValue{
+			"PK": &types.AttributeValueMemberS{Value: spendPK(domain.TenantFromContext(ctx), day)},
+			"SK": &types.AttributeValueMemberS{Value: skMeta},
+		},
+		UpdateExpression:         aws.String("SET #ttl = :ttl ADD promptTokens :pt, completionTokens :ct, costUsd :cost"),
+		ExpressionAttributeNames: map[string]string{"#ttl": "ttl"},
+		ExpressionAttributeValues: mergeAttrs(map[string]types.AttributeValue{
+			":ttl": &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", ttlValue())},
+		}, usageValues(usage)),
+	})
+	if err != nil {
+		return fmt.Errorf("repository: AddDailySpend: %w", err)
 	}
 	return nil
 }
 
-// NewMessage constructs a Message with PK/SK/TTL set from conversationID and current time.
-func NewMessage(conversationID, text string) domain.Message {
+// NewMessage constructs a Message with PK/SK/TTL set from the tenant,
+// conversationID and current time.
+func NewMessage(tenantID, conversationID, text string) domain.Message {
 	now := time.Now().UTC()
 	return domain.Message{
-		PK:             convPK(conversationID),
+		PK:             convPK(tenantID, conversationID),
 		SK:             msgSK(now),
 		ConversationID: conversationID,
+		TurnID:         turnID(now),
 		Text:           text,
 		TTL:            ttlValue(),
 	}
 }
 
 // NewConversationMeta constructs a ConversationMeta record.
-func NewConversationMeta(conversationID string, turns int) domain.ConversationMeta {
+func NewConversationMeta(tenantID, conversationID string, turns int) domain.ConversationMeta {
 	return domain.ConversationMeta{
-		PK:             convPK(conversationID),
+		PK:             convPK(tenantID, conversationID),
 		SK:             skMeta,
 		ConversationID: conversationID,
 		LastActivity:   time.Now().UTC().Format(time.RFC3339),
@@ -227,6 +446,20 @@ func NewConversationMeta(conversationID string, turns int) domain.ConversationMe
 	}
 }
 
+// NewFeedback constructs a Feedback record for a turn of a conversation.
+func NewFeedback(tenantID, conversationID, turnID string, rating domain.Rating, comment string) domain.Feedback {
+	return domain.Feedback{
+		PK:             convPK(tenantID, conversationID),
+		SK:             feedbackSK(turnID),
+		ConversationID: conversationID,
+		TurnID:         turnID,
+		Rating:         rating,
+		Comment:        comment,
+		CreatedAt:      time.Now().UTC().Format(time.RFC3339),
+		TTL:            ttlValue(),
+	}
+}
+
 // itemToMessage converts a DynamoDB attribute map to a Message.
 func itemToMessage(item map[string]types.AttributeValue) (domain.Message, error) {
 	pk, err := strAttr(item, "PK")
@@ -241,36 +474,127 @@ func itemToMessage(item map[string]types.AttributeValue) (domain.Message, error)
 	if err != nil {
 		return domain.Message{}, err
 	}
-	answer, _ := strAttr(item, "answer") // allow empty
+	answer, _ := strAttr(item, "answer")                 // allow empty
+	profileVersion, _ := strAttr(item, "profileVersion") // absent on turns stored before versioning
+	usage, err := itemToUsage(item)
+	if err != nil {
+		return domain.Message{}, err
+	}
 
 	return domain.Message{
-		PK:     pk,
-		SK:     sk,
-		Text:   text,
-		Answer: answer,
+		PK:             pk,
+		SK:             sk,
+		TurnID:         strings.TrimPrefix(sk, skPrefixMsg),
+		Text:           text,
+		Answer:         answer,
+		Usage:          usage,
+		ProfileVersion: profileVersion,
 	}, nil
 }
 
+// itemToUsage decodes the optional usage attributes of an item; records
+// written before usage accounting existed decode to zero usage.
+func itemToUsage(item map[string]types.AttributeValue) (domain.Usage, error) {
+	var usage domain.Usage
+	var err error
+	if _, ok := item["promptTokens"]; ok {
+		if usage.PromptTokens, err = intAttr(item, "promptTokens"); err != nil {
+			return domain.Usage{}, err
+		}
+	}
+	if _, ok := item["completionTokens"]; ok {
+		if usage.CompletionTokens, err = intAttr(item, "completionTokens"); err != nil {
+			return domain.Usage{}, err
+		}
+	}
+	if _, ok := item["costUsd"]; ok {
+		if usage.CostUSD, err = floatAttr(item, "costUsd"); err != nil {
+			return domain.Usage{}, err
+		}
+	}
+	return usage, nil
+}
+
 func messageItem(msg domain.Message) map[string]types.AttributeValue {
 	return map[string]types.AttributeValue{
-		"PK":             &types.AttributeValueMemberS{Value: msg.PK},
-		"SK":             &types.AttributeValueMemberS{Value: msg.SK},
-		"conversationId": &types.AttributeValueMemberS{Value: msg.ConversationID},
-		"text":           &types.AttributeValueMemberS{Value: msg.Text},
-		"answer":         &types.AttributeValueMemberS{Value: msg.Answer},
-		"ttl":            &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", msg.TTL)},
+		"PK":               &types.AttributeValueMemberS{Value: msg.PK},
+		"SK":               &types.AttributeValueMemberS{Value: msg.SK},
+		"conversationId":   &types.AttributeValueMemberS{Value: msg.ConversationID},
+		"text":             &types.AttributeValueMemberS{Value: msg.Text},
+		"answer":           &types.AttributeValueMemberS{Value: msg.Answer},
+		"promptTokens":     &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", msg.Usage.PromptTokens)},
+		"completionTokens": &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", msg.Usage.CompletionTokens)},
+		"costUsd":          &types.AttributeValueMemberN{Value: formatFloat(msg.Usage.CostUSD)},
+		"profileVersion":   &types.AttributeValueMemberS{Value: msg.ProfileVersion},
+		"ttl":              &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", msg.TTL)},
 	}
 }
 
+// metaItem builds the META# item. activityDay is only set for a parseable
+// lastActivity so the item is never written with an empty index key.
 func metaItem(meta domain.ConversationMeta) map[string]types.AttributeValue {
+	item := map[string]types.AttributeValue{
+		"PK":               &types.AttributeValueMemberS{Value: meta.PK},
+		"SK":               &types.AttributeValueMemberS{Value: meta.SK},
+		"conversationId":   &types.AttributeValueMemberS{Value: meta.ConversationID},
+		"lastActivity":     &types.AttributeValueMemberS{Value: meta.LastActivity},
+		"turns":            &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", meta.Turns)},
+		"promptTokens":     &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", meta.Usage.PromptTokens)},
+		"completionTokens": &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", meta.Usage.CompletionTokens)},
+		"costUsd":          &types.AttributeValueMemberN{Value: formatFloat(meta.Usage.CostUSD)},
+		"ttl":              &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", meta.TTL)},
+	}
+	if day := activityDay(meta.PK, meta.LastActivity); day != "" {
+		item["activityDay"] = &types.AttributeValueMemberS{Value: day}
+	}
+	return item
+}
+
+func feedbackItem(fb domain.Feedback) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"PK":             &types.AttributeValueMemberS{Value: fb.PK},
+		"SK":             &types.AttributeValueMemberS{Value: fb.SK},
+		"conversationId": &types.AttributeValueMemberS{Value: fb.ConversationID},
+		"turnId":         &types.AttributeValueMemberS{Value: fb.TurnID},
+		"rating":         &types.AttributeValueMemberS{Value: string(fb.Rating)},
+		"comment":        &types.AttributeValueMemberS{Value: fb.Comment},
+		"createdAt":      &types.AttributeValueMemberS{Value: fb.CreatedAt},
+		"ttl":            &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", fb.TTL)},
+	}
+}
+
+// isConditionCheckFailure reports whether err is a cancelled transaction whose
+// item at index failed its condition expression.
+func isConditionCheckFailure(err error, index int) bool {
+	var canceled *types.TransactionCanceledException
+	if !errors.As(err, &canceled) {
+		return false
+	}
+	if index >= len(canceled.CancellationReasons) {
+		return false
+	}
+	code := canceled.CancellationReasons[index].Code
+	return code != nil && *code == "ConditionalCheckFailed"
+}
+
+// usageValues returns the expression values used by ADD clauses on usage totals.
+func usageValues(usage domain.Usage) map[string]types.AttributeValue {
 	return map[string]types.AttributeValue{
-		"PK":             &types.AttributeValueMemberS{Value: meta.PK},
-		"SK":             &types.AttributeValueMemberS{Value: meta.SK},
-		"conversationId": &types.AttributeValueMemberS{Value: meta.ConversationID},
-		"lastActivity":   &types.AttributeValueMemberS{Value: meta.LastActivity},
-		"turns":          &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", meta.Turns)},
-		"ttl":            &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", meta.TTL)},
+		":pt":   &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", usage.PromptTokens)},
+		":ct":   &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", usage.CompletionTokens)},
+		":cost": &types.AttributeValueMemberN{Value: formatFloat(usage.CostUSD)},
+	}
+}
+
+func mergeAttrs(dst, src map[string]types.AttributeValue) map[string]types.AttributeValue {
+	for k, v := range src {
+		dst[k] = v
 	}
+	return dst
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
 }
 
 func strAttr(item map[string]types.AttributeValue, key string) (string, error) {
@@ -300,3 +624,19 @@ func intAttr(item map[string]types.AttributeValue, key string) (int, error) {
 	}
 	return parsed, nil
 }
+
+func floatAttr(item map[string]types.AttributeValue, key string) (float64, error) {
+	v, ok := item[key]
+	if !ok {
+		return 0, fmt.Errorf("repository: missing attribute %q", key)
+	}
+	n, ok := v.(*types.AttributeValueMemberN)
+	if !ok {
+		return 0, fmt.Errorf("repository: attribute %q is not a number", key)
+	}
+	parsed, err := strconv.ParseFloat(n.Value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("repository: parse attribute %q: %w", key, err)
+	}
+	return parsed, nil
+}
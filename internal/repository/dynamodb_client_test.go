@@ -7,9 +7,15 @@ import (
 	"testing"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 
 	"portfolio-agent/internal/domain"
 )
@@ -18,13 +24,23 @@ type fakeDynamo struct {
 	getOut       *dynamodb.GetItemOutput
 	getErr       error
 	putErr       error
+	updateErr    error
 	queryOut     *dynamodb.QueryOutput
+	queryOuts    []*dynamodb.QueryOutput
 	queryErr     error
 	txErr        error
+	scanOut      *dynamodb.ScanOutput
+	scanErr      error
+	batchOuts    []*dynamodb.BatchWriteItemOutput
+	batchErr     error
 	lastGetInput *dynamodb.GetItemInput
 	lastPutInput *dynamodb.PutItemInput
+	lastUpdateIn *dynamodb.UpdateItemInput
 	lastQueryIn  *dynamodb.QueryInput
+	queryIns     []*dynamodb.QueryInput
 	lastTxInput  *dynamodb.TransactWriteItemsInput
+	lastScanIn   *dynamodb.ScanInput
+	batchIns     []*dynamodb.BatchWriteItemInput
 }
 
 func (f *fakeDynamo) GetItem(_ context.Context, in *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
@@ -37,8 +53,20 @@ func (f *fakeDynamo) PutItem(_ context.Context, in *dynamodb.PutItemInput, _ ...
 	return &dynamodb.PutItemOutput{}, f.putErr
 }
 
+func (f *fakeDynamo) UpdateItem(_ context.Context, in *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	f.lastUpdateIn = in
+	return &dynamodb.UpdateItemOutput{}, f.updateErr
+}
+
+// Query returns the queued outputs in order, then queryOut.
 func (f *fakeDynamo) Query(_ context.Context, in *dynamodb.QueryInput, _ ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
 	f.lastQueryIn = in
+	f.queryIns = append(f.queryIns, in)
+	if f.queryErr == nil && len(f.queryOuts) > 0 {
+		out := f.queryOuts[0]
+		f.queryOuts = f.queryOuts[1:]
+		return out, nil
+	}
 	return f.queryOut, f.queryErr
 }
 
@@ -47,6 +75,25 @@ func (f *fakeDynamo) TransactWriteItems(_ context.Context, in *dynamodb.Transact
 	return &dynamodb.TransactWriteItemsOutput{}, f.txErr
 }
 
+func (f *fakeDynamo) Scan(_ context.Context, in *dynamodb.ScanInput, _ ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	f.lastScanIn = in
+	return f.scanOut, f.scanErr
+}
+
+// BatchWriteItem returns the queued outputs in order, then empty outputs.
+func (f *fakeDynamo) BatchWriteItem(_ context.Context, in *dynamodb.BatchWriteItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
+	f.batchIns = append(f.batchIns, in)
+	if f.batchErr != nil {
+		return nil, f.batchErr
+	}
+	if len(f.batchOuts) > 0 {
+		out := f.batchOuts[0]
+		f.batchOuts = f.batchOuts[1:]
+		return out, nil
+	}
+	return &dynamodb.BatchWriteItemOutput{}, nil
+}
+
 func makeItem(pk, sk, text, answer string) map[string]types.AttributeValue {
 	return map[string]types.AttributeValue{
 		"PK":     &types.AttributeValueMemberS{Value: pk},
@@ -183,7 +230,7 @@ func TestGetHistory_ReordersDescendingResultsToChronological(t *testing.T) {
 func TestWriteMessage_HappyPath(t *testing.T) {
 	db := &fakeDynamo{}
 	c := mustNewClient(t, db)
-	msg := NewMessage("abc", "Who are you?")
+	msg := NewMessage("", "abc", "Who are you?")
 	msg.Answer = "I am your assistant."
 	err := c.WriteMessage(context.Background(), msg)
 	require.NoError(t, err)
@@ -194,7 +241,7 @@ func TestWriteMessage_HappyPath(t *testing.T) {
 func TestWriteMessage_DynamoError(t *testing.T) {
 	db := &fakeDynamo{putErr: errors.New("ProvisionedThroughputExceededException")}
 	c := mustNewClient(t, db)
-	err := c.WriteMessage(context.Background(), NewMessage("abc", "Who are you?"))
+	err := c.WriteMessage(context.Background(), NewMessage("", "abc", "Who are you?"))
 	require.Error(t, err)
 	require.Contains(t, err.Error(), "WriteMessage")
 }
@@ -218,14 +265,14 @@ func TestWriteMessage_MissingSK(t *testing.T) {
 func TestUpsertMeta_HappyPath(t *testing.T) {
 	db := &fakeDynamo{}
 	c := mustNewClient(t, db)
-	err := c.UpsertMeta(context.Background(), NewConversationMeta("abc", 3))
+	err := c.UpsertMeta(context.Background(), NewConversationMeta("", "abc", 3))
 	require.NoError(t, err)
 }
 
 func TestUpsertMeta_DynamoError(t *testing.T) {
 	db := &fakeDynamo{putErr: errors.New("internal server error")}
 	c := mustNewClient(t, db)
-	err := c.UpsertMeta(context.Background(), NewConversationMeta("abc", 1))
+	err := c.UpsertMeta(context.Background(), NewConversationMeta("", "abc", 1))
 	require.Error(t, err)
 	require.Contains(t, err.Error(), "UpsertMeta")
 }
@@ -233,9 +280,9 @@ func TestUpsertMeta_DynamoError(t *testing.T) {
 func TestSaveTurn_HappyPath(t *testing.T) {
 	db := &fakeDynamo{}
 	c := mustNewClient(t, db)
-	msg := NewMessage("abc", "Who are you?")
+	msg := NewMessage("", "abc", "Who are you?")
 	msg.Answer = "I am your assistant."
-	meta := NewConversationMeta("abc", 2)
+	meta := NewConversationMeta("", "abc", 2)
 
 	err := c.SaveTurn(context.Background(), msg, meta)
 	require.NoError(t, err)
@@ -247,7 +294,7 @@ func TestSaveTurn_HappyPath(t *testing.T) {
 func TestSaveTurn_DynamoError(t *testing.T) {
 	db := &fakeDynamo{txErr: errors.New("transaction canceled")}
 	c := mustNewClient(t, db)
-	err := c.SaveTurn(context.Background(), NewMessage("abc", "Who are you?"), NewConversationMeta("abc", 2))
+	err := c.SaveTurn(context.Background(), NewMessage("", "abc", "Who are you?"), NewConversationMeta("", "abc", 2))
 	require.Error(t, err)
 	require.Contains(t, err.Error(), "SaveTurn")
 }
@@ -255,7 +302,7 @@ func TestSaveTurn_DynamoError(t *testing.T) {
 func TestSaveTurn_MissingMessagePK(t *testing.T) {
 	db := &fakeDynamo{}
 	c := mustNewClient(t, db)
-	err := c.SaveTurn(context.Background(), domain.Message{SK: "MSG#ts"}, NewConversationMeta("abc", 1))
+	err := c.SaveTurn(context.Background(), domain.Message{SK: "MSG#ts"}, NewConversationMeta("", "abc", 1))
 	require.Error(t, err)
 	require.Contains(t, err.Error(), "message PK")
 }
@@ -263,7 +310,7 @@ func TestSaveTurn_MissingMessagePK(t *testing.T) {
 func TestSaveTurn_MissingMetaPK(t *testing.T) {
 	db := &fakeDynamo{}
 	c := mustNewClient(t, db)
-	err := c.SaveTurn(context.Background(), NewMessage("abc", "hi"), domain.ConversationMeta{SK: skMeta})
+	err := c.SaveTurn(context.Background(), NewMessage("", "abc", "hi"), domain.ConversationMeta{SK: skMeta})
 	require.Error(t, err)
 	require.Contains(t, err.Error(), "meta PK")
 }
@@ -271,30 +318,185 @@ func TestSaveTurn_MissingMetaPK(t *testing.T) {
 func TestSaveCompletedTurn_HappyPath(t *testing.T) {
 	db := &fakeDynamo{}
 	c := mustNewClient(t, db)
-	err := c.SaveCompletedTurn(context.Background(), "abc", "Who are you?", "I am your assistant.", 2)
+	turnID, err := c.SaveCompletedTurn(context.Background(), "abc", "Who are you?", "I am your assistant.", 2, domain.Usage{}, "")
 	require.NoError(t, err)
 	require.NotNil(t, db.lastTxInput)
 	require.Len(t, db.lastTxInput.TransactItems, 2)
+	require.NotEmpty(t, turnID)
+	require.Equal(t, "MSG#"+turnID, db.lastTxInput.TransactItems[0].Put.Item["SK"].(*types.AttributeValueMemberS).Value)
+}
+
+func TestSaveCompletedTurn_AccumulatesUsageOnMeta(t *testing.T) {
+	db := &fakeDynamo{}
+	c := mustNewClient(t, db)
+	usage := domain.Usage{PromptTokens: 120, CompletionTokens: 30, CostUSD: 0.0042}
+	_, err := c.SaveCompletedTurn(context.Background(), "abc", "Who are you?", "I am your assistant.", 2, usage, "")
+	require.NoError(t, err)
+
+	msgItem := db.lastTxInput.TransactItems[0].Put.Item
+	require.Equal(t, "120", msgItem["promptTokens"].(*types.AttributeValueMemberN).Value)
+	require.Equal(t, "30", msgItem["completionTokens"].(*types.AttributeValueMemberN).Value)
+	require.Equal(t, "0.0042", msgItem["costUsd"].(*types.AttributeValueMemberN).Value)
+
+	update := db.lastTxInput.TransactItems[1].Update
+	require.NotNil(t, update)
+	require.Equal(t, "CONV#abc", update.Key["PK"].(*types.AttributeValueMemberS).Value)
+	require.Contains(t, *update.UpdateExpression, "ADD promptTokens :pt, completionTokens :ct, costUsd :cost")
+	require.Equal(t, "2", update.ExpressionAttributeValues[":turns"].(*types.AttributeValueMemberN).Value)
+	require.Equal(t, "120", update.ExpressionAttributeValues[":pt"].(*types.AttributeValueMemberN).Value)
+	require.Equal(t, "0.0042", update.ExpressionAttributeValues[":cost"].(*types.AttributeValueMemberN).Value)
+}
+
+func TestGetDailySpend_HappyPath(t *testing.T) {
+	db := &fakeDynamo{getOut: &dynamodb.GetItemOutput{Item: map[string]types.AttributeValue{
+		"PK":               &types.AttributeValueMemberS{Value: "SPEND#2026-02-25"},
+		"SK":               &types.AttributeValueMemberS{Value: skMeta},
+		"promptTokens":     &types.AttributeValueMemberN{Value: "1000"},
+		"completionTokens": &types.AttributeValueMemberN{Value: "200"},
+		"costUsd":          &types.AttributeValueMemberN{Value: "1.25"},
+	}}}
+	c := mustNewClient(t, db)
+	usage, err := c.GetDailySpend(context.Background(), time.Date(2026, 2, 25, 23, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	require.Equal(t, domain.Usage{PromptTokens: 1000, CompletionTokens: 200, CostUSD: 1.25}, usage)
+	require.Equal(t, "SPEND#2026-02-25", db.lastGetInput.Key["PK"].(*types.AttributeValueMemberS).Value)
+}
+
+func TestGetDailySpend_MissingItem(t *testing.T) {
+	db := &fakeDynamo{getOut: &dynamodb.GetItemOutput{}}
+	c := mustNewClient(t, db)
+	usage, err := c.GetDailySpend(context.Background(), time.Now())
+	require.NoError(t, err)
+	require.Zero(t, usage)
+}
+
+func TestGetDailySpend_GetItemError(t *testing.T) {
+	db := &fakeDynamo{getErr: errors.New("boom")}
+	c := mustNewClient(t, db)
+	_, err := c.GetDailySpend(context.Background(), time.Now())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "GetDailySpend")
+}
+
+func TestAddDailySpend_HappyPath(t *testing.T) {
+	db := &fakeDynamo{}
+	c := mustNewClient(t, db)
+	err := c.AddDailySpend(context.Background(), time.Date(2026, 2, 25, 1, 0, 0, 0, time.UTC), domain.Usage{PromptTokens: 10, CompletionTokens: 5, CostUSD: 0.5})
+	require.NoError(t, err)
+	require.Equal(t, "SPEND#2026-02-25", db.lastUpdateIn.Key["PK"].(*types.AttributeValueMemberS).Value)
+	require.Contains(t, *db.lastUpdateIn.UpdateExpression, "ADD promptTokens :pt, completionTokens :ct, costUsd :cost")
+	require.Equal(t, "0.5", db.lastUpdateIn.ExpressionAttributeValues[":cost"].(*types.AttributeValueMemberN).Value)
+}
+
+func TestAddDailySpend_DynamoError(t *testing.T) {
+	db := &fakeDynamo{updateErr: errors.New("throttled")}
+	c := mustNewClient(t, db)
+	err := c.AddDailySpend(context.Background(), time.Now(), domain.Usage{})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "AddDailySpend")
 }
 
 func TestSaveCompletedTurn_DynamoError(t *testing.T) {
 	db := &fakeDynamo{txErr: errors.New("transaction canceled")}
 	c := mustNewClient(t, db)
-	err := c.SaveCompletedTurn(context.Background(), "abc", "Who are you?", "I am your assistant.", 2)
+	_, err := c.SaveCompletedTurn(context.Background(), "abc", "Who are you?", "I am your assistant.", 2, domain.Usage{}, "")
 	require.Error(t, err)
 	require.Contains(t, err.Error(), "SaveCompletedTurn")
 }
 
+func TestSaveFeedback_HappyPath(t *testing.T) {
+	db := &fakeDynamo{}
+	c := mustNewClient(t, db)
+	fb := NewFeedback("", "abc", "2026-02-27T12:00:00Z", domain.RatingUp, "Helpful")
+	err := c.SaveFeedback(context.Background(), fb)
+	require.NoError(t, err)
+
+	items := db.lastTxInput.TransactItems
+	require.Len(t, items, 2)
+	require.Equal(t, "MSG#2026-02-27T12:00:00Z", items[0].ConditionCheck.Key["SK"].(*types.AttributeValueMemberS).Value)
+	require.Equal(t, "attribute_exists(PK)", *items[0].ConditionCheck.ConditionExpression)
+	require.Equal(t, "CONV#abc", items[1].Put.Item["PK"].(*types.AttributeValueMemberS).Value)
+	require.Equal(t, "FEEDBACK#2026-02-27T12:00:00Z", items[1].Put.Item["SK"].(*types.AttributeValueMemberS).Value)
+	require.Equal(t, "up", items[1].Put.Item["rating"].(*types.AttributeValueMemberS).Value)
+	require.Equal(t, "Helpful", items[1].Put.Item["comment"].(*types.AttributeValueMemberS).Value)
+}
+
+func TestSaveFeedback_TurnNotFound(t *testing.T) {
+	db := &fakeDynamo{txErr: &types.TransactionCanceledException{
+		CancellationReasons: []types.CancellationReason{
+			{Code: aws.String("ConditionalCheckFailed")},
+			{Code: aws.String("None")},
+		},
+	}}
+	c := mustNewClient(t, db)
+	err := c.SaveFeedback(context.Background(), NewFeedback("", "abc", "missing", domain.RatingDown, ""))
+	require.ErrorIs(t, err, domain.ErrTurnNotFound)
+}
+
+func TestRecordFeedback_HappyPath(t *testing.T) {
+	db := &fakeDynamo{}
+	c := mustNewClient(t, db)
+	err := c.RecordFeedback(context.Background(), "abc", "2026-02-27T12:00:00Z", domain.RatingDown, "")
+	require.NoError(t, err)
+	require.Equal(t, "FEEDBACK#2026-02-27T12:00:00Z", db.lastTxInput.TransactItems[1].Put.Item["SK"].(*types.AttributeValueMemberS).Value)
+}
+
+func TestSaveFeedback_DynamoError(t *testing.T) {
+	db := &fakeDynamo{txErr: errors.New("throttled")}
+	c := mustNewClient(t, db)
+	err := c.SaveFeedback(context.Background(), NewFeedback("", "abc", "ts", domain.RatingDown, ""))
+	require.Error(t, err)
+	require.NotErrorIs(t, err, domain.ErrTurnNotFound)
+	require.Contains(t, err.Error(), "SaveFeedback")
+}
+
+func TestSaveFeedback_MissingTurnID(t *testing.T) {
+	db := &fakeDynamo{}
+	c := mustNewClient(t, db)
+	err := c.SaveFeedback(context.Background(), domain.Feedback{PK: "CONV#abc", SK: "FEEDBACK#"})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "required")
+	require.Nil(t, db.lastTxInput)
+}
+
+func TestGetHistory_SetsTurnID(t *testing.T) {
+	db := &fakeDynamo{
+		queryOut: &dynamodb.QueryOutput{
+			Items: []map[string]types.AttributeValue{
+				makeItem("CONV#abc", "MSG#2026-02-27T12:00:00Z", "Hello?", "Hi"),
+			},
+		},
+	}
+	c := mustNewClient(t, db)
+	msgs, err := c.GetHistory(context.Background(), "abc", 20)
+	require.NoError(t, err)
+	require.Equal(t, "2026-02-27T12:00:00Z", msgs[0].TurnID)
+}
+
+func TestSaveCompletedTurn_StoresProfileVersion(t *testing.T) {
+	db := &fakeDynamo{}
+	c := mustNewClient(t, db)
+	_, err := c.SaveCompletedTurn(context.Background(), "abc", "q", "a", 1, domain.Usage{}, "resume:3,sha256:abc")
+	require.NoError(t, err)
+	item := db.lastTxInput.TransactItems[0].Put.Item
+	require.Equal(t, "resume:3,sha256:abc", item["profileVersion"].(*types.AttributeValueMemberS).Value)
+
+	msg, err := itemToMessage(item)
+	require.NoError(t, err)
+	require.Equal(t, "resume:3,sha256:abc", msg.ProfileVersion)
+}
+
 func TestNewMessage_Fields(t *testing.T) {
-	msg := NewMessage("conv-1", "What is Go?")
+	msg := NewMessage("", "conv-1", "What is Go?")
 	require.Equal(t, "CONV#conv-1", msg.PK)
 	require.Contains(t, msg.SK, "MSG#")
 	require.Equal(t, "What is Go?", msg.Text)
+	require.Equal(t, "MSG#"+msg.TurnID, msg.SK)
 	require.Greater(t, msg.TTL, int64(0))
 }
 
 func TestNewConversationMeta_Fields(t *testing.T) {
-	meta := NewConversationMeta("conv-2", 5)
+	meta := NewConversationMeta("", "conv-2", 5)
 	require.Equal(t, "CONV#conv-2", meta.PK)
 	require.Equal(t, skMeta, meta.SK)
 	require.Equal(t, 5, meta.Turns)
@@ -302,7 +504,7 @@ func TestNewConversationMeta_Fields(t *testing.T) {
 }
 
 func TestConvPK(t *testing.T) {
-	require.Equal(t, "CONV#my-conv", convPK("my-conv"))
+	require.Equal(t, "CONV#my-conv", convPK("", "my-conv"))
 }
 
 func TestMsgSK(t *testing.T) {
@@ -323,3 +525,22 @@ func TestNew_EmptyTableName(t *testing.T) {
 	require.Error(t, err)
 	require.Contains(t, err.Error(), "must not be empty")
 }
+
+func TestGetHistory_RecordsSpan(t *testing.T) {
+	prev := otel.GetTracerProvider()
+	rec := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	db := &fakeDynamo{queryErr: errors.New("ResourceNotFoundException")}
+	c := mustNewClient(t, db)
+	_, err := c.GetHistory(context.Background(), "abc", 20)
+	require.Error(t, err)
+
+	spans := rec.Ended()
+	require.Len(t, spans, 1)
+	require.Equal(t, "repository.GetHistory", spans[0].Name())
+	require.Equal(t, codes.Error, spans[0].Status().Code)
+	require.Contains(t, spans[0].Attributes(), attribute.String("db.operation", "Query"))
+	require.Contains(t, spans[0].Attributes(), attribute.String("aws.dynamodb.table_names", "test-table"))
+}
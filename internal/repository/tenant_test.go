@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/require"
+
+	"portfolio-agent/internal/domain"
+)
+
+func sAttr(t *testing.T, item map[string]types.AttributeValue, key string) string {
+	t.Helper()
+	v, ok := item[key].(*types.AttributeValueMemberS)
+	require.True(t, ok, "attribute %q is not a string", key)
+	return v.Value
+}
+
+func TestTenantIsolation_HistoryReadsOwnPartition(t *testing.T) {
+	db := &fakeDynamo{queryOut: &dynamodb.QueryOutput{}}
+	c := mustNewClient(t, db)
+
+	_, err := c.GetHistory(domain.WithTenant(context.Background(), "alice"), "conv-1", 10)
+	require.NoError(t, err)
+	require.Equal(t, "TENANT#alice#CONV#conv-1", sAttr(t, db.lastQueryIn.ExpressionAttributeValues, ":pk"))
+
+	_, err = c.GetHistory(domain.WithTenant(context.Background(), "bob"), "conv-1", 10)
+	require.NoError(t, err)
+	require.Equal(t, "TENANT#bob#CONV#conv-1", sAttr(t, db.lastQueryIn.ExpressionAttributeValues, ":pk"))
+
+	_, err = c.GetHistory(context.Background(), "conv-1", 10)
+	require.NoError(t, err)
+	require.Equal(t, "CONV#conv-1", sAttr(t, db.lastQueryIn.ExpressionAttributeValues, ":pk"))
+}
+
+func TestTenantIsolation_TurnCountReadsOwnMeta(t *testing.T) {
+	db := &fakeDynamo{getOut: &dynamodb.GetItemOutput{}}
+	c := mustNewClient(t, db)
+
+	for tenant, want := range map[string]string{
+		"alice": "TENANT#alice#CONV#conv-1",
+		"bob":   "TENANT#bob#CONV#conv-1",
+		"":      "CONV#conv-1",
+	} {
+		turns, err := c.GetConversationTurnCount(domain.WithTenant(context.Background(), tenant), "conv-1")
+		require.NoError(t, err)
+		require.Zero(t, turns)
+		require.Equal(t, want, sAttr(t, db.lastGetInput.Key, "PK"))
+	}
+}
+
+func TestTenantIsolation_SaveCompletedTurnWritesOwnPartition(t *testing.T) {
+	db := &fakeDynamo{}
+	c := mustNewClient(t, db)
+
+	_, err := c.SaveCompletedTurn(domain.WithTenant(context.Background(), "alice"), "conv-1", "q", "a", 1, domain.Usage{}, "")
+	require.NoError(t, err)
+
+	items := db.lastTxInput.TransactItems
+	require.Equal(t, "TENANT#alice#CONV#conv-1", sAttr(t, items[0].Put.Item, "PK"))
+	require.Equal(t, "TENANT#alice#CONV#conv-1", sAttr(t, items[1].Update.Key, "PK"))
+	day := sAttr(t, items[1].Update.ExpressionAttributeValues, ":day")
+	require.Regexp(t, `^TENANT#alice#\d{4}-\d{2}-\d{2}$`, day)
+}
+
+func TestTenantIsolation_SpendAndFeedbackAreScoped(t *testing.T) {
+	db := &fakeDynamo{getOut: &dynamodb.GetItemOutput{}}
+	c := mustNewClient(t, db)
+	ctx := domain.WithTenant(context.Background(), "alice")
+	day := time.Date(2026, 2, 27, 12, 0, 0, 0, time.UTC)
+
+	_, err := c.GetDailySpend(ctx, day)
+	require.NoError(t, err)
+	require.Equal(t, "TENANT#alice#SPEND#2026-02-27", sAttr(t, db.lastGetInput.Key, "PK"))
+
+	require.NoError(t, c.RecordFeedback(ctx, "conv-1", "2026-02-27T12:00:00Z", domain.RatingUp, ""))
+	check := db.lastTxInput.TransactItems[0].ConditionCheck
+	require.Equal(t, "TENANT#alice#CONV#conv-1", sAttr(t, check.Key, "PK"))
+}
+
+func TestTenantIsolation_ListingsAreScoped(t *testing.T) {
+	db := &fakeDynamo{scanOut: &dynamodb.ScanOutput{}, queryOut: &dynamodb.QueryOutput{}}
+	c := mustNewClient(t, db)
+	ctx := domain.WithTenant(context.Background(), "alice")
+
+	_, err := c.ListRecentConversations(ctx, 10)
+	require.NoError(t, err)
+	require.Equal(t, "TENANT#alice#CONV#", sAttr(t, db.lastScanIn.ExpressionAttributeValues, ":conv"))
+
+	now := time.Date(2026, 2, 27, 12, 0, 0, 0, time.UTC)
+	_, err = c.ListConversations(ctx, now.Add(-time.Hour), now, "")
+	require.NoError(t, err)
+	require.Equal(t, "TENANT#alice#2026-02-27", sAttr(t, db.lastQueryIn.ExpressionAttributeValues, ":day"))
+}
+
+func TestItemToMeta_StripsTenantPrefix(t *testing.T) {
+	meta, err := itemToMeta(makeMetaItem("TENANT#alice#CONV#conv-1", 2))
+	require.NoError(t, err)
+	require.Equal(t, "conv-1", meta.ConversationID)
+}
@@ -0,0 +1,260 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+const (
+	// Redacted replaces secret values and the values of sensitive keys.
+	Redacted = "[REDACTED]"
+	// DefaultMaxValueLen bounds logged string values, e.g. upstream error
+	// bodies embedded in error messages.
+	DefaultMaxValueLen = 512
+)
+
+// DefaultSensitiveKeys are attribute keys whose values are never logged:
+// visitor questions and answers (S-03), prompts (S-02) and credentials (S-01).
+var DefaultSensitiveKeys = []string{
+	"question", "answer", "prompt", "system_prompt", "messages",
+	"authorization", "api_key", "apikey", "token", "password", "secret",
+}
+
+// secretPatterns match credentials that have not been registered as secrets,
+// such as an OpenAI key echoed in an upstream error body.
+var secretPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`sk-[A-Za-z0-9_-]{16,}`),
+	regexp.MustCompile(`(?i)bearer\s+[A-Za-z0-9._~+/=-]+`),
+}
+
+// Secrets is a concurrency-safe set of values that must never be logged.
+// Values are added as they become known, e.g. once an API key is fetched.
+type Secrets struct {
+	mu     sync.RWMutex
+	values map[string]struct{}
+}
+
+// Add registers value as a secret. Blank values are ignored.
+func (s *Secrets) Add(value string) {
+	if strings.TrimSpace(value) == "" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.values == nil {
+		s.values = make(map[string]struct{})
+	}
+	s.values[value] = struct{}{}
+}
+
+func (s *Secrets) scrub(text string) string {
+	if s == nil {
+		return text
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for v := range s.values {
+		text = strings.ReplaceAll(text, v, Redacted)
+	}
+	return text
+}
+
+// RedactOption configures a RedactingHandler.
+type RedactOption func(*redactConfig)
+
+type redactConfig struct {
+	secrets     *Secrets
+	keys        map[string]bool
+	maxValueLen int
+}
+
+// WithSecrets scrubs the values registered in secrets from every message and
+// string or error attribute.
+func WithSecrets(secrets *Secrets) RedactOption {
+	return func(c *redactConfig) {
+		c.secrets = secrets
+	}
+}
+
+// WithSensitiveKeys replaces DefaultSensitiveKeys. Keys match
+// case-insensitively and at any group depth.
+func WithSensitiveKeys(keys ...string) RedactOption {
+	return func(c *redactConfig) {
+		c.keys = keySet(keys)
+	}
+}
+
+// WithMaxValueLen truncates string values longer than n bytes. n <= 0
+// disables truncation.
+func WithMaxValueLen(n int) RedactOption {
+	return func(c *redactConfig) {
+		c.maxValueLen = n
+	}
+}
+
+// RedactingHandler is a slog.Handler that scrubs secrets from log records
+// before passing them to the wrapped handler. It enforces the S-01, S-02 and
+// S-03 criteria for every logger built on it:
+//   - values of sensitive keys are replaced with Redacted
+//   - registered secrets, request secrets in the record's context and
+//     credential-like strings are replaced in the message and in string and
+//     error values
+//   - long string values are truncated
+//
+// Attributes bound with WithAttrs are redacted when each record is handled,
+// so secrets registered later still apply to them.
+type RedactingHandler struct {
+	next  slog.Handler
+	cfg   *redactConfig
+	scope []scopeOp // groups and bound attributes, oldest first
+}
+
+// scopeOp is one WithGroup or WithAttrs call, applied to next per record.
+type scopeOp struct {
+	group string
+	attrs []slog.Attr
+}
+
+// NewRedactingHandler wraps next with redaction.
+func NewRedactingHandler(next slog.Handler, opts ...RedactOption) *RedactingHandler {
+	cfg := &redactConfig{
+		keys:        keySet(DefaultSensitiveKeys),
+		maxValueLen: DefaultMaxValueLen,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return &RedactingHandler{next: next, cfg: cfg}
+}
+
+type requestSecretsKey struct{}
+
+// eventKey is the attribute naming a log event, e.g. "ask.rejected". Log
+// metric filters match on it.
+const eventKey = "event"
+
+// WithRequestSecrets returns a context whose log records also have values
+// scrubbed, e.g. the visitor's question, which an upstream error may echo.
+// The JSON-escaped form of each value is scrubbed as well. Request values
+// are never scrubbed from the message or the event attribute, so a short
+// question such as "ask" cannot corrupt event names.
+func WithRequestSecrets(ctx context.Context, values ...string) context.Context {
+	prev, _ := ctx.Value(requestSecretsKey{}).([]string)
+	merged := make([]string, 0, len(prev)+2*len(values))
+	merged = append(merged, prev...)
+	for _, v := range values {
+		if strings.TrimSpace(v) == "" {
+			continue
+		}
+		merged = append(merged, v)
+		if quoted, err := json.Marshal(v); err == nil {
+			if escaped := string(quoted[1 : len(quoted)-1]); escaped != v {
+				merged = append(merged, escaped)
+			}
+		}
+	}
+	return context.WithValue(ctx, requestSecretsKey{}, merged)
+}
+
+func (h *RedactingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *RedactingHandler) Handle(ctx context.Context, r slog.Record) error {
+	request, _ := ctx.Value(requestSecretsKey{}).([]string)
+	next := h.next
+	for _, op := range h.scope {
+		if op.group != "" {
+			next = next.WithGroup(op.group)
+			continue
+		}
+		attrs := make([]slog.Attr, len(op.attrs))
+		for i, a := range op.attrs {
+			attrs[i] = h.redactAttr(a, request)
+		}
+		next = next.WithAttrs(attrs)
+	}
+
+	out := slog.NewRecord(r.Time, r.Level, h.scrubString(r.Message, nil), r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		out.AddAttrs(h.redactAttr(a, request))
+		return true
+	})
+	return next.Handle(ctx, out)
+}
+
+func (h *RedactingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	return h.withScope(scopeOp{attrs: attrs})
+}
+
+func (h *RedactingHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return h.withScope(scopeOp{group: name})
+}
+
+func (h *RedactingHandler) withScope(op scopeOp) *RedactingHandler {
+	scope := make([]scopeOp, len(h.scope), len(h.scope)+1)
+	copy(scope, h.scope)
+	return &RedactingHandler{next: h.next, cfg: h.cfg, scope: append(scope, op)}
+}
+
+func (h *RedactingHandler) redactAttr(a slog.Attr, request []string) slog.Attr {
+	if h.cfg.keys[strings.ToLower(a.Key)] {
+		return slog.String(a.Key, Redacted)
+	}
+	v := a.Value.Resolve()
+	switch v.Kind() {
+	case slog.KindString:
+		if a.Key == eventKey {
+			return slog.String(a.Key, h.scrubString(v.String(), nil))
+		}
+		return slog.String(a.Key, h.scrubString(v.String(), request))
+	case slog.KindGroup:
+		group := v.Group()
+		redacted := make([]any, len(group))
+		for i, ga := range group {
+			redacted[i] = h.redactAttr(ga, request)
+		}
+		return slog.Group(a.Key, redacted...)
+	case slog.KindAny:
+		switch x := v.Any().(type) {
+		case error:
+			return slog.String(a.Key, h.scrubString(x.Error(), request))
+		case fmt.Stringer:
+			return slog.String(a.Key, h.scrubString(x.String(), request))
+		}
+	}
+	return slog.Attr{Key: a.Key, Value: v}
+}
+
+func (h *RedactingHandler) scrubString(s string, request []string) string {
+	s = h.cfg.secrets.scrub(s)
+	for _, v := range request {
+		s = strings.ReplaceAll(s, v, Redacted)
+	}
+	for _, re := range secretPatterns {
+		s = re.ReplaceAllString(s, Redacted)
+	}
+	if n := h.cfg.maxValueLen; n > 0 && len(s) > n {
+		s = fmt.Sprintf("%s...(%d bytes truncated)", strings.ToValidUTF8(s[:n], ""), len(s)-n)
+	}
+	return s
+}
+
+func keySet(keys []string) map[string]bool {
+	set := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		set[strings.ToLower(k)] = true
+	}
+	return set
+}
@@ -0,0 +1,117 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newRedactingLogger(opts ...RedactOption) (*slog.Logger, *bytes.Buffer) {
+	var buf bytes.Buffer
+	return slog.New(NewRedactingHandler(slog.NewJSONHandler(&buf, nil), opts...)), &buf
+}
+
+func TestRedactingHandler_SensitiveKeys(t *testing.T) {
+	log, buf := newRedactingLogger()
+	log.With("Question", "where do you live?").Info("ask.rejected",
+		"answer", "at home",
+		slog.Group("http", "authorization", "Bearer abc", "status", 502),
+		"prompt_tokens", 12,
+	)
+
+	var rec map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &rec))
+	require.Equal(t, Redacted, rec["Question"])
+	require.Equal(t, Redacted, rec["answer"])
+	require.Equal(t, map[string]any{"authorization": Redacted, "status": float64(502)}, rec["http"])
+	require.Equal(t, float64(12), rec["prompt_tokens"])
+}
+
+func TestRedactingHandler_ScrubsRegisteredSecrets(t *testing.T) {
+	secrets := &Secrets{}
+	log, buf := newRedactingLogger(WithSecrets(secrets))
+
+	secrets.Add("You are Jane's private assistant.")
+	secrets.Add("  ")
+	log.Info("prompt was You are Jane's private assistant.",
+		"err", fmt.Errorf("wrapped: %w", errors.New("echo: You are Jane's private assistant.")),
+		"detail", "no secrets here",
+	)
+
+	require.NotContains(t, buf.String(), "private assistant")
+	require.Contains(t, buf.String(), "no secrets here")
+	require.Equal(t, 2, strings.Count(buf.String(), Redacted))
+}
+
+func TestRedactingHandler_ScrubsCredentialPatterns(t *testing.T) {
+	log, buf := newRedactingLogger()
+	log.Error("upstream failed", "err", errors.New(`openai: unexpected status 401: {"error":"Incorrect API key provided: sk-proj-abcdefghijklmnop1234"} Authorization: Bearer tok.123`))
+
+	require.NotContains(t, buf.String(), "sk-proj-abcdefghijklmnop1234")
+	require.NotContains(t, buf.String(), "tok.123")
+	require.Contains(t, buf.String(), "unexpected status 401")
+}
+
+func TestRedactingHandler_TruncatesLongValues(t *testing.T) {
+	log, buf := newRedactingLogger(WithMaxValueLen(16))
+	log.Info("upstream body", "err", errors.New(strings.Repeat("x", 4096)))
+
+	var rec map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &rec))
+	require.Equal(t, strings.Repeat("x", 16)+"...(4080 bytes truncated)", rec["err"])
+}
+
+func TestRedactingHandler_CustomSensitiveKeys(t *testing.T) {
+	log, buf := newRedactingLogger(WithSensitiveKeys("resume"))
+	log.WithGroup("profile").Info("loaded", "resume", "Jane Doe", "question", "kept")
+
+	var rec map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &rec))
+	require.Equal(t, map[string]any{"resume": Redacted, "question": "kept"}, rec["profile"])
+}
+
+func TestRedactingHandler_RequestSecretsFromContext(t *testing.T) {
+	log, buf := newRedactingLogger()
+	ctx := WithRequestSecrets(context.Background(), `Is "Jane" your name?`, "")
+
+	log.With("err", errors.New(`upstream echoed {"input":"Is \"Jane\" your name?"}`)).
+		WarnContext(ctx, "rejected", "detail", `Is "Jane" your name?`)
+	log.Info("other request", "detail", `Is "Jane" your name?`)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+	require.NotContains(t, lines[0], "Jane")
+	require.Contains(t, lines[1], "Jane", "request secrets apply only to records logged with that context")
+}
+
+func TestRedactingHandler_RequestValuesKeepEventNames(t *testing.T) {
+	log, buf := newRedactingLogger()
+	ctx := WithRequestSecrets(context.Background(), "rejected", " ")
+
+	log.WarnContext(ctx, "ask.rejected", "event", "ask.rejected", "detail", "upstream echoed rejected")
+
+	var rec map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &rec))
+	require.Equal(t, "ask.rejected", rec["msg"], "the message is not scrubbed of request values")
+	require.Equal(t, "ask.rejected", rec["event"], "nor is the event name")
+	require.Equal(t, "upstream echoed "+Redacted, rec["detail"], "short values are scrubbed from other attributes")
+}
+
+func TestRedactingHandler_BoundAttrsUseSecretsRegisteredLater(t *testing.T) {
+	secrets := &Secrets{}
+	log, buf := newRedactingLogger(WithSecrets(secrets))
+	bound := log.With("err", errors.New("key sk_live_value")).WithGroup("g")
+
+	secrets.Add("sk_live_value")
+	bound.Info("later", "k", "v")
+
+	require.NotContains(t, buf.String(), "sk_live_value")
+	require.Contains(t, buf.String(), `"g":{"k":"v"}`)
+}
@@ -0,0 +1,110 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Supported values for the trace exporter setting.
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterOTLP   = "otlp"
+)
+
+// Propagator is the W3C trace context propagator used for inbound
+// `traceparent` headers and outbound HTTP calls.
+var Propagator propagation.TextMapPropagator = propagation.TraceContext{}
+
+// Config selects how spans are exported.
+type Config struct {
+	ServiceName string
+	Exporter    string
+	// Writer receives stdout exporter output. Defaults to os.Stdout.
+	Writer io.Writer
+}
+
+// NewTracerProvider builds a tracer provider for the configured exporter and
+// installs it, together with the W3C propagator, as the global provider.
+// With ExporterNone a provider without span processors is installed so spans
+// are created (and trace context is propagated) but nothing is exported.
+func NewTracerProvider(ctx context.Context, cfg Config) (*sdktrace.TracerProvider, error) {
+	serviceName := strings.TrimSpace(cfg.ServiceName)
+	if serviceName == "" {
+		return nil, errors.New("telemetry: service name must not be empty")
+	}
+
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", serviceName))),
+	}
+
+	exporter, err := newExporter(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if exporter != nil {
+		opts = append(opts, sdktrace.WithBatcher(exporter))
+	}
+
+	tp := sdktrace.NewTracerProvider(opts...)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(Propagator)
+	return tp, nil
+}
+
+func newExporter(ctx context.Context, cfg Config) (sdktrace.SpanExporter, error) {
+	switch strings.ToLower(strings.TrimSpace(cfg.Exporter)) {
+	case "", ExporterNone:
+		return nil, nil
+	case ExporterStdout:
+		w := cfg.Writer
+		if w == nil {
+			w = os.Stdout
+		}
+		exp, err := stdouttrace.New(stdouttrace.WithWriter(w))
+		if err != nil {
+			return nil, fmt.Errorf("telemetry: create stdout exporter: %w", err)
+		}
+		return exp, nil
+	case ExporterOTLP:
+		// Endpoint, headers and TLS settings come from the standard
+		// OTEL_EXPORTER_OTLP_* environment variables.
+		exp, err := otlptracehttp.New(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("telemetry: create otlp exporter: %w", err)
+		}
+		return exp, nil
+	default:
+		return nil, fmt.Errorf("telemetry: unsupported trace exporter %q", cfg.Exporter)
+	}
+}
+
+// StartSpan starts a span using the tracer for the given instrumentation scope.
+// The tracer is resolved from the global provider on every call so providers
+// installed after package initialization (e.g. in tests) take effect.
+func StartSpan(ctx context.Context, scope, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(scope).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// EndSpan records err on the span, if any, and ends it.
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
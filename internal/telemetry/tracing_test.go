@@ -0,0 +1,66 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func useRecorder(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	prev := otel.GetTracerProvider()
+	rec := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+	return rec
+}
+
+func TestNewTracerProvider_RequiresServiceName(t *testing.T) {
+	_, err := NewTracerProvider(context.Background(), Config{ServiceName: " "})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "service name")
+}
+
+func TestNewTracerProvider_UnsupportedExporter(t *testing.T) {
+	_, err := NewTracerProvider(context.Background(), Config{ServiceName: "svc", Exporter: "zipkin"})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "unsupported trace exporter")
+}
+
+func TestNewTracerProvider_StdoutExporter(t *testing.T) {
+	prev := otel.GetTracerProvider()
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	var buf bytes.Buffer
+	tp, err := NewTracerProvider(context.Background(), Config{ServiceName: "svc", Exporter: ExporterStdout, Writer: &buf})
+	require.NoError(t, err)
+
+	_, span := StartSpan(context.Background(), "test", "unit.span")
+	span.End()
+	require.NoError(t, tp.ForceFlush(context.Background()))
+	require.Contains(t, buf.String(), `"Name":"unit.span"`)
+	require.NoError(t, tp.Shutdown(context.Background()))
+}
+
+func TestEndSpan_RecordsError(t *testing.T) {
+	rec := useRecorder(t)
+
+	_, ok := StartSpan(context.Background(), "test", "ok.span")
+	EndSpan(ok, nil)
+	_, failed := StartSpan(context.Background(), "test", "failed.span")
+	EndSpan(failed, errors.New("boom"))
+
+	spans := rec.Ended()
+	require.Len(t, spans, 2)
+	require.Equal(t, codes.Unset, spans[0].Status().Code)
+	require.Equal(t, codes.Error, spans[1].Status().Code)
+	require.Equal(t, "boom", spans[1].Status().Description)
+	require.Len(t, spans[1].Events(), 1)
+}
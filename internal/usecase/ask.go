@@ -6,37 +6,57 @@ import (
 	"fmt"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
 
 	"portfolio-agent/internal/domain"
+	"portfolio-agent/internal/telemetry"
 )
 
 const (
 	defaultMaxContext    = 20
 	defaultMaxQuestion   = 300
 	maxConversationTurns = 10
+
+	tracerScope = "portfolio-agent/internal/usecase"
 )
 
 type ParamGetter interface {
 	GetParameter(ctx context.Context, name string) (string, error)
+	GetParameterVersion(ctx context.Context, name string) (string, int64, error)
 }
 
 type LLMClient interface {
-	Chat(ctx context.Context, model string, messages []domain.ChatMessage) (string, error)
-	Moderate(ctx context.Context, input string) (bool, error)
+	Chat(ctx context.Context, model string, messages []domain.ChatMessage) (domain.ChatCompletion, error)
+	Moderate(ctx context.Context, input string) (domain.ModerationResult, error)
 }
 
 type StateReadWriter interface {
 	GetConversationTurnCount(ctx context.Context, conversationID string) (int, error)
 	GetHistory(ctx context.Context, conversationID string, limit int) ([]domain.Message, error)
-	SaveCompletedTurn(ctx context.Context, conversationID, question, answer string, turns int) error
+	SaveCompletedTurn(ctx context.Context, conversationID, question, answer string, turns int, usage domain.Usage, profileVersion string) (string, error)
+	GetDailySpend(ctx context.Context, day time.Time) (domain.Usage, error)
+	AddDailySpend(ctx context.Context, day time.Time, usage domain.Usage) error
 }
 
 type httpStatusCoder interface {
 	HTTPStatusCode() int
 }
 
+// circuitOpener is implemented by errors returned without calling the
+// upstream because its circuit breaker is open.
+type circuitOpener interface {
+	CircuitOpen() bool
+}
+
+// contentFilterer is implemented by errors returned when the upstream's own
+// content filter refused the prompt or withheld the completion.
+type contentFilterer interface {
+	ContentFilterCategory() string
+}
+
 type AskService struct {
 	params          ParamGetter
 	llm             LLMClient
@@ -44,13 +64,58 @@ type AskService struct {
 	paramPrefix     string
 	maxContextItems int
 	maxQuestionLen  int
+	dailySpendCap   float64
+	pinnedVersions  map[string]int64
+	secretObserver  func(secret string)
+	deadlineReserve time.Duration
+	budgets         stageBudgets
+
+	cacheMu sync.RWMutex
+	configs map[string]askConfig // by tenant ID
+	// loading serializes the SSM loads of each tenant, so a slow tenant does
+	// not hold cacheMu while other tenants look up their config.
+	loading map[string]*sync.Mutex
+}
+
+// askConfig is the runtime configuration of one tenant, loaded from SSM on
+// the tenant's first request.
+type askConfig struct {
+	resume         string // rendered for the prompt
+	interests      string // rendered for the prompt
+	pinnedPrompt   string
+	openaiModel    string
+	profileVersion string
+	price          modelPrice
+	moderation     moderationPolicy
+	guard          outputGuard
+}
+
+// Option configures optional AskService behaviour.
+type Option func(*AskService)
+
+// WithDailySpendCap makes Ask refuse new questions once the LLM spend recorded
+// for the current UTC day reaches capUSD. A cap <= 0 disables the check.
+func WithDailySpendCap(capUSD float64) Option {
+	return func(s *AskService) {
+		s.dailySpendCap = capUSD
+	}
+}
 
-	cacheMu      sync.RWMutex
-	cacheLoaded  bool
-	resume       string
-	interests    string
-	pinnedPrompt string
-	openaiModel  string
+// WithSecretObserver calls observe with each tenant's pinned system prompt
+// once it is loaded, e.g. to register it with a log redactor.
+func WithSecretObserver(observe func(secret string)) Option {
+	return func(s *AskService) {
+		s.secretObserver = observe
+	}
+}
+
+// WithDeadlineReserve sets how much time before the deadline of the Ask
+// context is kept back for writing the response. Stages that would run into
+// the reserve are cut short and fail with deadline_exceeded.
+func WithDeadlineReserve(d time.Duration) Option {
+	return func(s *AskService) {
+		s.deadlineReserve = d
+	}
 }
 
 type AskInput struct {
@@ -61,9 +126,14 @@ type AskInput struct {
 type AskOutput struct {
 	Answer         string
 	ConversationID string
+	TurnID         string
+	Model          string
+	ProfileVersion string
+	AnswerGuard    string // "", "redacted" or "withheld:<category>"
+	Usage          domain.Usage
 }
 
-func NewAskService(p ParamGetter, llm LLMClient, s StateReadWriter, paramPrefix string, maxContextItems, maxQuestionLen int) (*AskService, error) {
+func NewAskService(p ParamGetter, llm LLMClient, s StateReadWriter, paramPrefix string, maxContextItems, maxQuestionLen int, opts ...Option) (*AskService, error) {
 	if p == nil {
 		return nil, errors.New("usecase: param getter must not be nil")
 	}
@@ -83,17 +153,44 @@ func NewAskService(p ParamGetter, llm LLMClient, s StateReadWriter, paramPrefix
 	if maxQuestionLen <= 0 {
 		maxQuestionLen = defaultMaxQuestion
 	}
-	return &AskService{
+	svc := &AskService{
 		params:          p,
 		llm:             llm,
 		state:           s,
 		paramPrefix:     paramPrefix,
 		maxContextItems: maxContextItems,
 		maxQuestionLen:  maxQuestionLen,
-	}, nil
+		deadlineReserve: defaultDeadlineReserve,
+		budgets:         defaultStageBudgets,
+		configs:         make(map[string]askConfig),
+		loading:         make(map[string]*sync.Mutex),
+	}
+	for _, opt := range opts {
+		opt(svc)
+	}
+	return svc, nil
 }
 
 func (s *AskService) Ask(ctx context.Context, in AskInput) (AskOutput, error) {
+	ctx, span := telemetry.StartSpan(ctx, tracerScope, "usecase.Ask",
+		attribute.String("tenant.id", domain.TenantFromContext(ctx)),
+	)
+	out, err := s.ask(ctx, in)
+	var askErr *Error
+	if errors.As(err, &askErr) {
+		span.SetAttributes(
+			attribute.String("ask.error_code", string(askErr.Code)),
+			attribute.String("ask.reason", askErr.Reason),
+		)
+	}
+	if out.ConversationID != "" {
+		span.SetAttributes(attribute.String("conversation_id", out.ConversationID))
+	}
+	telemetry.EndSpan(span, err)
+	return out, err
+}
+
+func (s *AskService) ask(ctx context.Context, in AskInput) (AskOutput, error) {
 	question := strings.TrimSpace(in.Question)
 	if question == "" {
 		return AskOutput{}, newError(ErrorInvalidInput, "empty_question", nil)
@@ -101,7 +198,19 @@ func (s *AskService) Ask(ctx context.Context, in AskInput) (AskOutput, error) {
 	if len(question) > s.maxQuestionLen {
 		return AskOutput{}, newError(ErrorInvalidInput, "question_too_long", nil)
 	}
-	if err := s.ensureConfig(ctx); err != nil {
+	st, err := s.startStage(ctx, "load_config")
+	if err != nil {
+		return AskOutput{}, err
+	}
+	cfg, err := s.config(st.ctx)
+	st.end(err)
+	if err != nil && st.expired() {
+		return AskOutput{}, deadlineError(err)
+	}
+	if errors.Is(err, errInvalidProfile) {
+		return AskOutput{}, newError(ErrorInternal, "invalid_profile", err)
+	}
+	if err != nil {
 		return AskOutput{}, newError(ErrorInternal, "ssm_load_error", err)
 	}
 	convID := strings.TrimSpace(in.ConversationID)
@@ -109,115 +218,368 @@ func (s *AskService) Ask(ctx context.Context, in AskInput) (AskOutput, error) {
 		convID = newUUID()
 	}
 
-	existingTurns := 0
+	// The turn count, spend cap, moderation and history steps are independent
+	// reads, so they run concurrently. Each writes only its own result.
+	var (
+		existingTurns int
+		moderation    domain.ModerationResult
+		history       []domain.Message
+		preflight     []func(context.Context) error
+	)
 	if strings.TrimSpace(in.ConversationID) != "" {
-		turnCount, err := s.state.GetConversationTurnCount(ctx, convID)
+		preflight = append(preflight, func(ctx context.Context) error {
+			st, err := s.startStage(ctx, "turn_count")
+			if err != nil {
+				return err
+			}
+			turnCount, err := s.state.GetConversationTurnCount(st.ctx, convID)
+			st.end(err)
+			if err != nil {
+				if st.expired() {
+					return deadlineError(err)
+				}
+				return newError(ErrorInternal, "dynamodb_turn_count_error", err)
+			}
+			existingTurns = turnCount
+			if existingTurns >= maxConversationTurns {
+				return newError(ErrorInvalidInput, "conversation_turn_limit", nil)
+			}
+			return nil
+		})
+	}
+
+	day := now().UTC()
+	if s.dailySpendCap > 0 {
+		preflight = append(preflight, func(ctx context.Context) error {
+			st, err := s.startStage(ctx, "spend_cap")
+			if err != nil {
+				return err
+			}
+			spent, err := s.state.GetDailySpend(st.ctx, day)
+			st.end(err)
+			if err != nil {
+				if st.expired() {
+					return deadlineError(err)
+				}
+				return newError(ErrorInternal, "dynamodb_spend_read_error", err)
+			}
+			if spent.CostUSD >= s.dailySpendCap {
+				return newError(ErrorSpendCapExceeded, "daily_spend_cap_exceeded", nil)
+			}
+			return nil
+		})
+	}
+
+	preflight = append(preflight, func(ctx context.Context) error {
+		st, err := s.startStage(ctx, "moderate")
 		if err != nil {
-			return AskOutput{}, newError(ErrorInternal, "dynamodb_turn_count_error", err)
+			return err
 		}
-		existingTurns = turnCount
-		if existingTurns >= maxConversationTurns {
-			return AskOutput{}, newError(ErrorInvalidInput, "conversation_turn_limit", nil)
+		moderation, err = s.llm.Moderate(st.ctx, question)
+		st.end(err)
+		if err != nil {
+			if st.expired() {
+				return deadlineError(err)
+			}
+			if isCircuitOpen(err) {
+				return newError(ErrorUpstream, "upstream_circuit_open", err)
+			}
+			if status, ok := upstreamStatusCode(err); ok && status == 429 {
+				return newError(ErrorRateLimited, "moderation_rate_limited", err)
+			}
+			return newError(ErrorUpstream, "moderation_error", err)
 		}
-	}
+		if category, rejected := cfg.moderation.rejectedCategory(moderation); rejected {
+			return newError(ErrorInvalidQuestion, "moderation_flagged:"+category, nil)
+		}
+		return nil
+	})
 
-	flagged, err := s.llm.Moderate(ctx, question)
-	if err != nil {
-		if status, ok := upstreamStatusCode(err); ok && status == 429 {
-			return AskOutput{}, newError(ErrorRateLimited, "moderation_rate_limited", err)
+	preflight = append(preflight, func(ctx context.Context) error {
+		st, err := s.startStage(ctx, "history")
+		if err != nil {
+			return err
 		}
-		return AskOutput{}, newError(ErrorUpstream, "moderation_error", err)
-	}
-	if flagged {
-		return AskOutput{}, newError(ErrorInvalidQuestion, "moderation_flagged", nil)
-	}
+		history, err = s.state.GetHistory(st.ctx, convID, s.maxContextItems)
+		st.end(err)
+		if err != nil {
+			if st.expired() {
+				return deadlineError(err)
+			}
+			return newError(ErrorInternal, "dynamodb_history_error", err)
+		}
+		return nil
+	})
 
-	history, err := s.state.GetHistory(ctx, convID, s.maxContextItems)
-	if err != nil {
-		return AskOutput{}, newError(ErrorInternal, "dynamodb_history_error", err)
+	if err := runConcurrently(ctx, preflight); err != nil {
+		return AskOutput{}, err
 	}
 
-	raw, err := s.llm.Chat(ctx, s.openaiModel, buildPromptMessages(
+	model := cfg.openaiModel
+	messages := buildPromptMessages(
 		promptContext{
-			pinnedPrompt: s.pinnedPrompt,
-			resume:       s.resume,
-			interests:    s.interests,
+			pinnedPrompt: cfg.pinnedPrompt,
+			resume:       cfg.resume,
+			interests:    cfg.interests,
 		},
 		question,
 		history,
-	))
+	)
+	st, err = s.startStage(ctx, "chat", attribute.String("llm.model", model))
 	if err != nil {
-		if status, ok := upstreamStatusCode(err); ok && status == 429 {
-			return AskOutput{}, newError(ErrorRateLimited, "openai_rate_limited", err)
+		return AskOutput{}, err
+	}
+	completion, err := s.llm.Chat(st.ctx, model, messages)
+	st.end(err)
+	if err != nil {
+		diag := Diagnostics{Model: model, Attempt: 1}
+		if st.expired() {
+			return AskOutput{}, deadlineError(err).withDiagnostics(diag)
+		}
+		if isCircuitOpen(err) {
+			return AskOutput{}, newError(ErrorUpstream, "upstream_circuit_open", err).withDiagnostics(diag)
 		}
-		return AskOutput{}, newError(ErrorUpstream, "openai_error", err)
+		if category, ok := contentFilterCategory(err); ok {
+			return AskOutput{}, newError(ErrorInvalidQuestion, "moderation_flagged:"+category, err)
+		}
+		status, ok := upstreamStatusCode(err)
+		if ok {
+			diag.UpstreamStatus = status
+		}
+		if ok && status == 429 {
+			return AskOutput{}, newError(ErrorRateLimited, "openai_rate_limited", err).withDiagnostics(diag)
+		}
+		return AskOutput{}, newError(ErrorUpstream, "openai_error", err).withDiagnostics(diag)
 	}
 
-	decision, err := parseScopedAnswer(raw)
+	// The call is billed whether or not the answer is usable, so spend is
+	// recorded before the response is interpreted.
+	usage := priceUsage(cfg.price, completion.Usage)
+	st, err = s.startStage(ctx, "record_spend")
 	if err != nil {
-		return AskOutput{}, newError(ErrorUpstream, "openai_malformed_response", err)
+		return AskOutput{}, err
+	}
+	err = s.state.AddDailySpend(st.ctx, day, usage)
+	st.end(err)
+	if err != nil {
+		if st.expired() {
+			return AskOutput{}, deadlineError(err)
+		}
+		return AskOutput{}, newError(ErrorInternal, "dynamodb_spend_write_error", err)
+	}
+
+	decision, err := parseScopedAnswer(completion.Content)
+	if err != nil {
+		return AskOutput{}, newError(ErrorUpstream, "openai_malformed_response", err).withDiagnostics(Diagnostics{
+			Preview: previewOutput(completion.Content, messages),
+			Model:   model,
+			Attempt: 1,
+		})
 	}
 	if !decision.InScope {
 		return AskOutput{}, newError(ErrorInvalidQuestion, "relevance_off_topic", nil)
 	}
 
-	if err := s.state.SaveCompletedTurn(ctx, convID, question, decision.Answer, existingTurns+1); err != nil {
+	st, err = s.startStage(ctx, "guard_answer")
+	if err != nil {
+		return AskOutput{}, err
+	}
+	answer, guard, err := s.guardAnswer(st.ctx, cfg, decision.Answer)
+	st.span.SetAttributes(attribute.String("answer.guard", guard))
+	st.end(err)
+	if err != nil {
+		if st.expired() {
+			return AskOutput{}, deadlineError(err)
+		}
+		if isCircuitOpen(err) {
+			return AskOutput{}, newError(ErrorUpstream, "upstream_circuit_open", err)
+		}
+		if status, ok := upstreamStatusCode(err); ok && status == 429 {
+			return AskOutput{}, newError(ErrorRateLimited, "answer_moderation_rate_limited", err)
+		}
+		return AskOutput{}, newError(ErrorUpstream, "answer_moderation_error", err)
+	}
+
+	st, err = s.startStage(ctx, "save_turn")
+	if err != nil {
+		return AskOutput{}, err
+	}
+	turnID, err := s.state.SaveCompletedTurn(st.ctx, convID, question, answer, existingTurns+1, usage, cfg.profileVersion)
+	st.end(err)
+	if err != nil {
+		if st.expired() {
+			return AskOutput{}, deadlineError(err)
+		}
 		return AskOutput{}, newError(ErrorInternal, "dynamodb_write_error", err)
 	}
 
 	return AskOutput{
-		Answer:         decision.Answer,
+		Answer:         answer,
 		ConversationID: convID,
+		TurnID:         turnID,
+		Model:          model,
+		ProfileVersion: cfg.profileVersion,
+		AnswerGuard:    guard,
+		Usage:          usage,
 	}, nil
 }
 
-func (s *AskService) ensureConfig(ctx context.Context) error {
+// config returns the configuration of the tenant in ctx, loading it from SSM
+// on first use.
+func (s *AskService) config(ctx context.Context) (askConfig, error) {
+	tenantID := domain.TenantFromContext(ctx)
+
 	s.cacheMu.RLock()
-	if s.cacheLoaded {
-		s.cacheMu.RUnlock()
-		return nil
-	}
+	cfg, ok := s.configs[tenantID]
 	s.cacheMu.RUnlock()
+	if ok {
+		return cfg, nil
+	}
 
 	s.cacheMu.Lock()
-	defer s.cacheMu.Unlock()
-	if s.cacheLoaded {
-		return nil
+	mu, ok := s.loading[tenantID]
+	if !ok {
+		mu = &sync.Mutex{}
+		s.loading[tenantID] = mu
+	}
+	s.cacheMu.Unlock()
+
+	// Concurrent first requests of a tenant wait for one load.
+	mu.Lock()
+	defer mu.Unlock()
+	s.cacheMu.RLock()
+	cfg, ok = s.configs[tenantID]
+	s.cacheMu.RUnlock()
+	if ok {
+		return cfg, nil
 	}
 
-	resume, interests, pinnedPrompt, openaiModel, err := s.loadSSMParams(ctx)
+	cfg, err := s.loadSSMParams(ctx, tenantID)
 	if err != nil {
-		return err
+		return askConfig{}, err
 	}
 
-	s.resume = resume
-	s.interests = interests
-	s.pinnedPrompt = pinnedPrompt
-	s.openaiModel = openaiModel
-	s.cacheLoaded = true
-	return nil
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
+	if s.secretObserver != nil {
+		s.secretObserver(cfg.pinnedPrompt)
+	}
+	s.configs[tenantID] = cfg
+	return cfg, nil
 }
 
-func (s *AskService) loadSSMParams(ctx context.Context) (resume, interests, pinnedPrompt, openaiModel string, err error) {
-	prefix := strings.TrimRight(s.paramPrefix, "/")
+// tenantParamPrefix returns the SSM prefix of a tenant's profile parameters.
+// The default tenant reads them directly under the service prefix.
+func (s *AskService) tenantParamPrefix(tenantID string) string {
+	if tenantID == domain.DefaultTenant {
+		return s.paramPrefix
+	}
+	return s.paramPrefix + "/tenants/" + tenantID
+}
+
+// loadSSMParams reads the profile and model of a tenant, validates and renders
+// the resume and interests, and derives their profile version. The pricing
+// table and moderation thresholds are shared by all tenants, always read under
+// the service prefix and not part of the profile version; the output guard is
+// per tenant.
+func (s *AskService) loadSSMParams(ctx context.Context, tenantID string) (askConfig, error) {
+	prefix := s.tenantParamPrefix(tenantID)
+
+	values := make([]string, len(profileParams))
+	versions := make([]int64, len(profileParams))
+	for i, p := range profileParams {
+		var err error
+		values[i], versions[i], err = s.getProfileParam(ctx, prefix+p.path)
+		if err != nil {
+			return askConfig{}, fmt.Errorf("usecase: load %s: %w", p.label, err)
+		}
+	}
+	resume, err := renderResume(values[0])
+	if err != nil {
+		return askConfig{}, err
+	}
+	interests, err := renderInterests(values[1])
+	if err != nil {
+		return askConfig{}, err
+	}
+	cfg := askConfig{
+		resume:         resume,
+		interests:      interests,
+		pinnedPrompt:   values[2],
+		openaiModel:    values[3],
+		profileVersion: profileVersion(versions, values),
+	}
+
+	rawPricing, err := s.params.GetParameter(ctx, s.paramPrefix+"/config/model_pricing")
+	if err != nil {
+		return askConfig{}, fmt.Errorf("usecase: load model pricing: %w", err)
+	}
+	pricing, err := parsePricingTable(rawPricing)
+	if err != nil {
+		return askConfig{}, err
+	}
+	price, ok := pricing[cfg.openaiModel]
+	if !ok {
+		return askConfig{}, fmt.Errorf("usecase: no pricing configured for model %q", cfg.openaiModel)
+	}
+	cfg.price = price
 
-	resume, err = s.params.GetParameter(ctx, prefix+"/resume")
+	rawThresholds, err := s.params.GetParameter(ctx, s.paramPrefix+"/config/moderation_thresholds")
 	if err != nil {
-		return "", "", "", "", fmt.Errorf("usecase: load resume: %w", err)
+		return askConfig{}, fmt.Errorf("usecase: load moderation thresholds: %w", err)
 	}
-	interests, err = s.params.GetParameter(ctx, prefix+"/interests")
+	cfg.moderation, err = parseModerationPolicy(rawThresholds)
 	if err != nil {
-		return "", "", "", "", fmt.Errorf("usecase: load interests: %w", err)
+		return askConfig{}, err
 	}
-	pinnedPrompt, err = s.params.GetParameter(ctx, prefix+"/pinned_prompt")
+
+	rawGuard, err := s.params.GetParameter(ctx, prefix+"/config/output_guard")
 	if err != nil {
-		return "", "", "", "", fmt.Errorf("usecase: load pinned prompt: %w", err)
+		return askConfig{}, fmt.Errorf("usecase: load output guard: %w", err)
 	}
-	openaiModel, err = s.params.GetParameter(ctx, prefix+"/config/openai_model")
+	cfg.guard, err = parseOutputGuard(rawGuard)
 	if err != nil {
-		return "", "", "", "", fmt.Errorf("usecase: load openai model: %w", err)
+		return askConfig{}, err
+	}
+	return cfg, nil
+}
+
+// runConcurrently runs steps concurrently and returns the error of the first
+// failing step in slice order, which is the error running them one after the
+// other would return. A failing step cancels the steps after it; the steps
+// before it run to completion because their errors take precedence.
+func runConcurrently(ctx context.Context, steps []func(context.Context) error) error {
+	ctxs := make([]context.Context, len(steps))
+	cancels := make([]context.CancelFunc, len(steps))
+	for i := range steps {
+		ctxs[i], cancels[i] = context.WithCancel(ctx)
+	}
+	defer func() {
+		for _, cancel := range cancels {
+			cancel()
+		}
+	}()
+
+	errs := make([]error, len(steps))
+	var wg sync.WaitGroup
+	for i, step := range steps {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if errs[i] = step(ctxs[i]); errs[i] != nil {
+				for _, cancel := range cancels[i+1:] {
+					cancel()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
 	}
-	return resume, interests, pinnedPrompt, openaiModel, nil
+	return nil
 }
 
 func upstreamStatusCode(err error) (int, bool) {
@@ -228,6 +590,21 @@ func upstreamStatusCode(err error) (int, bool) {
 	return statusErr.HTTPStatusCode(), true
 }
 
+func contentFilterCategory(err error) (string, bool) {
+	var filtered contentFilterer
+	if !errors.As(err, &filtered) {
+		return "", false
+	}
+	return filtered.ContentFilterCategory(), true
+}
+
+func isCircuitOpen(err error) bool {
+	var open circuitOpener
+	return errors.As(err, &open) && open.CircuitOpen()
+}
+
 var newUUID = func() string {
 	return uuid.NewString()
 }
+
+var now = time.Now
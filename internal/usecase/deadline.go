@@ -0,0 +1,111 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"portfolio-agent/internal/telemetry"
+)
+
+const (
+	// defaultDeadlineReserve is kept back from the invocation deadline for
+	// logging and writing the response.
+	defaultDeadlineReserve = 500 * time.Millisecond
+	// minStageBudget is the least time worth starting a stage with.
+	minStageBudget = 50 * time.Millisecond
+)
+
+// stageLimit bounds how long one stage of the ask pipeline may run.
+type stageLimit struct {
+	max time.Duration
+	// beforeAnswer stages also leave afterChat for the stages that record
+	// the answer once the chat call has returned.
+	beforeAnswer bool
+}
+
+// stageBudgets holds the limits of every stage of the ask pipeline.
+type stageBudgets struct {
+	limits    map[string]stageLimit
+	afterChat time.Duration
+}
+
+// newStageBudgets reserves as afterChat the sum of the limits of the stages
+// that run once the chat call has returned, so an answer that has been paid
+// for is not lost to the deadline.
+func newStageBudgets(limits map[string]stageLimit) stageBudgets {
+	b := stageBudgets{limits: limits}
+	for _, limit := range limits {
+		if !limit.beforeAnswer {
+			b.afterChat += limit.max
+		}
+	}
+	return b
+}
+
+// defaultStageBudgets fit the 20-second Lambda timeout: the chat call gets
+// what the other stages leave of it.
+var defaultStageBudgets = newStageBudgets(map[string]stageLimit{
+	"load_config":  {max: 3 * time.Second, beforeAnswer: true},
+	"turn_count":   {max: 2 * time.Second, beforeAnswer: true},
+	"spend_cap":    {max: 2 * time.Second, beforeAnswer: true},
+	"moderate":     {max: 3 * time.Second, beforeAnswer: true},
+	"history":      {max: 2 * time.Second, beforeAnswer: true},
+	"chat":         {max: 15 * time.Second, beforeAnswer: true},
+	"record_spend": {max: time.Second},
+	"guard_answer": {max: 3 * time.Second},
+	"save_turn":    {max: 2 * time.Second},
+})
+
+// stage is one step of the ask pipeline: its span and a context bounded by
+// the step's time budget.
+type stage struct {
+	ctx    context.Context
+	span   trace.Span
+	cancel context.CancelFunc
+}
+
+// startStage starts a child span for one step of the ask pipeline with a
+// context that expires when the step's budget runs out. The budget is the
+// step's limit, cut short by the deadline of ctx less the reserve. When less
+// than minStageBudget is left the step is not started and a
+// deadline_exceeded error is returned.
+func (s *AskService) startStage(ctx context.Context, name string, attrs ...attribute.KeyValue) (stage, error) {
+	limit := s.budgets.limits[name]
+	budget := limit.max
+	if deadline, ok := ctx.Deadline(); ok {
+		left := time.Until(deadline) - s.deadlineReserve
+		if limit.beforeAnswer {
+			left -= s.budgets.afterChat
+		}
+		budget = min(budget, left)
+	}
+	if budget < minStageBudget {
+		return stage{}, newError(ErrorDeadlineExceeded, "deadline_exceeded",
+			fmt.Errorf("usecase: %s: %s left before the deadline", name, max(budget, 0)))
+	}
+
+	stageCtx, cancel := context.WithTimeout(ctx, budget)
+	stageCtx, span := telemetry.StartSpan(stageCtx, tracerScope, "usecase.Ask/"+name, attrs...)
+	return stage{ctx: stageCtx, span: span, cancel: cancel}, nil
+}
+
+// end ends the stage's span and releases its context.
+func (st stage) end(err error) {
+	telemetry.EndSpan(st.span, err)
+	st.cancel()
+}
+
+// expired reports whether the stage ran out of its budget.
+func (st stage) expired() bool {
+	return errors.Is(st.ctx.Err(), context.DeadlineExceeded)
+}
+
+// deadlineError reports a stage that failed because it ran out of time.
+func deadlineError(err error) *Error {
+	return newError(ErrorDeadlineExceeded, "deadline_exceeded", err)
+}
@@ -0,0 +1,127 @@
+package usecase
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"portfolio-agent/internal/domain"
+)
+
+// slowChatLLM delays chat calls and records the deadline they were given.
+type slowChatLLM struct {
+	*mockLLM
+	chatDelay    time.Duration
+	chatDeadline time.Time
+}
+
+func (l *slowChatLLM) Chat(ctx context.Context, model string, messages []domain.ChatMessage) (domain.ChatCompletion, error) {
+	l.chatDeadline, _ = ctx.Deadline()
+	if err := sleepCtx(ctx, l.chatDelay); err != nil {
+		return domain.ChatCompletion{}, err
+	}
+	return l.mockLLM.Chat(ctx, model, messages)
+}
+
+func newDeadlineService(t *testing.T, llm LLMClient, state StateReadWriter, reserve time.Duration) *AskService {
+	t.Helper()
+	svc, err := NewAskService(defaultParams(), llm, state, "/prefix", 20, 300, WithDeadlineReserve(reserve))
+	require.NoError(t, err)
+	svc.budgets.afterChat = 100 * time.Millisecond
+	return svc
+}
+
+func TestDefaultStageBudgets_ReserveCoversPostChatStages(t *testing.T) {
+	var postChat time.Duration
+	for _, limit := range defaultStageBudgets.limits {
+		if !limit.beforeAnswer {
+			postChat += limit.max
+		}
+	}
+	require.Positive(t, postChat)
+	require.GreaterOrEqual(t, defaultStageBudgets.afterChat, postChat)
+	require.Less(t, defaultStageBudgets.afterChat+defaultDeadlineReserve, 20*time.Second,
+		"the chat call still fits in the Lambda timeout")
+}
+
+func TestAsk_ChatGetsRemainingBudget(t *testing.T) {
+	llm := &slowChatLLM{mockLLM: &mockLLM{responses: []chatResponse{{answer: scopedResponse(true, "ok")}}}}
+	svc := newDeadlineService(t, llm, &mockState{}, 300*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	deadline, _ := ctx.Deadline()
+	_, err := svc.Ask(ctx, AskInput{Question: "What do you do?"})
+	require.NoError(t, err)
+	require.WithinDuration(t, deadline.Add(-400*time.Millisecond), llm.chatDeadline, 50*time.Millisecond)
+
+	// Without a deadline the stage limit applies.
+	start := time.Now()
+	_, err = svc.Ask(context.Background(), AskInput{Question: "What do you do?"})
+	require.NoError(t, err)
+	require.WithinDuration(t, start.Add(defaultStageBudgets.limits["chat"].max), llm.chatDeadline, 50*time.Millisecond)
+}
+
+func TestAsk_SlowChatExceedsDeadline(t *testing.T) {
+	llm := &slowChatLLM{mockLLM: &mockLLM{responses: []chatResponse{{answer: scopedResponse(true, "ok")}}}, chatDelay: time.Minute}
+	state := &mockState{}
+	svc := newDeadlineService(t, llm, state, 100*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := svc.Ask(ctx, AskInput{Question: "What do you do?"})
+	expectAskError(t, err, ErrorDeadlineExceeded, "deadline_exceeded")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Less(t, time.Since(start), 400*time.Millisecond, "the chat call stops before the reserve")
+	require.Empty(t, state.addedSpend)
+	require.False(t, state.saveCompletedInvoked)
+
+	var askErr *Error
+	require.ErrorAs(t, err, &askErr)
+	require.Equal(t, Diagnostics{Model: "gpt-4o-mini", Attempt: 1}, askErr.Diagnostics)
+}
+
+func TestAsk_SlowReadExceedsDeadline(t *testing.T) {
+	state := &slowState{mockState: &mockState{}, historyDelay: time.Minute}
+	llm := &mockLLM{responses: []chatResponse{{answer: scopedResponse(true, "ok")}}}
+	svc := newDeadlineService(t, llm, state, 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	_, err := svc.Ask(ctx, AskInput{Question: "What do you do?", ConversationID: "conv-1"})
+	expectAskError(t, err, ErrorDeadlineExceeded, "deadline_exceeded")
+	require.ErrorIs(t, state.historyCtxErr, context.DeadlineExceeded)
+	require.Zero(t, llm.callCount)
+	require.False(t, state.saveCompletedInvoked)
+}
+
+func TestAsk_AbortsWhenTooLittleTimeIsLeft(t *testing.T) {
+	llm := &mockLLM{responses: []chatResponse{{answer: scopedResponse(true, "ok")}}}
+	state := &mockState{}
+	svc, err := NewAskService(defaultParams(), llm, state, "/prefix", 20, 300)
+	require.NoError(t, err)
+
+	// The default reserve and the time held for recording the answer exceed
+	// what is left, so no stage is started.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err = svc.Ask(ctx, AskInput{Question: "What do you do?"})
+	expectAskError(t, err, ErrorDeadlineExceeded, "deadline_exceeded")
+	require.ErrorContains(t, err, "load_config")
+	require.Zero(t, llm.callCount)
+	require.False(t, state.saveCompletedInvoked)
+}
+
+func TestAsk_CancelledRequestIsNotADeadline(t *testing.T) {
+	state := &slowState{mockState: &mockState{}, historyDelay: time.Minute}
+	svc := newDeadlineService(t, pass(), state, 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	time.AfterFunc(100*time.Millisecond, cancel)
+	_, err := svc.Ask(ctx, AskInput{Question: "What do you do?"})
+	expectAskError(t, err, ErrorInternal, "dynamodb_history_error")
+	require.ErrorIs(t, err, context.Canceled)
+}
@@ -1,21 +1,61 @@
 package usecase
 
-import "fmt"
+import (
+	"fmt"
+	"log/slog"
+)
 
 type ErrorCode string
 
 const (
-	ErrorInvalidInput    ErrorCode = "INVALID_INPUT"
-	ErrorInvalidQuestion ErrorCode = "INVALID_QUESTION"
-	ErrorRateLimited     ErrorCode = "RATE_LIMITED"
-	ErrorUpstream        ErrorCode = "UPSTREAM_ERROR"
-	ErrorInternal        ErrorCode = "INTERNAL_ERROR"
+	ErrorInvalidInput     ErrorCode = "INVALID_INPUT"
+	ErrorInvalidQuestion  ErrorCode = "INVALID_QUESTION"
+	ErrorNotFound         ErrorCode = "NOT_FOUND"
+	ErrorRateLimited      ErrorCode = "RATE_LIMITED"
+	ErrorUpstream         ErrorCode = "UPSTREAM_ERROR"
+	ErrorInternal         ErrorCode = "INTERNAL_ERROR"
+	ErrorSpendCapExceeded ErrorCode = "SPEND_CAP_EXCEEDED"
+	ErrorDeadlineExceeded ErrorCode = "DEADLINE_EXCEEDED"
 )
 
 type Error struct {
 	Code   ErrorCode
 	Reason string
 	Err    error
+	// Diagnostics help operators debug upstream failures. They are logged
+	// and never returned to callers.
+	Diagnostics Diagnostics
+}
+
+// Diagnostics are optional details about the upstream call behind an Error.
+type Diagnostics struct {
+	Preview        string // sanitized, bounded excerpt of model output
+	UpstreamStatus int    // HTTP status returned by the upstream
+	Model          string
+	Attempt        int // 1-based attempt of the upstream call
+}
+
+// IsZero reports whether no diagnostic is set.
+func (d Diagnostics) IsZero() bool {
+	return d == Diagnostics{}
+}
+
+// LogValue renders the diagnostics that are set as a log group.
+func (d Diagnostics) LogValue() slog.Value {
+	var attrs []slog.Attr
+	if d.Preview != "" {
+		attrs = append(attrs, slog.String("preview", d.Preview))
+	}
+	if d.UpstreamStatus != 0 {
+		attrs = append(attrs, slog.Int("upstream_status", d.UpstreamStatus))
+	}
+	if d.Model != "" {
+		attrs = append(attrs, slog.String("model", d.Model))
+	}
+	if d.Attempt != 0 {
+		attrs = append(attrs, slog.Int("attempt", d.Attempt))
+	}
+	return slog.GroupValue(attrs...)
 }
 
 func (e *Error) Error() string {
@@ -38,3 +78,9 @@ func (e *Error) Unwrap() error {
 func newError(code ErrorCode, reason string, err error) *Error {
 	return &Error{Code: code, Reason: reason, Err: err}
 }
+
+// withDiagnostics attaches diagnostics to e and returns it.
+func (e *Error) withDiagnostics(d Diagnostics) *Error {
+	e.Diagnostics = d
+	return e
+}
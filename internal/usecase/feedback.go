@@ -0,0 +1,73 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"unicode/utf8"
+
+	"portfolio-agent/internal/domain"
+)
+
+const maxFeedbackComment = 500
+
+type FeedbackWriter interface {
+	RecordFeedback(ctx context.Context, conversationID, turnID string, rating domain.Rating, comment string) error
+}
+
+type FeedbackService struct {
+	state FeedbackWriter
+}
+
+type FeedbackInput struct {
+	ConversationID string
+	TurnID         string
+	Rating         string
+	Comment        string
+}
+
+type FeedbackOutput struct {
+	ConversationID string
+	TurnID         string
+	Rating         domain.Rating
+}
+
+func NewFeedbackService(s FeedbackWriter) (*FeedbackService, error) {
+	if s == nil {
+		return nil, errors.New("usecase: feedback writer must not be nil")
+	}
+	return &FeedbackService{state: s}, nil
+}
+
+// Submit validates and stores a visitor rating for a completed turn.
+func (s *FeedbackService) Submit(ctx context.Context, in FeedbackInput) (FeedbackOutput, error) {
+	convID := strings.TrimSpace(in.ConversationID)
+	if convID == "" {
+		return FeedbackOutput{}, newError(ErrorInvalidInput, "missing_conversation_id", nil)
+	}
+	turnID := strings.TrimSpace(in.TurnID)
+	if turnID == "" {
+		return FeedbackOutput{}, newError(ErrorInvalidInput, "missing_turn_id", nil)
+	}
+	rating := domain.Rating(strings.ToLower(strings.TrimSpace(in.Rating)))
+	if rating != domain.RatingUp && rating != domain.RatingDown {
+		return FeedbackOutput{}, newError(ErrorInvalidInput, "invalid_rating", nil)
+	}
+	comment := strings.TrimSpace(in.Comment)
+	if utf8.RuneCountInString(comment) > maxFeedbackComment {
+		return FeedbackOutput{}, newError(ErrorInvalidInput, "comment_too_long", nil)
+	}
+
+	if err := s.state.RecordFeedback(ctx, convID, turnID, rating, comment); err != nil {
+		if errors.Is(err, domain.ErrTurnNotFound) {
+			return FeedbackOutput{}, newError(ErrorNotFound, "turn_not_found", err)
+		}
+		return FeedbackOutput{}, newError(ErrorInternal, "dynamodb_feedback_write_error", err)
+	}
+
+	return FeedbackOutput{
+		ConversationID: convID,
+		TurnID:         turnID,
+		Rating:         rating,
+	}, nil
+}
@@ -0,0 +1,94 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"portfolio-agent/internal/domain"
+)
+
+type mockFeedbackWriter struct {
+	err            error
+	invoked        bool
+	conversationID string
+	turnID         string
+	rating         domain.Rating
+	comment        string
+}
+
+func (m *mockFeedbackWriter) RecordFeedback(_ context.Context, conversationID, turnID string, rating domain.Rating, comment string) error {
+	m.invoked = true
+	m.conversationID = conversationID
+	m.turnID = turnID
+	m.rating = rating
+	m.comment = comment
+	return m.err
+}
+
+func newTestFeedbackService(t *testing.T, w FeedbackWriter) *FeedbackService {
+	t.Helper()
+	svc, err := NewFeedbackService(w)
+	require.NoError(t, err)
+	return svc
+}
+
+func TestNewFeedbackService_ValidatesDependencies(t *testing.T) {
+	_, err := NewFeedbackService(nil)
+	require.Error(t, err)
+}
+
+func TestSubmitFeedback_HappyPath(t *testing.T) {
+	w := &mockFeedbackWriter{}
+	svc := newTestFeedbackService(t, w)
+
+	out, err := svc.Submit(context.Background(), FeedbackInput{
+		ConversationID: "conv-1",
+		TurnID:         "2026-02-27T12:00:00Z",
+		Rating:         "Up",
+		Comment:        "  Very helpful  ",
+	})
+	require.NoError(t, err)
+	require.Equal(t, FeedbackOutput{ConversationID: "conv-1", TurnID: "2026-02-27T12:00:00Z", Rating: domain.RatingUp}, out)
+	require.Equal(t, "conv-1", w.conversationID)
+	require.Equal(t, "2026-02-27T12:00:00Z", w.turnID)
+	require.Equal(t, domain.RatingUp, w.rating)
+	require.Equal(t, "Very helpful", w.comment)
+}
+
+func TestSubmitFeedback_ValidationErrors(t *testing.T) {
+	cases := []struct {
+		in     FeedbackInput
+		reason string
+	}{
+		{FeedbackInput{TurnID: "t", Rating: "up"}, "missing_conversation_id"},
+		{FeedbackInput{ConversationID: "c", Rating: "up"}, "missing_turn_id"},
+		{FeedbackInput{ConversationID: "c", TurnID: "t", Rating: "meh"}, "invalid_rating"},
+		{FeedbackInput{ConversationID: "c", TurnID: "t", Rating: "down", Comment: strings.Repeat("é", 501)}, "comment_too_long"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.reason, func(t *testing.T) {
+			w := &mockFeedbackWriter{}
+			svc := newTestFeedbackService(t, w)
+			_, err := svc.Submit(context.Background(), tc.in)
+			expectAskError(t, err, ErrorInvalidInput, tc.reason)
+			require.False(t, w.invoked)
+		})
+	}
+}
+
+func TestSubmitFeedback_TurnNotFound(t *testing.T) {
+	svc := newTestFeedbackService(t, &mockFeedbackWriter{err: fmt.Errorf("repository: %w", domain.ErrTurnNotFound)})
+	_, err := svc.Submit(context.Background(), FeedbackInput{ConversationID: "c", TurnID: "t", Rating: "down"})
+	expectAskError(t, err, ErrorNotFound, "turn_not_found")
+}
+
+func TestSubmitFeedback_WriteError(t *testing.T) {
+	svc := newTestFeedbackService(t, &mockFeedbackWriter{err: errors.New("dynamodb down")})
+	_, err := svc.Submit(context.Background(), FeedbackInput{ConversationID: "c", TurnID: "t", Rating: "down"})
+	expectAskError(t, err, ErrorInternal, "dynamodb_feedback_write_error")
+}
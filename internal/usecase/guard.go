@@ -0,0 +1,122 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	// withheldAnswer replaces answers that fail moderation. It matches the
+	// policy's reply for unavailable information so callers see no difference.
+	withheldAnswer = "I don't have that information."
+	redactedMarker = "[redacted]"
+
+	answerGuardRedacted = "redacted"
+	answerGuardWithheld = "withheld"
+)
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+	// phonePattern finds phone-number candidates; matches with fewer than
+	// minPhoneDigits digits, such as date ranges, are left alone.
+	phonePattern = regexp.MustCompile(`\+?\(?\d[\d\s().-]{6,}\d`)
+)
+
+const minPhoneDigits = 9
+
+// outputGuard holds a tenant's rules for scrubbing private details from
+// answers before they are stored and returned.
+type outputGuard struct {
+	allowEmail bool
+	allowPhone bool
+	redact     []*regexp.Regexp
+}
+
+// outputGuardConfig is the JSON shape of the output guard parameter, e.g.
+// {"allow_email": true, "redact": ["12 Elm Street", "Springfield"]}.
+type outputGuardConfig struct {
+	AllowEmail bool     `json:"allow_email"`
+	AllowPhone bool     `json:"allow_phone"`
+	Redact     []string `json:"redact"`
+}
+
+// parseOutputGuard decodes the output guard parameter. Redact entries are
+// case-insensitive regular expressions for details such as a home address.
+func parseOutputGuard(raw string) (outputGuard, error) {
+	var cfg outputGuardConfig
+	dec := json.NewDecoder(bytes.NewBufferString(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return outputGuard{}, fmt.Errorf("usecase: decode output guard: %w", err)
+	}
+	guard := outputGuard{allowEmail: cfg.AllowEmail, allowPhone: cfg.AllowPhone}
+	for _, expr := range cfg.Redact {
+		if strings.TrimSpace(expr) == "" {
+			continue
+		}
+		re, err := regexp.Compile("(?i)" + expr)
+		if err != nil {
+			return outputGuard{}, fmt.Errorf("usecase: output guard redact pattern %q: %w", expr, err)
+		}
+		guard.redact = append(guard.redact, re)
+	}
+	return guard, nil
+}
+
+// scrub replaces configured patterns, and email addresses and phone numbers
+// unless allowed, with a redaction marker. It returns the scrubbed answer and
+// whether anything was redacted.
+func (g outputGuard) scrub(answer string) (string, bool) {
+	redacted := false
+	replace := func(re *regexp.Regexp, keep func(string) bool) {
+		answer = re.ReplaceAllStringFunc(answer, func(match string) string {
+			if keep != nil && keep(match) {
+				return match
+			}
+			redacted = true
+			return redactedMarker
+		})
+	}
+	for _, re := range g.redact {
+		replace(re, nil)
+	}
+	if !g.allowEmail {
+		replace(emailPattern, nil)
+	}
+	if !g.allowPhone {
+		replace(phonePattern, func(match string) bool { return countDigits(match) < minPhoneDigits })
+	}
+	return answer, redacted
+}
+
+// guardAnswer moderates an answer and scrubs private details from it before
+// it is stored. Answers rejected by the moderation policy are replaced with
+// withheldAnswer. The returned label is empty for untouched answers,
+// "redacted", or "withheld:<category>".
+func (s *AskService) guardAnswer(ctx context.Context, cfg askConfig, answer string) (string, string, error) {
+	moderation, err := s.llm.Moderate(ctx, answer)
+	if err != nil {
+		return "", "", err
+	}
+	if category, rejected := cfg.moderation.rejectedCategory(moderation); rejected {
+		return withheldAnswer, answerGuardWithheld + ":" + category, nil
+	}
+	if scrubbed, redacted := cfg.guard.scrub(answer); redacted {
+		return scrubbed, answerGuardRedacted, nil
+	}
+	return answer, "", nil
+}
+
+func countDigits(s string) int {
+	n := 0
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			n++
+		}
+	}
+	return n
+}
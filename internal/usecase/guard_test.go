@@ -0,0 +1,112 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"portfolio-agent/internal/domain"
+	"portfolio-agent/internal/integrations/openai"
+)
+
+// answerModerationLLM answers every question with answer and flags moderation
+// inputs containing flagSubstring.
+type answerModerationLLM struct {
+	answer        string
+	flagSubstring string
+	moderateErr   error
+	moderated     []string
+}
+
+func (l *answerModerationLLM) Chat(_ context.Context, _ string, _ []domain.ChatMessage) (domain.ChatCompletion, error) {
+	return domain.ChatCompletion{Content: scopedResponse(true, l.answer)}, nil
+}
+
+func (l *answerModerationLLM) Moderate(_ context.Context, input string) (domain.ModerationResult, error) {
+	l.moderated = append(l.moderated, input)
+	if l.moderateErr != nil && len(l.moderated) > 1 {
+		return domain.ModerationResult{}, l.moderateErr
+	}
+	if l.flagSubstring != "" && strings.Contains(input, l.flagSubstring) {
+		return domain.ModerationResult{
+			Flagged:    true,
+			Categories: map[string]bool{"harassment": true},
+			Scores:     map[string]float64{"harassment": 0.91},
+		}, nil
+	}
+	return domain.ModerationResult{}, nil
+}
+
+func TestOutputGuard_Scrub(t *testing.T) {
+	guard, err := parseOutputGuard(`{"redact": ["12 Elm Street(, Springfield)?"]}`)
+	require.NoError(t, err)
+
+	out, redacted := guard.scrub("Reach me at jane@example.com or +1 (555) 123-4567. I live at 12 elm street, Springfield.")
+	require.True(t, redacted)
+	require.Equal(t, "Reach me at [redacted] or [redacted]. I live at [redacted].", out)
+
+	out, redacted = guard.scrub("I worked at Acme from 2019-2021 and shipped 3 releases in 2022.")
+	require.False(t, redacted)
+	require.Equal(t, "I worked at Acme from 2019-2021 and shipped 3 releases in 2022.", out)
+}
+
+func TestOutputGuard_AllowEmail(t *testing.T) {
+	guard, err := parseOutputGuard(`{"allow_email": true}`)
+	require.NoError(t, err)
+
+	out, redacted := guard.scrub("Email jane@example.com, call 0170 1234567.")
+	require.True(t, redacted)
+	require.Equal(t, "Email jane@example.com, call [redacted].", out)
+}
+
+func TestParseOutputGuard_Invalid(t *testing.T) {
+	for _, raw := range []string{`not-json`, `{"redact": ["("]}`, `{"allow_emails": true}`} {
+		_, err := parseOutputGuard(raw)
+		require.Error(t, err, raw)
+	}
+}
+
+func TestAsk_AnswerPIIRedactedBeforeSave(t *testing.T) {
+	params := defaultParams()
+	params.vals["/prefix/config/output_guard"] = `{"redact": ["12 Elm Street"]}`
+	llm := &answerModerationLLM{answer: "Write to jane@example.com; I live at 12 Elm Street."}
+	state := &mockState{}
+	svc := newTestService(t, params, llm, state)
+
+	out, err := svc.Ask(context.Background(), AskInput{Question: "How can I reach you?"})
+	require.NoError(t, err)
+	require.Equal(t, "Write to [redacted]; I live at [redacted].", out.Answer)
+	require.Equal(t, out.Answer, state.savedAnswer)
+	require.Equal(t, "redacted", out.AnswerGuard)
+	require.Equal(t, []string{"How can I reach you?", "Write to jane@example.com; I live at 12 Elm Street."}, llm.moderated)
+}
+
+func TestAsk_FlaggedAnswerIsWithheld(t *testing.T) {
+	llm := &answerModerationLLM{answer: "something hostile", flagSubstring: "hostile"}
+	state := &mockState{}
+	svc := newTestService(t, defaultParams(), llm, state)
+
+	out, err := svc.Ask(context.Background(), AskInput{Question: "What do you do?"})
+	require.NoError(t, err)
+	require.Equal(t, withheldAnswer, out.Answer)
+	require.Equal(t, withheldAnswer, state.savedAnswer)
+	require.Equal(t, "withheld:harassment", out.AnswerGuard)
+}
+
+func TestAsk_AnswerModerationErrors(t *testing.T) {
+	llm := &answerModerationLLM{answer: "ok", moderateErr: errors.New("boom")}
+	state := &mockState{}
+	svc := newTestService(t, defaultParams(), llm, state)
+	_, err := svc.Ask(context.Background(), AskInput{Question: "What do you do?"})
+	expectAskError(t, err, ErrorUpstream, "answer_moderation_error")
+	require.False(t, state.saveCompletedInvoked)
+
+	llm = &answerModerationLLM{answer: "ok", moderateErr: &openai.HTTPStatusError{StatusCode: http.StatusTooManyRequests}}
+	svc = newTestService(t, defaultParams(), llm, &mockState{})
+	_, err = svc.Ask(context.Background(), AskInput{Question: "What do you do?"})
+	expectAskError(t, err, ErrorRateLimited, "answer_moderation_rate_limited")
+}
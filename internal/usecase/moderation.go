@@ -0,0 +1,67 @@
+package usecase
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"portfolio-agent/internal/domain"
+)
+
+// moderationPolicy maps moderation categories to the score at or above which
+// a question is rejected. Categories without a threshold follow the
+// provider's per-category flag; a threshold above 1 never rejects.
+type moderationPolicy map[string]float64
+
+// parseModerationPolicy decodes the moderation thresholds parameter, a JSON
+// object such as {"harassment": 0.4, "sexual": 1.1}.
+func parseModerationPolicy(raw string) (moderationPolicy, error) {
+	var policy moderationPolicy
+	if err := json.Unmarshal([]byte(raw), &policy); err != nil {
+		return nil, fmt.Errorf("usecase: decode moderation thresholds: %w", err)
+	}
+	for category, threshold := range policy {
+		if threshold < 0 {
+			return nil, fmt.Errorf("usecase: moderation threshold for %q must not be negative", category)
+		}
+	}
+	return policy, nil
+}
+
+// rejectedCategory returns the category a question is rejected for, or false
+// if the policy lets it through. When several categories apply, the one with
+// the highest score is returned. A result flagged without any category set,
+// or without category detail at all, is rejected as "unspecified".
+func (p moderationPolicy) rejectedCategory(result domain.ModerationResult) (string, bool) {
+	categories := make([]string, 0, len(result.Categories)+len(result.Scores))
+	seen := make(map[string]bool, cap(categories))
+	for c := range result.Categories {
+		seen[c] = true
+		categories = append(categories, c)
+	}
+	for c := range result.Scores {
+		if !seen[c] {
+			categories = append(categories, c)
+		}
+	}
+	if len(categories) == 0 {
+		return "unspecified", result.Flagged
+	}
+	sort.Strings(categories)
+
+	rejected, found, anyCategory := "", false, false
+	for _, c := range categories {
+		blocked := result.Categories[c]
+		anyCategory = anyCategory || blocked
+		if threshold, ok := p[c]; ok {
+			blocked = result.Scores[c] >= threshold
+		}
+		if blocked && (!found || result.Scores[c] > result.Scores[rejected]) {
+			rejected, found = c, true
+		}
+	}
+	if !found && !anyCategory && result.Flagged {
+		return "unspecified", true
+	}
+	return rejected, found
+}
@@ -0,0 +1,93 @@
+package usecase
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"portfolio-agent/internal/domain"
+	"portfolio-agent/internal/integrations/openai"
+)
+
+// recordedModeration replays a recorded Moderations API payload through the
+// OpenAI client and returns the decoded result.
+func recordedModeration(t *testing.T, name string) domain.ModerationResult {
+	t.Helper()
+	payload, err := os.ReadFile(filepath.Join("testdata", "moderation", name))
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(payload)
+	}))
+	t.Cleanup(srv.Close)
+
+	token := &mockParams{vals: map[string]string{"/prefix/open-ai-token": `{"token":"sk-test"}`}}
+	client, err := openai.NewClient(token, "/prefix", openai.WithBaseURL(srv.URL))
+	require.NoError(t, err)
+	result, err := client.Moderate(context.Background(), "recorded input")
+	require.NoError(t, err)
+	return result
+}
+
+func TestModerationPolicy_RecordedPayloads(t *testing.T) {
+	cases := []struct {
+		name     string
+		payload  string
+		policy   moderationPolicy
+		rejected bool
+		category string
+	}{
+		{name: "clean input passes", payload: "clean.json", policy: moderationPolicy{}},
+		{name: "clean input passes a strict threshold", payload: "clean.json", policy: moderationPolicy{"harassment": 0.01}},
+		{name: "provider flag applies without thresholds", payload: "mild_insult.json", policy: moderationPolicy{}, rejected: true, category: "harassment"},
+		{name: "mild insult allowed by a lenient threshold", payload: "mild_insult.json", policy: moderationPolicy{"harassment": 0.7}},
+		{name: "threshold above 1 never rejects", payload: "mild_insult.json", policy: moderationPolicy{"harassment": 1.1}},
+		{name: "threat reports the highest scoring category", payload: "threat.json", policy: moderationPolicy{}, rejected: true, category: "harassment/threatening"},
+		{name: "threat still rejected when harassment is allowed", payload: "threat.json", policy: moderationPolicy{"harassment": 1.1}, rejected: true, category: "harassment/threatening"},
+		{name: "strict threshold rejects an unflagged category", payload: "threat.json", policy: moderationPolicy{"harassment/threatening": 1.1, "violence": 1.1, "hate": 0.01}, rejected: true, category: "harassment"},
+		{name: "flag without categories is rejected", payload: "legacy_flag_only.json", policy: moderationPolicy{"harassment": 1.1}, rejected: true, category: "unspecified"},
+		{name: "flag with all categories false is rejected", payload: "flagged_without_category.json", policy: moderationPolicy{"harassment": 0.5}, rejected: true, category: "unspecified"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			category, rejected := tc.policy.rejectedCategory(recordedModeration(t, tc.payload))
+			require.Equal(t, tc.rejected, rejected)
+			require.Equal(t, tc.category, category)
+		})
+	}
+}
+
+func TestParseModerationPolicy(t *testing.T) {
+	policy, err := parseModerationPolicy(`{"harassment": 0.7, "sexual": 1.1}`)
+	require.NoError(t, err)
+	require.Equal(t, moderationPolicy{"harassment": 0.7, "sexual": 1.1}, policy)
+
+	_, err = parseModerationPolicy(`{"harassment": -0.1}`)
+	require.Error(t, err)
+	_, err = parseModerationPolicy(`[]`)
+	require.Error(t, err)
+}
+
+func TestAsk_ModerationThresholdsFromSSM(t *testing.T) {
+	params := defaultParams()
+	params.vals["/prefix/config/moderation_thresholds"] = `{"harassment": 0.95}`
+	llm := flag()
+	llm.responses = []chatResponse{{answer: scopedResponse(true, "ok")}}
+	svc := newTestService(t, params, llm, &mockState{})
+
+	out, err := svc.Ask(context.Background(), AskInput{Question: "What do you do?"})
+	require.NoError(t, err)
+	require.Equal(t, "ok", out.Answer)
+
+	params = defaultParams()
+	params.vals["/prefix/config/moderation_thresholds"] = `not-json`
+	svc = newTestService(t, params, pass(), &mockState{})
+	_, err = svc.Ask(context.Background(), AskInput{Question: "What do you do?"})
+	expectAskError(t, err, ErrorInternal, "ssm_load_error")
+}
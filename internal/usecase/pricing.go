@@ -0,0 +1,41 @@
+package usecase
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"portfolio-agent/internal/domain"
+)
+
+// modelPrice is the USD price per one million tokens for a model.
+type modelPrice struct {
+	PromptPerMillionUSD     float64 `json:"prompt_per_1m_usd"`
+	CompletionPerMillionUSD float64 `json:"completion_per_1m_usd"`
+}
+
+// parsePricingTable decodes the per-model pricing table stored in SSM, e.g.
+// {"gpt-4o-mini":{"prompt_per_1m_usd":0.15,"completion_per_1m_usd":0.6}}.
+func parsePricingTable(raw string) (map[string]modelPrice, error) {
+	var table map[string]modelPrice
+	if err := json.Unmarshal([]byte(strings.TrimSpace(raw)), &table); err != nil {
+		return nil, fmt.Errorf("usecase: decode pricing table: %w", err)
+	}
+	if len(table) == 0 {
+		return nil, errors.New("usecase: pricing table is empty")
+	}
+	for model, price := range table {
+		if price.PromptPerMillionUSD < 0 || price.CompletionPerMillionUSD < 0 {
+			return nil, fmt.Errorf("usecase: negative price for model %q", model)
+		}
+	}
+	return table, nil
+}
+
+// priceUsage returns usage with CostUSD computed from the token counts.
+func priceUsage(price modelPrice, usage domain.Usage) domain.Usage {
+	usage.CostUSD = (float64(usage.PromptTokens)*price.PromptPerMillionUSD +
+		float64(usage.CompletionTokens)*price.CompletionPerMillionUSD) / 1_000_000
+	return usage
+}
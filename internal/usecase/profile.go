@@ -0,0 +1,80 @@
+package usecase
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// profileParam is one versioned SSM parameter that shapes answers.
+type profileParam struct {
+	label string // name used in the profile version string
+	path  string // path below the tenant prefix
+}
+
+// profileParams are the parameters whose versions identify a profile, in the
+// order they appear in the profile version string.
+var profileParams = []profileParam{
+	{label: "resume", path: "/resume"},
+	{label: "interests", path: "/interests"},
+	{label: "pinned_prompt", path: "/pinned_prompt"},
+	{label: "openai_model", path: "/config/openai_model"},
+}
+
+// WithPinnedParameterVersions makes the service read the given SSM versions
+// instead of the latest ones, keyed by full parameter name, e.g.
+// {"/portfolio-agent/resume": 3}. It is used to roll a deployment back to
+// earlier profile content.
+func WithPinnedParameterVersions(pins map[string]int64) Option {
+	return func(s *AskService) {
+		s.pinnedVersions = pins
+	}
+}
+
+// ParsePinnedVersions parses a comma-separated list of "name:version" pins,
+// e.g. "/portfolio-agent/resume:3,/portfolio-agent/pinned_prompt:5".
+func ParsePinnedVersions(raw string) (map[string]int64, error) {
+	pins := make(map[string]int64)
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		i := strings.LastIndex(entry, ":")
+		if i <= 0 {
+			return nil, fmt.Errorf("usecase: pinned version %q is not name:version", entry)
+		}
+		version, err := strconv.ParseInt(entry[i+1:], 10, 64)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("usecase: pinned version %q has an invalid version", entry)
+		}
+		pins[entry[:i]] = version
+	}
+	return pins, nil
+}
+
+// getProfileParam reads one parameter, honouring a pinned version.
+func (s *AskService) getProfileParam(ctx context.Context, name string) (string, int64, error) {
+	if version, ok := s.pinnedVersions[name]; ok {
+		name = fmt.Sprintf("%s:%d", name, version)
+	}
+	return s.params.GetParameterVersion(ctx, name)
+}
+
+// profileVersion identifies the profile content that produced an answer, e.g.
+// "resume:3,interests:1,pinned_prompt:5,openai_model:2,sha256:1a2b3c4d5e6f".
+// The content hash tells versions apart even if a parameter is deleted and
+// recreated, which restarts its SSM version numbering.
+func profileVersion(versions []int64, values []string) string {
+	h := sha256.New()
+	parts := make([]string, 0, len(profileParams)+1)
+	for i, p := range profileParams {
+		parts = append(parts, fmt.Sprintf("%s:%d", p.label, versions[i]))
+		fmt.Fprintf(h, "%d:%s", len(values[i]), values[i])
+	}
+	parts = append(parts, "sha256:"+hex.EncodeToString(h.Sum(nil))[:12])
+	return strings.Join(parts, ",")
+}
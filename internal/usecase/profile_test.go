@@ -0,0 +1,69 @@
+package usecase
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"portfolio-agent/internal/domain"
+)
+
+func TestParsePinnedVersions(t *testing.T) {
+	pins, err := ParsePinnedVersions(" /prefix/resume:3, /prefix/pinned_prompt:5 ,")
+	require.NoError(t, err)
+	require.Equal(t, map[string]int64{"/prefix/resume": 3, "/prefix/pinned_prompt": 5}, pins)
+
+	pins, err = ParsePinnedVersions("")
+	require.NoError(t, err)
+	require.Empty(t, pins)
+
+	for _, raw := range []string{"/prefix/resume", "/prefix/resume:", "/prefix/resume:0", "/prefix/resume:x", ":3"} {
+		_, err := ParsePinnedVersions(raw)
+		require.Error(t, err, raw)
+	}
+}
+
+func TestAsk_RecordsProfileVersion(t *testing.T) {
+	params := defaultParams()
+	params.versions = map[string]int64{"/prefix/resume": 4, "/prefix/pinned_prompt": 2}
+	state := &mockState{}
+	llm := &mockLLM{responses: []chatResponse{{answer: scopedResponse(true, "ok")}}}
+	svc := newTestService(t, params, llm, state)
+
+	out, err := svc.Ask(context.Background(), AskInput{Question: "What do you do?"})
+	require.NoError(t, err)
+	require.Regexp(t, `^resume:4,interests:1,pinned_prompt:2,openai_model:1,sha256:[0-9a-f]{12}$`, out.ProfileVersion)
+	require.Equal(t, out.ProfileVersion, state.savedProfileVersion)
+}
+
+func TestAsk_PinnedVersionIsReadWithSelector(t *testing.T) {
+	params := defaultParams()
+	params.vals["/prefix/resume:2"] = "Previous resume."
+	params.versions = map[string]int64{"/prefix/resume:2": 2}
+	var captured []domain.ChatMessage
+	llm := &capturingLLM{answer: scopedResponse(true, "ok"), captured: &captured}
+	svc, err := NewAskService(params, llm, &mockState{}, "/prefix", 20, 300,
+		WithPinnedParameterVersions(map[string]int64{"/prefix/resume": 2}),
+	)
+	require.NoError(t, err)
+
+	out, err := svc.Ask(context.Background(), AskInput{Question: "What do you do?"})
+	require.NoError(t, err)
+	require.Contains(t, out.ProfileVersion, "resume:2,")
+
+	var prompt string
+	for _, msg := range captured {
+		prompt += msg.Content
+	}
+	require.Contains(t, prompt, "Previous resume.")
+	require.NotContains(t, prompt, "Software Engineer with 5 years experience.")
+}
+
+func TestProfileVersion_ChangesWithContent(t *testing.T) {
+	versions := []int64{1, 1, 1, 1}
+	a := profileVersion(versions, []string{"resume", "interests", "prompt", "gpt-4o-mini"})
+	b := profileVersion(versions, []string{"resume v2", "interests", "prompt", "gpt-4o-mini"})
+	require.NotEqual(t, a, b)
+	require.Equal(t, a, profileVersion(versions, []string{"resume", "interests", "prompt", "gpt-4o-mini"}))
+}
@@ -6,7 +6,10 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"regexp"
+	"sort"
 	"strings"
+	"unicode/utf8"
 
 	"portfolio-agent/internal/domain"
 )
@@ -66,8 +69,8 @@ func buildProfileContextPrompt(ctx promptContext) string {
 	return fmt.Sprintf(
 		"%s\n\nPortfolio Context:\n\nResume:\n%s\n\nInterests:\n%s",
 		strings.TrimSpace(ctx.pinnedPrompt),
-		normalizePromptInput(ctx.resume),
-		normalizePromptInput(ctx.interests),
+		strings.TrimSpace(ctx.resume),
+		strings.TrimSpace(ctx.interests),
 	)
 }
 
@@ -100,10 +103,6 @@ func outputContract() string {
 		"If in scope, return in_scope=true and provide the final user-facing answer in answer."
 }
 
-func normalizePromptInput(s string) string {
-	return strings.Join(strings.Fields(strings.TrimSpace(s)), " ")
-}
-
 func parseScopedAnswer(raw string) (scopedAnswerResponse, error) {
 	var out scopedAnswerResponse
 	dec := json.NewDecoder(bytes.NewBufferString(strings.TrimSpace(raw)))
@@ -122,3 +121,61 @@ func parseScopedAnswer(raw string) (scopedAnswerResponse, error) {
 	}
 	return out, nil
 }
+
+const (
+	maxPreviewLen = 160
+	// minPromptFragmentLen is the shortest system prompt fragment removed from
+	// previews; shorter ones, such as section headings, are too generic.
+	minPromptFragmentLen = 16
+	promptFragmentMarker = "[system prompt]"
+)
+
+// previewOutput returns a whitespace-normalized excerpt of malformed model
+// output, at most maxPreviewLen bytes, for rejection logs. Lines and sentences
+// of the system messages, which a model may echo, are removed first.
+func previewOutput(raw string, messages []domain.ChatMessage) string {
+	preview := collapseWhitespace(raw)
+	for _, m := range messages {
+		if m.Role != "system" {
+			continue
+		}
+		for _, fragment := range promptFragments(m.Content) {
+			preview = strings.ReplaceAll(preview, fragment, promptFragmentMarker)
+		}
+	}
+	if len(preview) <= maxPreviewLen {
+		return preview
+	}
+	cut := maxPreviewLen
+	for cut > 0 && !utf8.RuneStart(preview[cut]) {
+		cut--
+	}
+	return preview[:cut] + "..."
+}
+
+// promptFragments splits a system message into whitespace-normalized lines
+// and sentences, longest first so that whole lines are replaced before their
+// sentences.
+func promptFragments(content string) []string {
+	var fragments []string
+	add := func(s string) {
+		if s = collapseWhitespace(s); len(s) >= minPromptFragmentLen {
+			fragments = append(fragments, s)
+		}
+	}
+	add(content)
+	for _, line := range strings.Split(content, "\n") {
+		add(line)
+		for _, sentence := range sentencePattern.FindAllString(line, -1) {
+			add(sentence)
+		}
+	}
+	sort.Slice(fragments, func(i, j int) bool { return len(fragments[i]) > len(fragments[j]) })
+	return fragments
+}
+
+var sentencePattern = regexp.MustCompile(`[^.!?]+[.!?]*`)
+
+func collapseWhitespace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
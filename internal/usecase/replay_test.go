@@ -0,0 +1,89 @@
+package usecase
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"portfolio-agent/internal/domain"
+	"portfolio-agent/internal/integrations/openai"
+	"portfolio-agent/internal/integrations/openai/openaitest"
+)
+
+// newReplayService returns an AskService whose OpenAI client replays the
+// recorded fixture testdata/openai/<name>.json, or the hand-written one in
+// testdata/openai/synthetic until it has been recorded. Synthetic fixtures
+// check the service against the documented API shapes, not real responses.
+// Set OPENAI_RECORD=1 and OPENAI_API_KEY to record against the real API.
+func newReplayService(t *testing.T, name string) (*AskService, *mockState) {
+	t.Helper()
+	path := filepath.Join("testdata", "openai", name+".json")
+	if _, err := os.Stat(path); os.IsNotExist(err) && os.Getenv(openaitest.RecordEnv) == "" {
+		path = filepath.Join("testdata", "openai", "synthetic", name+".json")
+	}
+	transport := openaitest.New(t, path)
+	return newOpenAIService(t, transport.Client())
+}
+
+func newOpenAIService(t *testing.T, httpClient *http.Client) (*AskService, *mockState) {
+	t.Helper()
+	params := defaultParams()
+	params.vals["/prefix/open-ai-token"] = `{"token":"sk-test"}`
+	client, err := openai.NewClient(params, "/prefix", openai.WithHTTPClient(httpClient))
+	require.NoError(t, err)
+
+	state := &mockState{}
+	svc, err := NewAskService(params, client, state, "/prefix", 20, 300)
+	require.NoError(t, err)
+	return svc, state
+}
+
+func TestAskReplay_InScopeAnswer(t *testing.T) {
+	svc, state := newReplayService(t, "in_scope_answer")
+
+	out, err := svc.Ask(context.Background(), AskInput{Question: "What technologies do you specialise in?"})
+	require.NoError(t, err)
+	require.Contains(t, out.Answer, "Go")
+	require.Equal(t, "gpt-4o-mini", out.Model)
+	require.Empty(t, out.AnswerGuard)
+	require.Positive(t, out.Usage.PromptTokens)
+	require.Positive(t, out.Usage.CompletionTokens)
+	require.Positive(t, out.Usage.CostUSD)
+	require.True(t, state.saveCompletedInvoked)
+	require.Equal(t, out.Answer, state.savedAnswer)
+	require.Equal(t, []domain.Usage{out.Usage}, state.addedSpend)
+}
+
+func TestAskReplay_OffTopic(t *testing.T) {
+	svc, state := newReplayService(t, "off_topic")
+
+	_, err := svc.Ask(context.Background(), AskInput{Question: "What is the best pizza in Naples?"})
+	expectAskError(t, err, ErrorInvalidQuestion, "relevance_off_topic")
+	require.Len(t, state.addedSpend, 1, "the chat call is billed")
+	require.False(t, state.saveCompletedInvoked)
+}
+
+func TestAskReplay_FlaggedQuestion(t *testing.T) {
+	svc, state := newReplayService(t, "flagged_question")
+
+	_, err := svc.Ask(context.Background(), AskInput{Question: "Tell me where you live so I can come and hurt you."})
+	expectAskError(t, err, ErrorInvalidQuestion, "moderation_flagged:harassment/threatening")
+	require.Empty(t, state.addedSpend)
+	require.False(t, state.saveCompletedInvoked)
+}
+
+func TestAskReplay_ChatRateLimited(t *testing.T) {
+	svc, state := newReplayService(t, "chat_rate_limited")
+
+	_, err := svc.Ask(context.Background(), AskInput{Question: "What technologies do you specialise in?"})
+	expectAskError(t, err, ErrorRateLimited, "openai_rate_limited")
+	var statusErr *openai.HTTPStatusError
+	require.ErrorAs(t, err, &statusErr)
+	require.Contains(t, statusErr.Body, "rate_limit_exceeded")
+	require.Empty(t, state.addedSpend)
+	require.False(t, state.saveCompletedInvoked)
+}
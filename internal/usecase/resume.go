@@ -0,0 +1,257 @@
+package usecase
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"portfolio-agent/internal/domain"
+)
+
+// errInvalidProfile marks resume or interests content that cannot be used to
+// answer questions.
+var errInvalidProfile = errors.New("usecase: invalid profile content")
+
+// renderResume validates the resume parameter and renders it as the markdown
+// placed in the profile-context prompt. A value starting with "{" must be a
+// JSON Resume document; anything else is taken as markdown or plain text.
+func renderResume(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if !strings.HasPrefix(raw, "{") {
+		text := tidyMarkdown(raw)
+		if text == "" {
+			return "", fmt.Errorf("%w: resume: %w", errInvalidProfile, domain.ErrEmptyResume)
+		}
+		return text, nil
+	}
+
+	var resume domain.Resume
+	if err := json.Unmarshal([]byte(raw), &resume); err != nil {
+		return "", fmt.Errorf("%w: resume: decode JSON Resume: %w", errInvalidProfile, err)
+	}
+	if err := resume.Validate(); err != nil {
+		return "", fmt.Errorf("%w: resume: %w", errInvalidProfile, err)
+	}
+	return formatResume(resume), nil
+}
+
+// renderInterests validates the interests parameter and renders it for the
+// profile-context prompt. A value starting with "[" must be a JSON array of
+// strings or of JSON Resume interest objects; anything else is taken as
+// markdown or plain text. Interests are optional, so an empty value renders
+// as "None listed.".
+func renderInterests(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if !strings.HasPrefix(raw, "[") {
+		if text := tidyMarkdown(raw); text != "" {
+			return text, nil
+		}
+		return "None listed.", nil
+	}
+
+	var items []json.RawMessage
+	if err := json.Unmarshal([]byte(raw), &items); err != nil {
+		return "", fmt.Errorf("%w: interests: decode JSON array: %w", errInvalidProfile, err)
+	}
+	interests := make([]domain.ResumeInterest, 0, len(items))
+	for i, item := range items {
+		var name string
+		if err := json.Unmarshal(item, &name); err == nil {
+			interests = append(interests, domain.ResumeInterest{Name: name})
+			continue
+		}
+		var interest domain.ResumeInterest
+		if err := json.Unmarshal(item, &interest); err != nil {
+			return "", fmt.Errorf("%w: interests: item %d is neither a string nor an interest object", errInvalidProfile, i)
+		}
+		interests = append(interests, interest)
+	}
+
+	var b strings.Builder
+	writeInterests(&b, interests)
+	if text := strings.TrimSpace(b.String()); text != "" {
+		return text, nil
+	}
+	return "None listed.", nil
+}
+
+// formatResume renders a JSON Resume as markdown with one heading per
+// section and one bullet per entry, skipping empty fields.
+func formatResume(r domain.Resume) string {
+	var b strings.Builder
+
+	basics := r.Basics
+	if basics.Name != "" {
+		fmt.Fprintf(&b, "# %s\n", basics.Name)
+	}
+	writeLine(&b, "", basics.Label)
+	loc := basics.Location
+	writeLine(&b, "Location: ", joinNonEmpty(", ", loc.City, loc.Region, loc.CountryCode))
+	writeLine(&b, "Email: ", basics.Email)
+	writeLine(&b, "Website: ", basics.URL)
+	for _, p := range basics.Profiles {
+		writeBullet(&b, joinNonEmpty(": ", p.Network, joinNonEmpty(" ", p.URL, parenthesized(p.Username))))
+	}
+	if summary := tidyMarkdown(basics.Summary); summary != "" {
+		fmt.Fprintf(&b, "\n%s\n", summary)
+	}
+
+	writeWork(&b, "Work", r.Work)
+	if len(r.Education) > 0 {
+		b.WriteString("\n## Education\n")
+		for _, e := range r.Education {
+			degree := joinNonEmpty(" in ", e.StudyType, e.Area)
+			writeEntryHeading(&b, joinNonEmpty(", ", degree, e.Institution), dateRange(e.StartDate, e.EndDate))
+			writeLine(&b, "Score: ", e.Score)
+			for _, c := range e.Courses {
+				writeBullet(&b, c)
+			}
+		}
+	}
+	if len(r.Skills) > 0 {
+		b.WriteString("\n## Skills\n")
+		for _, s := range r.Skills {
+			name := joinNonEmpty(" ", s.Name, parenthesized(s.Level))
+			writeBullet(&b, joinNonEmpty(": ", name, strings.Join(s.Keywords, ", ")))
+		}
+	}
+	if len(r.Projects) > 0 {
+		b.WriteString("\n## Projects\n")
+		for _, p := range r.Projects {
+			writeEntryHeading(&b, p.Name, dateRange(p.StartDate, p.EndDate))
+			writeLine(&b, "", tidyMarkdown(p.Description))
+			writeLine(&b, "URL: ", p.URL)
+			for _, h := range p.Highlights {
+				writeBullet(&b, h)
+			}
+			writeLine(&b, "Keywords: ", strings.Join(p.Keywords, ", "))
+		}
+	}
+	if len(r.Awards) > 0 {
+		b.WriteString("\n## Awards\n")
+		for _, a := range r.Awards {
+			title := joinNonEmpty(", ", a.Title, a.Awarder)
+			writeBullet(&b, joinNonEmpty(": ", joinNonEmpty(" ", title, parenthesized(a.Date)), a.Summary))
+		}
+	}
+	if len(r.Certificates) > 0 {
+		b.WriteString("\n## Certificates\n")
+		for _, c := range r.Certificates {
+			writeBullet(&b, joinNonEmpty(" ", joinNonEmpty(", ", c.Name, c.Issuer), parenthesized(c.Date), c.URL))
+		}
+	}
+	if len(r.Publications) > 0 {
+		b.WriteString("\n## Publications\n")
+		for _, p := range r.Publications {
+			title := joinNonEmpty(" ", joinNonEmpty(", ", p.Name, p.Publisher), parenthesized(p.ReleaseDate), p.URL)
+			writeBullet(&b, joinNonEmpty(": ", title, p.Summary))
+		}
+	}
+	writeWork(&b, "Volunteer", r.Volunteer)
+	if len(r.Languages) > 0 {
+		b.WriteString("\n## Languages\n")
+		for _, l := range r.Languages {
+			writeBullet(&b, joinNonEmpty(": ", l.Language, l.Fluency))
+		}
+	}
+	if len(r.Interests) > 0 {
+		b.WriteString("\n## Interests\n")
+		writeInterests(&b, r.Interests)
+	}
+	return strings.TrimSpace(b.String())
+}
+
+func writeWork(b *strings.Builder, section string, positions []domain.ResumeWork) {
+	if len(positions) == 0 {
+		return
+	}
+	fmt.Fprintf(b, "\n## %s\n", section)
+	for _, w := range positions {
+		employer := w.Name
+		if employer == "" {
+			employer = w.Organization
+		}
+		writeEntryHeading(b, joinNonEmpty(", ", w.Position, employer), dateRange(w.StartDate, w.EndDate))
+		writeLine(b, "", tidyMarkdown(w.Summary))
+		for _, h := range w.Highlights {
+			writeBullet(b, h)
+		}
+	}
+}
+
+func writeInterests(b *strings.Builder, interests []domain.ResumeInterest) {
+	for _, in := range interests {
+		writeBullet(b, joinNonEmpty(": ", in.Name, strings.Join(in.Keywords, ", ")))
+	}
+}
+
+func writeEntryHeading(b *strings.Builder, title, dates string) {
+	if heading := joinNonEmpty(" ", title, parenthesized(dates)); heading != "" {
+		fmt.Fprintf(b, "### %s\n", heading)
+	}
+}
+
+func writeLine(b *strings.Builder, label, value string) {
+	if value = strings.TrimSpace(value); value != "" {
+		fmt.Fprintf(b, "%s%s\n", label, value)
+	}
+}
+
+func writeBullet(b *strings.Builder, value string) {
+	if value = strings.Join(strings.Fields(value), " "); value != "" {
+		fmt.Fprintf(b, "- %s\n", value)
+	}
+}
+
+// dateRange renders "2020-01 – 2022-06", "2020-01 – present", or "".
+func dateRange(start, end string) string {
+	switch {
+	case start == "":
+		return end
+	case end == "":
+		return start + " – present"
+	default:
+		return start + " – " + end
+	}
+}
+
+func parenthesized(s string) string {
+	if s = strings.TrimSpace(s); s == "" {
+		return ""
+	}
+	return "(" + s + ")"
+}
+
+func joinNonEmpty(sep string, parts ...string) string {
+	kept := parts[:0:0]
+	for _, p := range parts {
+		if p = strings.TrimSpace(p); p != "" {
+			kept = append(kept, p)
+		}
+	}
+	return strings.Join(kept, sep)
+}
+
+// tidyMarkdown normalizes line endings, trims trailing whitespace and
+// collapses runs of blank lines, keeping headings, lists and paragraphs
+// intact.
+func tidyMarkdown(s string) string {
+	lines := strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+	kept := make([]string, 0, len(lines))
+	blank := false
+	for _, line := range lines {
+		line = strings.TrimRightFunc(line, unicode.IsSpace)
+		if line == "" {
+			blank = true
+			continue
+		}
+		if blank && len(kept) > 0 {
+			kept = append(kept, "")
+		}
+		blank = false
+		kept = append(kept, line)
+	}
+	return strings.Join(kept, "\n")
+}
@@ -0,0 +1,109 @@
+package usecase
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"portfolio-agent/internal/domain"
+)
+
+const sampleJSONResume = `{
+  "$schema": "https://raw.githubusercontent.com/jsonresume/resume-schema/v1.0.0/schema.json",
+  "basics": {
+    "name": "Jane Doe",
+    "label": "Backend Engineer",
+    "location": {"city": "Berlin", "countryCode": "DE"},
+    "profiles": [{"network": "GitHub", "username": "jdoe", "url": "https://github.com/jdoe"}],
+    "summary": "Builds reliable services.\n\nEnjoys mentoring."
+  },
+  "work": [{
+    "name": "Acme",
+    "position": "Senior Engineer",
+    "startDate": "2021-03",
+    "summary": "Payments platform.",
+    "highlights": ["Cut p99 latency by 40%", "Led the Go migration"]
+  }],
+  "education": [{"institution": "TU Berlin", "area": "Computer Science", "studyType": "MSc", "endDate": "2018"}],
+  "skills": [{"name": "Backend", "level": "Expert", "keywords": ["Go", "PostgreSQL"]}],
+  "meta": {"version": "v1.0.0"}
+}`
+
+func TestRenderResume_JSONResumeKeepsStructure(t *testing.T) {
+	out, err := renderResume(sampleJSONResume)
+	require.NoError(t, err)
+	require.Contains(t, out, "# Jane Doe\nBackend Engineer\nLocation: Berlin, DE\n")
+	require.Contains(t, out, "- GitHub: https://github.com/jdoe (jdoe)")
+	require.Contains(t, out, "Builds reliable services.\n\nEnjoys mentoring.")
+	require.Contains(t, out, "## Work\n### Senior Engineer, Acme (2021-03 – present)\nPayments platform.\n- Cut p99 latency by 40%\n- Led the Go migration")
+	require.Contains(t, out, "## Education\n### MSc in Computer Science, TU Berlin (2018)")
+	require.Contains(t, out, "## Skills\n- Backend (Expert): Go, PostgreSQL")
+	require.NotContains(t, out, "## Projects")
+}
+
+func TestRenderResume_MarkdownPreservesLayout(t *testing.T) {
+	out, err := renderResume("  # Jane Doe  \r\n\r\n\r\n## Work\r\n- Acme   \r\n- Initech\n")
+	require.NoError(t, err)
+	require.Equal(t, "# Jane Doe\n\n## Work\n- Acme\n- Initech", out)
+}
+
+func TestRenderResume_RejectsEmptyOrInvalidContent(t *testing.T) {
+	for _, raw := range []string{"", "   \n", "{}", `{"basics":{"email":"a@b.c"}}`} {
+		_, err := renderResume(raw)
+		require.ErrorIs(t, err, errInvalidProfile, raw)
+		require.ErrorIs(t, err, domain.ErrEmptyResume, raw)
+	}
+
+	_, err := renderResume(`{"basics": {"name": "Jane"`)
+	require.ErrorIs(t, err, errInvalidProfile)
+	_, err = renderResume(`{"work": "Acme"}`)
+	require.ErrorIs(t, err, errInvalidProfile)
+}
+
+func TestRenderInterests(t *testing.T) {
+	out, err := renderInterests(`["Go", {"name": "Climbing", "keywords": ["bouldering", "alpine"]}]`)
+	require.NoError(t, err)
+	require.Equal(t, "- Go\n- Climbing: bouldering, alpine", out)
+
+	out, err = renderInterests("Go, distributed systems")
+	require.NoError(t, err)
+	require.Equal(t, "Go, distributed systems", out)
+
+	for _, raw := range []string{"", "[]"} {
+		out, err = renderInterests(raw)
+		require.NoError(t, err)
+		require.Equal(t, "None listed.", out)
+	}
+
+	_, err = renderInterests(`["Go", 42]`)
+	require.ErrorIs(t, err, errInvalidProfile)
+	_, err = renderInterests(`["Go"`)
+	require.ErrorIs(t, err, errInvalidProfile)
+}
+
+func TestAsk_InvalidResumeFailsLoudly(t *testing.T) {
+	params := defaultParams()
+	params.vals["/prefix/resume"] = "{}"
+	llm := &mockLLM{}
+	svc := newTestService(t, params, llm, &mockState{})
+
+	_, err := svc.Ask(context.Background(), AskInput{Question: "What do you do?"})
+	expectAskError(t, err, ErrorInternal, "invalid_profile")
+	require.ErrorIs(t, err, domain.ErrEmptyResume)
+}
+
+func TestAsk_JSONResumeIsRenderedIntoPrompt(t *testing.T) {
+	params := defaultParams()
+	params.vals["/prefix/resume"] = sampleJSONResume
+	params.vals["/prefix/interests"] = `["Go"]`
+	var captured []domain.ChatMessage
+	llm := &capturingLLM{answer: scopedResponse(true, "ok"), captured: &captured}
+	svc := newTestService(t, params, llm, &mockState{})
+
+	_, err := svc.Ask(context.Background(), AskInput{Question: "Where do you work?"})
+	require.NoError(t, err)
+	require.Contains(t, captured[1].Content, "Resume:\n# Jane Doe\n")
+	require.Contains(t, captured[1].Content, "### Senior Engineer, Acme (2021-03 – present)")
+	require.Contains(t, captured[1].Content, "Interests:\n- Go")
+}
@@ -0,0 +1,211 @@
+package usecase
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"portfolio-agent/internal/domain"
+)
+
+// tenantState is an in-memory store keyed like the repository: by the tenant
+// carried in ctx and the conversation ID.
+type tenantState struct {
+	mu      sync.Mutex
+	history map[string][]domain.Message
+	turns   map[string]int
+}
+
+func newTenantState() *tenantState {
+	return &tenantState{history: map[string][]domain.Message{}, turns: map[string]int{}}
+}
+
+func tenantKey(ctx context.Context, conversationID string) string {
+	return domain.TenantFromContext(ctx) + "/" + conversationID
+}
+
+func (s *tenantState) GetConversationTurnCount(ctx context.Context, conversationID string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.turns[tenantKey(ctx, conversationID)], nil
+}
+
+func (s *tenantState) GetHistory(ctx context.Context, conversationID string, _ int) ([]domain.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.history[tenantKey(ctx, conversationID)], nil
+}
+
+func (s *tenantState) SaveCompletedTurn(ctx context.Context, conversationID, question, answer string, turns int, _ domain.Usage, _ string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := tenantKey(ctx, conversationID)
+	s.history[key] = append(s.history[key], domain.Message{Text: question, Answer: answer})
+	s.turns[key] = turns
+	return "turn", nil
+}
+
+func (s *tenantState) GetDailySpend(context.Context, time.Time) (domain.Usage, error) {
+	return domain.Usage{}, nil
+}
+
+func (s *tenantState) AddDailySpend(context.Context, time.Time, domain.Usage) error {
+	return nil
+}
+
+type countingParams struct {
+	*mockParams
+	calls map[string]int
+}
+
+func (p *countingParams) GetParameter(ctx context.Context, name string) (string, error) {
+	p.calls[name]++
+	return p.mockParams.GetParameter(ctx, name)
+}
+
+func (p *countingParams) GetParameterVersion(ctx context.Context, name string) (string, int64, error) {
+	p.calls[name]++
+	return p.mockParams.GetParameterVersion(ctx, name)
+}
+
+func tenantParams() *countingParams {
+	p := defaultParams()
+	for _, tenant := range []string{"alice", "bob"} {
+		prefix := "/prefix/tenants/" + tenant
+		p.vals[prefix+"/resume"] = tenant + "'s resume"
+		p.vals[prefix+"/interests"] = tenant + "'s interests"
+		p.vals[prefix+"/pinned_prompt"] = "You speak for " + tenant + "."
+		p.vals[prefix+"/config/openai_model"] = "gpt-4o-mini"
+		p.vals[prefix+"/config/output_guard"] = "{}"
+	}
+	return &countingParams{mockParams: p, calls: map[string]int{}}
+}
+
+func TestAsk_TenantsHaveIsolatedHistoryAndTurnCounts(t *testing.T) {
+	var captured []domain.ChatMessage
+	llm := &capturingLLM{answer: scopedResponse(true, "ok"), captured: &captured}
+	state := newTenantState()
+	svc := newTestService(t, tenantParams(), llm, state)
+	alice := domain.WithTenant(context.Background(), "alice")
+	bob := domain.WithTenant(context.Background(), "bob")
+
+	for range 3 {
+		_, err := svc.Ask(alice, AskInput{Question: "alice question", ConversationID: "shared-id"})
+		require.NoError(t, err)
+	}
+	_, err := svc.Ask(bob, AskInput{Question: "bob question", ConversationID: "shared-id"})
+	require.NoError(t, err)
+
+	require.Equal(t, 3, state.turns["alice/shared-id"])
+	require.Equal(t, 1, state.turns["bob/shared-id"])
+	for _, msg := range captured {
+		require.NotContains(t, msg.Content, "alice", "bob's prompt must not include alice's profile or history")
+	}
+}
+
+func TestAsk_TenantConfigLoadedLazilyAndCachedPerTenant(t *testing.T) {
+	var captured []domain.ChatMessage
+	llm := &capturingLLM{answer: scopedResponse(true, "ok"), captured: &captured}
+	params := tenantParams()
+	svc := newTestService(t, params, llm, newTenantState())
+	require.Empty(t, params.calls)
+
+	alice := domain.WithTenant(context.Background(), "alice")
+	for range 2 {
+		_, err := svc.Ask(alice, AskInput{Question: "hi"})
+		require.NoError(t, err)
+	}
+	require.Equal(t, 1, params.calls["/prefix/tenants/alice/resume"])
+	require.Zero(t, params.calls["/prefix/tenants/bob/resume"])
+	require.Zero(t, params.calls["/prefix/resume"])
+	require.Equal(t, 1, params.calls["/prefix/config/model_pricing"])
+
+	_, err := svc.Ask(domain.WithTenant(context.Background(), "bob"), AskInput{Question: "hi"})
+	require.NoError(t, err)
+	require.Equal(t, 1, params.calls["/prefix/tenants/bob/resume"])
+	require.Equal(t, 2, params.calls["/prefix/config/model_pricing"])
+
+	var system strings.Builder
+	for _, msg := range captured {
+		if msg.Role == "system" {
+			system.WriteString(msg.Content)
+		}
+	}
+	require.Contains(t, system.String(), "bob's resume")
+	require.Contains(t, system.String(), "You speak for bob.")
+}
+
+func TestAsk_UnknownTenantConfigIsInternalError(t *testing.T) {
+	svc := newTestService(t, tenantParams(), pass(), newTenantState())
+	_, err := svc.Ask(domain.WithTenant(context.Background(), "carol"), AskInput{Question: "hi"})
+	expectAskError(t, err, ErrorInternal, "ssm_load_error")
+}
+
+func TestAsk_SecretObserverReceivesEachTenantsPinnedPrompt(t *testing.T) {
+	var secrets []string
+	llm := &capturingLLM{answer: scopedResponse(true, "ok"), captured: new([]domain.ChatMessage)}
+	svc, err := NewAskService(tenantParams(), llm, newTenantState(), "/prefix", 20, 300,
+		WithSecretObserver(func(secret string) { secrets = append(secrets, secret) }),
+	)
+	require.NoError(t, err)
+
+	for _, tenant := range []string{"alice", "alice", "bob"} {
+		_, err := svc.Ask(domain.WithTenant(context.Background(), tenant), AskInput{Question: "hi"})
+		require.NoError(t, err)
+	}
+	require.Equal(t, []string{"You speak for alice.", "You speak for bob."}, secrets)
+}
+
+// blockingParams holds the reads of one tenant's parameters until release
+// is closed.
+type blockingParams struct {
+	*mockParams
+	prefix  string
+	started chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+func (p *blockingParams) GetParameterVersion(ctx context.Context, name string) (string, int64, error) {
+	if strings.HasPrefix(name, p.prefix) {
+		p.once.Do(func() { close(p.started) })
+		<-p.release
+	}
+	return p.mockParams.GetParameterVersion(ctx, name)
+}
+
+func TestAsk_SlowTenantConfigLoadDoesNotBlockOtherTenants(t *testing.T) {
+	params := &blockingParams{
+		mockParams: tenantParams().mockParams,
+		prefix:     "/prefix/tenants/alice/",
+		started:    make(chan struct{}),
+		release:    make(chan struct{}),
+	}
+	svc := newTestService(t, params, &capturingLLM{answer: scopedResponse(true, "ok"), captured: new([]domain.ChatMessage)}, newTenantState())
+
+	aliceDone := make(chan error, 1)
+	go func() {
+		_, err := svc.Ask(domain.WithTenant(context.Background(), "alice"), AskInput{Question: "hi"})
+		aliceDone <- err
+	}()
+	<-params.started
+
+	bobDone := make(chan error, 1)
+	go func() {
+		_, err := svc.config(domain.WithTenant(context.Background(), "bob"))
+		bobDone <- err
+	}()
+	select {
+	case err := <-bobDone:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("bob's config load waited for alice's")
+	}
+
+	close(params.release)
+	require.NoError(t, <-aliceDone)
+}
@@ -14,6 +14,24 @@ resource "aws_dynamodb_table" "agent_questions" {
     type = "S"
   }
 
+  attribute {
+    name = "activityDay"
+    type = "S"
+  }
+
+  attribute {
+    name = "lastActivity"
+    type = "S"
+  }
+
+  # META# items by UTC day of last activity, newest first within a day.
+  global_secondary_index {
+    name            = "activity-index"
+    hash_key        = "activityDay"
+    range_key       = "lastActivity"
+    projection_type = "ALL"
+  }
+
   ttl {
     attribute_name = "ttl"
     enabled        = true
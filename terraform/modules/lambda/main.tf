@@ -31,12 +31,27 @@ resource "aws_lambda_function" "lambda_function" {
 
   environment {
     variables = {
-      ENV                  = var.environment
-      STATE_TABLE          = var.state_table_name
-      PARAM_PREFIX         = var.param_prefix
-      MAX_QUESTION_LENGTH  = tostring(var.max_question_length)
-      MAX_CONTEXT_ITEMS    = tostring(var.max_context_items)
-      TOKEN_BUDGET         = tostring(var.token_budget)
+      ENV                        = var.environment
+      STATE_TABLE                = var.state_table_name
+      PARAM_PREFIX               = var.param_prefix
+      MAX_QUESTION_LENGTH        = tostring(var.max_question_length)
+      MAX_CONTEXT_ITEMS          = tostring(var.max_context_items)
+      TOKEN_BUDGET               = tostring(var.token_budget)
+      OTEL_TRACES_EXPORTER       = var.traces_exporter
+      DAILY_SPEND_CAP_USD        = tostring(var.daily_spend_cap_usd)
+      DEADLINE_RESERVE_MS        = tostring(var.deadline_reserve_ms)
+      TENANT_SOURCE              = var.tenant_source
+      API_EVENT_TYPE             = var.api_event_type
+      CORS_ALLOWED_ORIGINS       = join(",", var.cors_allowed_origins)
+      TENANT_MAP                 = jsonencode(var.tenant_map)
+      PINNED_PARAM_VERSIONS      = join(",", [for name, version in var.pinned_param_versions : "${name}:${version}"])
+      OPENAI_BASE_URL            = var.openai_base_url
+      OPENAI_AZURE_API_VERSION   = var.openai_azure_api_version
+      OPENAI_AZURE_DEPLOYMENTS   = jsonencode(var.openai_azure_deployments)
+      OPENAI_AUTH                = var.openai_auth
+      OPENAI_STRUCTURED_OUTPUT   = var.openai_structured_output
+      OPENAI_MODERATION          = var.openai_moderation
+      OPENAI_MODERATION_PATTERNS = jsonencode(var.openai_moderation_patterns)
     }
   }
 }
@@ -54,6 +69,7 @@ resource "aws_iam_policy" "iam_policy_dynamodb" {
           "dynamodb:GetItem",
           "dynamodb:PutItem",
           "dynamodb:TransactWriteItems",
+          "dynamodb:ConditionCheckItem",
           "dynamodb:UpdateItem",
           "dynamodb:Query"
         ]
@@ -105,6 +121,32 @@ resource "aws_cloudwatch_log_group" "cloudwatch_log_group_lambda_function" {
   retention_in_days = 7
 }
 
+resource "aws_cloudwatch_log_metric_filter" "cloudwatch_log_metric_filter_breaker_opened" {
+  name           = "${var.app}-${var.environment}-openai-breaker-opened"
+  log_group_name = aws_cloudwatch_log_group.cloudwatch_log_group_lambda_function.name
+  pattern        = "{ $.event = \"openai.breaker.opened\" }"
+
+  metric_transformation {
+    name          = "OpenAIBreakerOpened"
+    namespace     = "${var.app}/${var.environment}"
+    value         = "1"
+    default_value = "0"
+  }
+}
+
+resource "aws_cloudwatch_log_metric_filter" "cloudwatch_log_metric_filter_breaker_rejected" {
+  name           = "${var.app}-${var.environment}-openai-breaker-rejected"
+  log_group_name = aws_cloudwatch_log_group.cloudwatch_log_group_lambda_function.name
+  pattern        = "{ $.event = \"openai.breaker.rejected\" }"
+
+  metric_transformation {
+    name          = "OpenAIBreakerRejected"
+    namespace     = "${var.app}/${var.environment}"
+    value         = "1"
+    default_value = "0"
+  }
+}
+
 resource "aws_iam_role_policy_attachment" "iam_role_policy_attachment_event_cloud_watch" {
   role       = aws_iam_role.iam_role_lambda.name
   policy_arn = aws_iam_policy.iam_policy_cloud_watch.arn
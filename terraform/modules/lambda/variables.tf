@@ -48,3 +48,108 @@ variable "token_budget" {
   default     = 6000
   description = "Maximum prompt token budget before calling OpenAI"
 }
+
+variable "traces_exporter" {
+  type        = string
+  default     = "none"
+  description = "OpenTelemetry trace exporter (none, stdout or otlp)"
+}
+
+variable "daily_spend_cap_usd" {
+  type        = number
+  default     = 0
+  description = "Daily OpenAI spend cap in USD; 0 disables the cap"
+}
+
+variable "deadline_reserve_ms" {
+  type        = number
+  default     = 500
+  description = "Milliseconds before the Lambda deadline kept back for writing the response"
+}
+
+variable "tenant_source" {
+  type        = string
+  default     = "none"
+  description = "Where the tenant is read from: none, host, path or api_key"
+}
+
+variable "api_event_type" {
+  type        = string
+  default     = "rest"
+  description = "Event payload of the function's trigger: rest (REST API), http (HTTP API) or function_url"
+}
+
+variable "cors_allowed_origins" {
+  type        = list(string)
+  default     = ["*"]
+  description = "Browser origins allowed to call the API: exact origins, https://*.example.com wildcards, or * for any"
+}
+
+variable "tenant_map" {
+  type        = map(string)
+  default     = {}
+  description = "Maps host names, path segments or API key IDs to tenant IDs"
+}
+
+variable "pinned_param_versions" {
+  type        = map(number)
+  default     = {}
+  description = "SSM profile parameter versions to pin for rollback, keyed by full parameter name"
+}
+
+variable "openai_base_url" {
+  type        = string
+  default     = "https://api.openai.com/v1"
+  description = "OpenAI API base URL, or the Azure OpenAI resource endpoint when openai_azure_api_version is set"
+}
+
+variable "openai_azure_api_version" {
+  type        = string
+  default     = ""
+  description = "Azure OpenAI api-version; non-empty switches the client to Azure deployments"
+}
+
+variable "openai_azure_deployments" {
+  type        = map(string)
+  default     = {}
+  description = "Maps configured OpenAI models to Azure deployment names; unmapped models use a deployment of the same name"
+}
+
+variable "openai_auth" {
+  type        = string
+  default     = "ssm"
+  description = "OpenAI authentication: ssm reads the API key from SSM, none sends no Authorization header"
+
+  validation {
+    condition     = contains(["ssm", "none"], var.openai_auth)
+    error_message = "openai_auth must be ssm or none."
+  }
+}
+
+variable "openai_structured_output" {
+  type        = string
+  default     = "json_schema"
+  description = "Structured output mode: json_schema, json_object, guided_json or auto"
+
+  validation {
+    condition     = contains(["json_schema", "json_object", "guided_json", "auto"], var.openai_structured_output)
+    error_message = "openai_structured_output must be json_schema, json_object, guided_json or auto."
+  }
+}
+
+variable "openai_moderation" {
+  type        = string
+  default     = "api"
+  description = "Moderation mode: api, local or none; Azure requires local or none"
+
+  validation {
+    condition     = contains(["api", "local", "none"], var.openai_moderation)
+    error_message = "openai_moderation must be api, local or none."
+  }
+}
+
+variable "openai_moderation_patterns" {
+  type        = map(list(string))
+  default     = {}
+  description = "Moderation category to regular expressions, used when openai_moderation is local"
+}
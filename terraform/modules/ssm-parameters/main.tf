@@ -42,6 +42,42 @@ resource "aws_ssm_parameter" "openai_model" {
   }
 }
 
+resource "aws_ssm_parameter" "model_pricing" {
+  name = "/${var.app}/config/model_pricing"
+  type = "String"
+  value = jsonencode({
+    "gpt-4o-mini" = { prompt_per_1m_usd = 0.15, completion_per_1m_usd = 0.6 }
+    "gpt-4o"      = { prompt_per_1m_usd = 2.5, completion_per_1m_usd = 10 }
+  })
+  overwrite = false
+
+  lifecycle {
+    ignore_changes = [value]
+  }
+}
+
+resource "aws_ssm_parameter" "moderation_thresholds" {
+  name      = "/${var.app}/config/moderation_thresholds"
+  type      = "String"
+  value     = "{}"
+  overwrite = false
+
+  lifecycle {
+    ignore_changes = [value]
+  }
+}
+
+resource "aws_ssm_parameter" "output_guard" {
+  name      = "/${var.app}/config/output_guard"
+  type      = "String"
+  value     = "{}"
+  overwrite = false
+
+  lifecycle {
+    ignore_changes = [value]
+  }
+}
+
 resource "aws_ssm_parameter" "open_ai_token" {
   name      = "/${var.app}/open-ai-token"
   type      = "SecureString"